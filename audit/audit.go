@@ -0,0 +1,227 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Results of an operation
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Entry is an operation recorded in the log. The hash of an entry covers all its fields and the hash
+// of the previous entry, so an entry can't be changed, removed or inserted without breaking the chain.
+type Entry struct {
+	Seq       int64     `json:"seq"`
+	Time      time.Time `json:"time"`
+	Principal string    `json:"principal"`
+	ClientIP  string    `json:"clientIP"`
+	Operation string    `json:"operation"`
+	Path      string    `json:"path"`
+	// File the content comes from, for a copy or a move
+	SourcePath string `json:"sourcePath,omitempty"`
+	// Hashes of the content before and after the operation, empty if there's none
+	OldHash string `json:"oldHash,omitempty"`
+	NewHash string `json:"newHash,omitempty"`
+	// Size of the content written, or removed
+	Size     int64  `json:"size"`
+	Result   string `json:"result"`
+	Error    string `json:"error,omitempty"`
+	PrevHash string `json:"prevHash"`
+	Hash     string `json:"hash"`
+}
+
+// hash returns the hash of the entry, computed with an empty hash field
+func (e Entry) hash() (string, error) {
+	e.Hash = ""
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Hash returns the hash of a content as recorded in the entries
+func Hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Filter selects the entries of a query, every entry matches the empty filter
+type Filter struct {
+	// Only the operations on this file, or on the files under this folder
+	Path string
+	// Only the operations of this principal
+	Principal string
+	// Only the operations recorded from Since, and before Until
+	Since time.Time
+	Until time.Time
+	// Maximum number of entries, the most recent ones, unlimited if zero
+	Limit int
+}
+
+func (f Filter) matches(e Entry) bool {
+	if f.Path != "" && !isUnder(e.Path, f.Path) && (e.SourcePath == "" || !isUnder(e.SourcePath, f.Path)) {
+		return false
+	}
+	if f.Principal != "" && e.Principal != f.Principal {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+func isUnder(path string, folder string) bool {
+	folder = strings.TrimSuffix(folder, string(filepath.Separator))
+	return path == folder || strings.HasPrefix(path, folder+string(filepath.Separator))
+}
+
+// Log is an append-only file of entries, one JSON object per line, chained by their hashes
+type Log struct {
+	filePath string
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	last     Entry
+	now      func() time.Time
+}
+
+// Open opens a log, created if it doesn't exist, after verifying its chain
+func Open(filePath string) (*Log, error) {
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{filePath: filePath, file: file, now: time.Now}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	l.size = fi.Size()
+	if l.last, err = l.Verify(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Close closes the file of the log
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// Append records an operation, its sequence number, time and hashes are set by the log.
+// The entry is synced to the disk before Append returns.
+func (l *Log) Append(entry Entry) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry.Seq = l.last.Seq + 1
+	entry.Time = l.now().UTC()
+	entry.PrevHash = l.last.Hash
+	hash, err := entry.hash()
+	if err != nil {
+		return entry, err
+	}
+	entry.Hash = hash
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return entry, err
+	}
+
+	// A line partly written would break the chain, it's cut off
+	b = append(b, '\n')
+	if n, err := l.file.Write(b); err != nil {
+		if n > 0 {
+			l.file.Truncate(l.size)
+		}
+		return entry, err
+	}
+	if err := l.file.Sync(); err != nil {
+		l.file.Truncate(l.size)
+		return entry, err
+	}
+	l.size += int64(len(b))
+	l.last = entry
+	return entry, nil
+}
+
+// Query returns the entries matching the filter, in the order they were recorded
+func (l *Log) Query(filter Filter) ([]Entry, error) {
+	entries := []Entry{}
+	_, err := l.scan(func(entry Entry) {
+		if !filter.matches(entry) {
+			return
+		}
+		entries = append(entries, entry)
+		if filter.Limit > 0 && len(entries) > filter.Limit {
+			entries = entries[1:]
+		}
+	})
+	return entries, err
+}
+
+// Verify checks the chain of the entries and returns the last one, it fails at the first entry
+// which isn't the one its hash was computed for
+func (l *Log) Verify() (Entry, error) {
+	return l.scan(func(Entry) {})
+}
+
+// scan verifies the entries recorded so far and calls the function for every one of them
+func (l *Log) scan(fn func(Entry)) (Entry, error) {
+	l.mu.Lock()
+	size := l.size
+	l.mu.Unlock()
+
+	file, err := os.Open(l.filePath)
+	if err != nil {
+		return Entry{}, err
+	}
+	defer file.Close()
+
+	var last Entry
+	reader := bufio.NewReader(io.LimitReader(file, size))
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return last, nil
+		}
+		if err != nil && err != io.EOF {
+			return last, err
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return last, fmt.Errorf("invalid entry after %d in the audit log %s: %v", last.Seq, l.filePath, err)
+		}
+		hash, err := entry.hash()
+		if err != nil {
+			return last, err
+		}
+		if entry.Seq != last.Seq+1 || entry.PrevHash != last.Hash || entry.Hash != hash {
+			return last, fmt.Errorf("the audit log %s has been tampered with at entry %d", l.filePath, entry.Seq)
+		}
+		fn(entry)
+		last = entry
+	}
+}
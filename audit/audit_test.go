@@ -0,0 +1,126 @@
+package audit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestLog(t *testing.T) (*Log, string) {
+	dir, err := ioutil.TempDir("", "audit")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	l, err := Open(filepath.Join(dir, "audit.log"))
+	if !assert.NoError(t, err) {
+		os.RemoveAll(dir)
+		t.FailNow()
+	}
+	return l, dir
+}
+
+func TestLogAppend(t *testing.T) {
+	l, dir := openTestLog(t)
+	defer os.RemoveAll(dir)
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	first, err := l.Append(Entry{Principal: "alice", Operation: "create", Path: "/data/a.txt", NewHash: Hash([]byte("Hello")), Size: 5, Result: ResultSuccess})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1), first.Seq)
+		assert.Equal(t, now, first.Time)
+		assert.Empty(t, first.PrevHash)
+		assert.Len(t, first.Hash, 64)
+	}
+	second, err := l.Append(Entry{Principal: "bob", Operation: "remove", Path: "/data/a.txt", Result: ResultSuccess})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(2), second.Seq)
+		assert.Equal(t, first.Hash, second.PrevHash)
+	}
+	assert.NoError(t, l.Close())
+
+	// The chain goes on once reopened
+	l, err = Open(filepath.Join(dir, "audit.log"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+	third, err := l.Append(Entry{Principal: "alice", Operation: "create", Path: "/data/b.txt", Result: ResultSuccess})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(3), third.Seq)
+		assert.Equal(t, second.Hash, third.PrevHash)
+	}
+	last, err := l.Verify()
+	if assert.NoError(t, err) {
+		assert.Equal(t, third, last)
+	}
+}
+
+func TestLogTampered(t *testing.T) {
+	l, dir := openTestLog(t)
+	defer os.RemoveAll(dir)
+	for _, path := range []string{"/data/a.txt", "/data/b.txt", "/data/c.txt"} {
+		_, err := l.Append(Entry{Principal: "alice", Operation: "create", Path: path, Result: ResultSuccess})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, l.Close())
+	filePath := filepath.Join(dir, "audit.log")
+	b, err := ioutil.ReadFile(filePath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	lines := strings.SplitAfter(string(b), "\n")
+
+	for _, tampered := range []string{
+		// An entry changed
+		lines[0] + strings.Replace(lines[1], "alice", "bob", 1) + lines[2],
+		// An entry removed
+		lines[0] + lines[2],
+		// Entries swapped
+		lines[1] + lines[0] + lines[2],
+	} {
+		assert.NoError(t, ioutil.WriteFile(filePath, []byte(tampered), 0600))
+		_, err := Open(filePath)
+		assert.Error(t, err)
+	}
+}
+
+func TestLogQuery(t *testing.T) {
+	l, dir := openTestLog(t)
+	defer os.RemoveAll(dir)
+	defer l.Close()
+	start := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	now := start
+	l.now = func() time.Time { return now }
+
+	for _, entry := range []Entry{
+		{Principal: "alice", Operation: "create", Path: "/data/team-a/a.txt"},
+		{Principal: "bob", Operation: "create", Path: "/data/team-b/b.txt"},
+		{Principal: "alice", Operation: "move", Path: "/data/team-b/a.txt", SourcePath: "/data/team-a/a.txt"},
+		{Principal: "alice", Operation: "remove", Path: "/data/team-a-archive/c.txt"},
+	} {
+		_, err := l.Append(entry)
+		assert.NoError(t, err)
+		now = now.Add(time.Hour)
+	}
+
+	seqs := func(filter Filter) []int64 {
+		entries, err := l.Query(filter)
+		assert.NoError(t, err)
+		seqs := []int64{}
+		for _, entry := range entries {
+			seqs = append(seqs, entry.Seq)
+		}
+		return seqs
+	}
+	assert.Equal(t, []int64{1, 2, 3, 4}, seqs(Filter{}))
+	assert.Equal(t, []int64{1, 3}, seqs(Filter{Path: "/data/team-a"}))
+	assert.Equal(t, []int64{2}, seqs(Filter{Path: "/data/team-b/b.txt/"}))
+	assert.Equal(t, []int64{1, 3, 4}, seqs(Filter{Principal: "alice"}))
+	assert.Equal(t, []int64{2, 3}, seqs(Filter{Since: start.Add(time.Hour), Until: start.Add(3 * time.Hour)}))
+	assert.Equal(t, []int64{3, 4}, seqs(Filter{Principal: "alice", Limit: 2}))
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Header carrying the API key of a request
+const HeaderAPIKey = "X-API-Key"
+
+const apiKeyHashPrefix = "sha256:"
+
+// APIKey is an entry of the API key file, only the hash of the key is kept. API keys are long random
+// strings, so a fast hash is enough, unlike for passwords.
+type APIKey struct {
+	ID     string   `json:"id"`
+	Hash   string   `json:"hash"`
+	Scopes []string `json:"scopes"`
+}
+
+// APIKeys authenticates the requests carrying an API key in the X-API-Key header
+type APIKeys struct {
+	byHash map[string]*Principal
+}
+
+// LoadAPIKeys reads an API key file, a JSON object listing the keys:
+//
+//	{"keys": [{"id": "backup", "hash": "sha256:<hex>", "scopes": ["files:read"]}]}
+func LoadAPIKeys(filePath string) (*APIKeys, error) {
+	b, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Keys []APIKey `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("invalid API key file %s: %v", filePath, err)
+	}
+
+	keys := &APIKeys{byHash: make(map[string]*Principal)}
+	ids := make(map[string]bool)
+	for i, key := range config.Keys {
+		if key.ID == "" || ids[key.ID] {
+			return nil, fmt.Errorf("missing or duplicate id of key %d in %s", i, filePath)
+		}
+		ids[key.ID] = true
+
+		hash := strings.ToLower(key.Hash)
+		if !strings.HasPrefix(hash, apiKeyHashPrefix) {
+			return nil, fmt.Errorf("invalid hash of key %s, expect sha256:<hex>", key.ID)
+		}
+		if b, err := hex.DecodeString(hash[len(apiKeyHashPrefix):]); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("invalid hash of key %s, expect sha256:<hex>", key.ID)
+		}
+		if err := checkScopes(key.Scopes); err != nil {
+			return nil, fmt.Errorf("invalid key %s: %v", key.ID, err)
+		}
+		keys.byHash[hash] = &Principal{Subject: "apikey:" + key.ID, Scopes: key.Scopes}
+	}
+	return keys, nil
+}
+
+// HashAPIKey returns the hash of an API key as written in the API key file
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return apiKeyHashPrefix + hex.EncodeToString(sum[:])
+}
+
+func (k *APIKeys) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(HeaderAPIKey)
+	if key == "" {
+		return nil, nil
+	}
+	// The lookup is by hash, so its timing tells nothing about the keys
+	principal, ok := k.byHash[HashAPIKey(key)]
+	if !ok {
+		return nil, fmt.Errorf("unknown API key")
+	}
+	return principal, nil
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeAPIKeys(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "auth")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	filePath := filepath.Join(dir, "keys.json")
+	assert.NoError(t, ioutil.WriteFile(filePath, []byte(content), 0600))
+	return filePath
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	hash := HashAPIKey("secret")
+	for _, invalid := range []string{
+		`not json`,
+		`{"keys": [{"hash": "` + hash + `", "scopes": []}]}`,
+		`{"keys": [{"id": "a", "hash": "md5:abc", "scopes": []}]}`,
+		`{"keys": [{"id": "a", "hash": "sha256:abc", "scopes": []}]}`,
+		`{"keys": [{"id": "a", "hash": "` + hash + `", "scopes": ["files:delete"]}]}`,
+		`{"keys": [{"id": "a", "hash": "` + hash + `"}, {"id": "a", "hash": "` + hash + `"}]}`,
+	} {
+		filePath := writeAPIKeys(t, invalid)
+		_, err := LoadAPIKeys(filePath)
+		assert.Error(t, err, invalid)
+		os.RemoveAll(filepath.Dir(filePath))
+	}
+}
+
+func TestAPIKeysAuthenticate(t *testing.T) {
+	filePath := writeAPIKeys(t, `{"keys": [
+		{"id": "reader", "hash": "`+HashAPIKey("reader-key")+`", "scopes": ["files:read", "folders:stats"]},
+		{"id": "admin", "hash": "`+HashAPIKey("admin-key")+`", "scopes": ["*"]}
+	]}`)
+	defer os.RemoveAll(filepath.Dir(filePath))
+	keys, err := LoadAPIKeys(filePath)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/file", nil)
+	principal, err := keys.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Nil(t, principal)
+
+	req.Header.Set(HeaderAPIKey, "reader-key")
+	principal, err = keys.Authenticate(req)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "apikey:reader", principal.Subject)
+		assert.True(t, principal.HasScope(ScopeFilesRead))
+		assert.False(t, principal.HasScope(ScopeFilesWrite))
+	}
+
+	req.Header.Set(HeaderAPIKey, "admin-key")
+	principal, err = keys.Authenticate(req)
+	if assert.NoError(t, err) {
+		assert.True(t, principal.HasScope(ScopeStorageAdmin))
+	}
+
+	req.Header.Set(HeaderAPIKey, "guessed-key")
+	_, err = keys.Authenticate(req)
+	assert.Error(t, err)
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/labstack/echo"
+	"net/http"
+	"strings"
+)
+
+// Scopes granted to the callers, "*" grants every scope
+const (
+	ScopeFilesRead    = "files:read"
+	ScopeFilesWrite   = "files:write"
+	ScopeFoldersStats = "folders:stats"
+	ScopeStorageAdmin = "storage:admin"
+	ScopeACLAdmin     = "acl:admin"
+	ScopeAuditRead    = "audit:read"
+	ScopeAll          = "*"
+)
+
+var knownScopes = []string{ScopeAll, ScopeFilesRead, ScopeFilesWrite, ScopeFoldersStats, ScopeStorageAdmin, ScopeACLAdmin, ScopeAuditRead}
+
+// Keys of the principal and of its subject in the context of an authenticated request
+const (
+	PrincipalKey = "principal"
+	SubjectKey   = "subject"
+)
+
+// Principal is the authenticated caller of a request, the roles are the ones granting its scopes if any
+type Principal struct {
+	Subject string   `json:"subject"`
+	Roles   []string `json:"roles,omitempty"`
+	Scopes  []string `json:"scopes"`
+}
+
+// HasScope tells whether the principal is granted the scope
+func (p *Principal) HasScope(scope string) bool {
+	for _, granted := range p.Scopes {
+		if granted == scope || granted == ScopeAll {
+			return true
+		}
+	}
+	return false
+}
+
+// PrincipalOf returns the caller of a request, nil if it isn't authenticated
+func PrincipalOf(c echo.Context) *Principal {
+	principal, _ := c.Get(PrincipalKey).(*Principal)
+	return principal
+}
+
+// Authenticator identifies the caller of a request from its credentials. It returns a nil principal
+// if the request carries none of the credentials it handles, and an error if they are invalid.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Guard authenticates the requests and checks the scopes of their callers,
+// it lets every request through if it has no authenticator
+type Guard struct {
+	authenticators []Authenticator
+	publicPaths    map[string]bool
+}
+
+// NewGuard returns a guard requiring credentials on every route but the public ones
+func NewGuard(authenticators []Authenticator, publicPaths ...string) *Guard {
+	g := &Guard{authenticators: authenticators, publicPaths: make(map[string]bool)}
+	for _, path := range publicPaths {
+		g.publicPaths[path] = true
+	}
+	return g
+}
+
+// Enabled tells whether the requests are authenticated
+func (g *Guard) Enabled() bool {
+	return len(g.authenticators) > 0
+}
+
+// Authenticate is the middleware identifying the caller of every request with the first authenticator
+// recognising its credentials, the requests without valid credentials are rejected unless the route is public
+func (g *Guard) Authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !g.Enabled() {
+			return next(c)
+		}
+
+		for _, authenticator := range g.authenticators {
+			principal, err := authenticator.Authenticate(c.Request())
+			if err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized,
+					fmt.Sprintf("Invalid credentials: %v", err))
+			}
+			if principal != nil {
+				c.Set(PrincipalKey, principal)
+				c.Set(SubjectKey, principal.Subject)
+				return next(c)
+			}
+		}
+
+		if g.publicPaths[c.Path()] {
+			return next(c)
+		}
+		return echo.NewHTTPError(http.StatusUnauthorized, "Missing credentials.")
+	}
+}
+
+// Require returns the middleware rejecting the requests whose caller isn't granted the scope
+func (g *Guard) Require(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !g.Enabled() {
+				return next(c)
+			}
+			principal := PrincipalOf(c)
+			if principal == nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, "Missing credentials.")
+			}
+			if !principal.HasScope(scope) {
+				return echo.NewHTTPError(http.StatusForbidden,
+					fmt.Sprintf("Scope '%s' is required.", scope))
+			}
+			return next(c)
+		}
+	}
+}
+
+func checkScopes(scopes []string) error {
+	for _, scope := range scopes {
+		known := false
+		for _, knownScope := range knownScopes {
+			known = known || scope == knownScope
+		}
+		if !known {
+			return fmt.Errorf("unknown scope %s, expect one of %s", scope, strings.Join(knownScopes, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newGuardedServer(guard *Guard) *echo.Echo {
+	e := echo.New()
+	e.Use(guard.Authenticate)
+	ok := func(c echo.Context) error {
+		// The handlers know the subject of the request, for auditing
+		subject, _ := c.Get(SubjectKey).(string)
+		if principal := PrincipalOf(c); principal != nil && principal.Subject != subject {
+			return c.NoContent(http.StatusInternalServerError)
+		}
+		return c.String(http.StatusOK, subject)
+	}
+	e.GET("/ping", ok)
+	e.GET("/file", ok, guard.Require(ScopeFilesRead))
+	e.PUT("/file", ok, guard.Require(ScopeFilesWrite))
+	e.GET("/folder/usage", ok)
+	return e
+}
+
+func serve(e *echo.Echo, method string, target string, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	if key != "" {
+		req.Header.Set(HeaderAPIKey, key)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGuard(t *testing.T) {
+	filePath := writeAPIKeys(t, `{"keys": [
+		{"id": "reader", "hash": "`+HashAPIKey("reader-key")+`", "scopes": ["files:read"]}
+	]}`)
+	defer os.RemoveAll(filepath.Dir(filePath))
+	keys, err := LoadAPIKeys(filePath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	e := newGuardedServer(NewGuard([]Authenticator{keys}, "/ping"))
+
+	// The public routes are open, and know their caller if any
+	assert.Equal(t, http.StatusOK, serve(e, http.MethodGet, "/ping", "").Code)
+	assert.Equal(t, "apikey:reader", serve(e, http.MethodGet, "/ping", "reader-key").Body.String())
+	assert.Equal(t, http.StatusUnauthorized, serve(e, http.MethodGet, "/ping", "wrong-key").Code)
+
+	// Every other route needs credentials, even without scope
+	assert.Equal(t, http.StatusUnauthorized, serve(e, http.MethodGet, "/file", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(e, http.MethodGet, "/folder/usage", "").Code)
+	assert.Equal(t, http.StatusOK, serve(e, http.MethodGet, "/folder/usage", "reader-key").Code)
+
+	assert.Equal(t, http.StatusOK, serve(e, http.MethodGet, "/file", "reader-key").Code)
+	assert.Equal(t, http.StatusForbidden, serve(e, http.MethodPut, "/file", "reader-key").Code)
+}
+
+func TestGuardDisabled(t *testing.T) {
+	e := newGuardedServer(NewGuard(nil, "/ping"))
+	assert.Equal(t, http.StatusOK, serve(e, http.MethodGet, "/file", "").Code)
+	assert.Equal(t, http.StatusOK, serve(e, http.MethodPut, "/file", "any-key").Code)
+}
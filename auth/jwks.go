@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A key set is fetched again at most this often when a token is signed by an unknown key,
+// so that random key ids can't make the service hammer the issuer
+const minJWKSRefreshInterval = time.Minute
+
+// Largest key set read from a URL
+const maxJWKSSize = 1 << 20
+
+var jwksClient = &http.Client{Timeout: 10 * time.Second}
+
+// KeySet is a JSON Web Key Set read from a file or an http(s) URL, cached until its TTL expires
+// or a token is signed by a key it doesn't hold, e.g. after the issuer rotated its keys
+type KeySet struct {
+	source    string
+	ttl       time.Duration
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	fetching  chan struct{}
+	fetchErr  error
+	now       func() time.Time
+}
+
+func NewKeySet(source string, ttl time.Duration) *KeySet {
+	return &KeySet{source: source, ttl: ttl, now: time.Now}
+}
+
+// Key returns the public key with the given id, or the only key of the set if the id is empty
+func (ks *KeySet) Key(kid string) (crypto.PublicKey, error) {
+	keys, err := ks.current(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+	key, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return key, nil
+}
+
+// current returns the keys of the set, fetched again if they expired or don't hold the key id.
+// A single fetch runs at a time without holding the lock, the keys cached are returned meanwhile.
+func (ks *KeySet) current(kid string) (map[string]crypto.PublicKey, error) {
+	ks.mu.Lock()
+	for {
+		now := ks.now()
+		expired := ks.keys == nil || now.Sub(ks.fetchedAt) >= ks.ttl
+		_, known := ks.keys[kid]
+		if !expired && (known || kid == "" || now.Sub(ks.fetchedAt) < minJWKSRefreshInterval) {
+			keys := ks.keys
+			ks.mu.Unlock()
+			return keys, nil
+		}
+		if ks.fetching == nil {
+			break
+		}
+		if ks.keys != nil {
+			keys := ks.keys
+			ks.mu.Unlock()
+			return keys, nil
+		}
+
+		// Nothing to return before the first fetch is done
+		fetching := ks.fetching
+		ks.mu.Unlock()
+		<-fetching
+		ks.mu.Lock()
+		if ks.keys == nil {
+			err := ks.fetchErr
+			ks.mu.Unlock()
+			return nil, err
+		}
+	}
+	fetching := make(chan struct{})
+	ks.fetching = fetching
+	ks.mu.Unlock()
+
+	keys, err := ks.fetch()
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.fetching = nil
+	close(fetching)
+	ks.fetchedAt = ks.now()
+	ks.fetchErr = err
+	// Keep the previous keys if the issuer can't be reached
+	if err == nil {
+		ks.keys = keys
+	}
+	if ks.keys == nil {
+		return nil, err
+	}
+	return ks.keys, nil
+}
+
+func (ks *KeySet) fetch() (map[string]crypto.PublicKey, error) {
+	var b []byte
+	var err error
+	if strings.HasPrefix(ks.source, "http://") || strings.HasPrefix(ks.source, "https://") {
+		b, err = fetchURL(ks.source)
+	} else {
+		b, err = ioutil.ReadFile(ks.source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the key set %s: %v", ks.source, err)
+	}
+	return ParseJWKS(b)
+}
+
+func fetchURL(url string) ([]byte, error) {
+	resp, err := jwksClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got status %s", resp.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxJWKSSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxJWKSSize {
+		return nil, fmt.Errorf("the key set is larger than %d bytes", maxJWKSSize)
+	}
+	return b, nil
+}
+
+// jwk is a JSON Web Key, only the RSA and P-256 EC signing keys are used
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS returns the signing keys of a JSON Web Key Set by id, the other keys are ignored
+func ParseJWKS(b []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("invalid key set: %v", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var key crypto.PublicKey
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = k.rsaKey()
+		case "EC":
+			key, err = k.ecKey()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %v", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing key in the key set")
+	}
+	return keys, nil
+}
+
+func (k jwk) rsaKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+	if len(n) < 256 {
+		return nil, fmt.Errorf("the modulus must be at least 2048 bits long")
+	}
+	if len(e) == 0 || len(e) > 4 {
+		return nil, fmt.Errorf("invalid exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+func (k jwk) ecKey() (*ecdsa.PublicKey, error) {
+	if k.Crv != "P-256" {
+		return nil, fmt.Errorf("unsupported curve %s, expect P-256", k.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if !key.Curve.IsOnCurve(key.X, key.Y) {
+		return nil, fmt.Errorf("the point isn't on the curve")
+	}
+	return key, nil
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// jwksOf returns the JSON Web Key Set of the public keys, by id
+func jwksOf(keys map[string]crypto.PublicKey) []byte {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	for kid, key := range keys {
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, jwk{Kid: kid, Kty: "RSA", Use: "sig",
+				N: base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())})
+		case *ecdsa.PublicKey:
+			set.Keys = append(set.Keys, jwk{Kid: kid, Kty: "EC", Crv: "P-256",
+				X: base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+				Y: base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32)))})
+		}
+	}
+	b, _ := json.Marshal(&set)
+	return b
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	keys, err := ParseJWKS(jwksOf(map[string]crypto.PublicKey{"rsa": &rsaKey.PublicKey, "ec": &ecKey.PublicKey}))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, len(keys))
+		assert.True(t, rsaKey.PublicKey.Equal(keys["rsa"]))
+		assert.True(t, ecKey.PublicKey.Equal(keys["ec"]))
+	}
+
+	// Encryption keys and unknown key types are ignored
+	_, err = ParseJWKS([]byte(`{"keys": [{"kid": "a", "kty": "oct", "k": "c2VjcmV0"}, {"kid": "b", "kty": "RSA", "use": "enc"}]}`))
+	assert.Error(t, err)
+	_, err = ParseJWKS([]byte(`{"keys": [{"kid": "a", "kty": "EC", "crv": "P-256", "x": "AQ", "y": "AQ"}]}`))
+	assert.Error(t, err)
+	_, err = ParseJWKS([]byte(`{"keys": [{"kid": "a", "kty": "RSA", "n": "AQAB", "e": "AQAB"}]}`))
+	assert.Error(t, err)
+	_, err = ParseJWKS([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestKeySetCache(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwks := jwksOf(map[string]crypto.PublicKey{"k1": &key.PublicKey})
+	fetches := 0
+	up := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		if !up {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(jwks)
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	ks := NewKeySet(server.URL, 10*time.Minute)
+	ks.now = func() time.Time { return now }
+
+	_, err := ks.Key("k1")
+	assert.NoError(t, err)
+	_, err = ks.Key("")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fetches)
+
+	// Unknown keys are looked for at most once a minute
+	_, err = ks.Key("k2")
+	assert.Error(t, err)
+	assert.Equal(t, 1, fetches)
+	now = now.Add(2 * time.Minute)
+	_, err = ks.Key("k2")
+	assert.Error(t, err)
+	assert.Equal(t, 2, fetches)
+
+	// The keys are kept when the issuer is down
+	up = false
+	now = now.Add(time.Hour)
+	_, err = ks.Key("k1")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, fetches)
+
+	ks = NewKeySet(server.URL, time.Minute)
+	_, err = ks.Key("k1")
+	assert.Error(t, err)
+}
+
+func TestKeySetSlowIssuer(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwks := jwksOf(map[string]crypto.PublicKey{"k1": &key.PublicKey})
+	release := make(chan struct{})
+	blocked := make(chan struct{}, 1)
+	slow := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow {
+			blocked <- struct{}{}
+			<-release
+		}
+		w.Write(jwks)
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	now := time.Now()
+	ks := NewKeySet(server.URL, 10*time.Minute)
+	ks.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	_, err := ks.Key("k1")
+	assert.NoError(t, err)
+
+	// The cached keys are used while the key set is fetched again
+	slow = true
+	mu.Lock()
+	now = now.Add(time.Hour)
+	mu.Unlock()
+	fetched := make(chan error)
+	go func() {
+		_, err := ks.Key("k1")
+		fetched <- err
+	}()
+	<-blocked
+	_, err = ks.Key("k1")
+	assert.NoError(t, err)
+	close(release)
+	assert.NoError(t, <-fetched)
+
+	// The key sets too large aren't read
+	large := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, maxJWKSSize+1))
+	}))
+	defer large.Close()
+	_, err = NewKeySet(large.URL, time.Minute).Key("k1")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "larger than")
+	}
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Tolerated clock skew between the issuer and the service
+const jwtLeeway = 30 * time.Second
+
+// JWTConfig configures the validation of the bearer tokens, it's read from a JSON file:
+//
+//	{"jwks": "https://issuer/.well-known/jwks.json", "issuer": "https://issuer", "audience": "webservice",
+//	 "rolesClaim": "realm_access.roles", "roles": {"reader": ["files:read"]}, "cacheTTL": "10m"}
+type JWTConfig struct {
+	// Path or http(s) URL of the JSON Web Key Set of the issuer
+	JWKS string `json:"jwks"`
+	// Issuer and audience the tokens must have, not checked if empty
+	Issuer   string `json:"issuer"`
+	Audience string `json:"audience"`
+	// Claim listing the roles of the subject, a dotted path for nested claims, "roles" by default
+	RolesClaim string `json:"rolesClaim"`
+	// Scopes granted by every role
+	Roles map[string][]string `json:"roles"`
+	// How long the key set is cached, an hour by default
+	CacheTTL string `json:"cacheTTL"`
+}
+
+// LoadJWTConfig reads and checks a JWT configuration file
+func LoadJWTConfig(filePath string) (JWTConfig, error) {
+	var config JWTConfig
+	b, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return config, fmt.Errorf("invalid JWT configuration %s: %v", filePath, err)
+	}
+	return config, nil
+}
+
+// JWTAuthenticator authenticates the requests carrying a bearer token signed with RS256 or ES256
+// by a key of the key set, the scopes of the subject are granted by its roles
+type JWTAuthenticator struct {
+	config JWTConfig
+	keys   *KeySet
+	parser *jwt.Parser
+}
+
+func NewJWTAuthenticator(config JWTConfig) (*JWTAuthenticator, error) {
+	if config.JWKS == "" {
+		return nil, fmt.Errorf("the key set of the JWT configuration cannot be null")
+	}
+	if config.RolesClaim == "" {
+		config.RolesClaim = "roles"
+	}
+	ttl := time.Hour
+	if config.CacheTTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(config.CacheTTL); err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid cache TTL %s", config.CacheTTL)
+		}
+	}
+	for role, scopes := range config.Roles {
+		if err := checkScopes(scopes); err != nil {
+			return nil, fmt.Errorf("invalid role %s: %v", role, err)
+		}
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(jwtLeeway),
+	}
+	if config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(config.Issuer))
+	}
+	if config.Audience != "" {
+		options = append(options, jwt.WithAudience(config.Audience))
+	}
+	return &JWTAuthenticator{
+		config: config,
+		keys:   NewKeySet(config.JWKS, ttl),
+		parser: jwt.NewParser(options...),
+	}, nil
+}
+
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) < 7 || !strings.EqualFold(authorization[:7], "Bearer ") {
+		return nil, nil
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := a.parser.ParseWithClaims(strings.TrimSpace(authorization[7:]), claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return a.keys.Key(kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return nil, fmt.Errorf("the token has no subject")
+	}
+
+	// The subjects of the tokens can't be taken for the ones of the API keys or the certificates
+	principal := &Principal{Subject: "jwt:" + subject, Roles: rolesOf(claims, a.config.RolesClaim)}
+	granted := make(map[string]bool)
+	for _, role := range principal.Roles {
+		for _, scope := range a.config.Roles[role] {
+			granted[scope] = true
+		}
+	}
+	for scope := range granted {
+		principal.Scopes = append(principal.Scopes, scope)
+	}
+	sort.Strings(principal.Scopes)
+	return principal, nil
+}
+
+// rolesOf returns the roles listed by a claim, an array or a space separated string
+func rolesOf(claims jwt.MapClaims, claim string) []string {
+	var value interface{} = map[string]interface{}(claims)
+	for _, name := range strings.Split(claim, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+
+	var roles []string
+	switch value := value.(type) {
+	case string:
+		roles = strings.Fields(value)
+	case []interface{}:
+		for _, role := range value {
+			if role, ok := role.(string); ok {
+				roles = append(roles, role)
+			}
+		}
+	}
+	return roles
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func bearerRequest(token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/file", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// Key pairs generated locally, the public keys are published in a JWKS file
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwksPath := filepath.Join(dir, "jwks.json")
+	assert.NoError(t, ioutil.WriteFile(jwksPath,
+		jwksOf(map[string]crypto.PublicKey{"rsa": &rsaKey.PublicKey, "ec": &ecKey.PublicKey}), 0644))
+
+	configPath := filepath.Join(dir, "jwt.json")
+	assert.NoError(t, ioutil.WriteFile(configPath, []byte(`{"jwks": "`+jwksPath+`",
+		"issuer": "https://issuer.example", "audience": "webservice", "rolesClaim": "realm_access.roles",
+		"roles": {"reader": ["files:read", "folders:stats"], "writer": ["files:read", "files:write"]}}`), 0644))
+	config, err := LoadJWTConfig(configPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	authenticator, err := NewJWTAuthenticator(config)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	sign := func(method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		assert.NoError(t, err)
+		return signed
+	}
+	claims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub":          "alice",
+			"iss":          "https://issuer.example",
+			"aud":          "webservice",
+			"exp":          time.Now().Add(time.Hour).Unix(),
+			"realm_access": map[string]interface{}{"roles": []string{"reader", "writer", "unknown"}},
+		}
+	}
+
+	principal, err := authenticator.Authenticate(httptest.NewRequest(http.MethodGet, "/file", nil))
+	assert.NoError(t, err)
+	assert.Nil(t, principal)
+
+	for _, token := range []string{
+		sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims()),
+		sign(jwt.SigningMethodES256, "ec", ecKey, claims()),
+	} {
+		principal, err := authenticator.Authenticate(bearerRequest(token))
+		if assert.NoError(t, err) {
+			assert.Equal(t, "jwt:alice", principal.Subject)
+			assert.Equal(t, []string{"reader", "writer", "unknown"}, principal.Roles)
+			assert.Equal(t, []string{"files:read", "files:write", "folders:stats"}, principal.Scopes)
+		}
+	}
+
+	// The subject of a token can't be taken for an API key or a certificate
+	principal, err = authenticator.Authenticate(bearerRequest(
+		sign(jwt.SigningMethodRS256, "rsa", rsaKey, withClaim(claims(), "sub", "apikey:admin"))))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "jwt:apikey:admin", principal.Subject)
+	}
+
+	invalid := map[string]string{
+		"wrong key":  sign(jwt.SigningMethodRS256, "rsa", mustRSAKey(), claims()),
+		"wrong kid":  sign(jwt.SigningMethodES256, "rsa", ecKey, claims()),
+		"HMAC":       sign(jwt.SigningMethodHS256, "rsa", []byte("secret"), claims()),
+		"garbage":    "not.a.token",
+		"expired":    sign(jwt.SigningMethodRS256, "rsa", rsaKey, withClaim(claims(), "exp", time.Now().Add(-time.Hour).Unix())),
+		"no expiry":  sign(jwt.SigningMethodRS256, "rsa", rsaKey, withClaim(claims(), "exp", nil)),
+		"issuer":     sign(jwt.SigningMethodRS256, "rsa", rsaKey, withClaim(claims(), "iss", "https://evil.example")),
+		"audience":   sign(jwt.SigningMethodRS256, "rsa", rsaKey, withClaim(claims(), "aud", "other")),
+		"no subject": sign(jwt.SigningMethodRS256, "rsa", rsaKey, withClaim(claims(), "sub", nil)),
+	}
+	for name, token := range invalid {
+		_, err := authenticator.Authenticate(bearerRequest(token))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestRolesOf(t *testing.T) {
+	assert.Equal(t, []string{"a", "b"}, rolesOf(jwt.MapClaims{"roles": "a b"}, "roles"))
+	assert.Equal(t, []string{"a"}, rolesOf(jwt.MapClaims{"roles": []interface{}{"a", 1}}, "roles"))
+	assert.Nil(t, rolesOf(jwt.MapClaims{"roles": "a"}, "realm_access.roles"))
+	assert.Nil(t, rolesOf(jwt.MapClaims{}, "roles"))
+}
+
+func TestNewJWTAuthenticator(t *testing.T) {
+	_, err := NewJWTAuthenticator(JWTConfig{})
+	assert.Error(t, err)
+	_, err = NewJWTAuthenticator(JWTConfig{JWKS: "jwks.json", CacheTTL: "soon"})
+	assert.Error(t, err)
+	_, err = NewJWTAuthenticator(JWTConfig{JWKS: "jwks.json", Roles: map[string][]string{"a": {"files:delete"}}})
+	assert.Error(t, err)
+}
+
+func mustRSAKey() *rsa.PrivateKey {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	return key
+}
+
+func withClaim(claims jwt.MapClaims, name string, value interface{}) jwt.MapClaims {
+	if value == nil {
+		delete(claims, name)
+	} else {
+		claims[name] = value
+	}
+	return claims
+}
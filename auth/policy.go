@@ -0,0 +1,307 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Rights granted on the paths
+const (
+	RightRead   = "read"
+	RightWrite  = "write"
+	RightDelete = "delete"
+	RightStats  = "stats"
+)
+
+var knownRights = []string{RightRead, RightWrite, RightDelete, RightStats}
+
+// Effects of a rule
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// ErrRuleNotFound is returned when removing a rule that doesn't exist
+var ErrRuleNotFound = errors.New("rule not found")
+
+// Rule allows or denies rights on a path and everything under it. The principal is a subject,
+// "role:<name>" for the principals having the role, or "*" for anyone, authenticated or not.
+type Rule struct {
+	ID        string   `json:"id"`
+	Principal string   `json:"principal"`
+	Path      string   `json:"path"`
+	Rights    []string `json:"rights"`
+	Effect    string   `json:"effect"`
+}
+
+func (r Rule) matches(principal *Principal, right string, path string) bool {
+	return r.grants(right) && r.appliesTo(principal) && isUnder(path, r.Path)
+}
+
+func (r Rule) grants(right string) bool {
+	for _, granted := range r.Rights {
+		if granted == right {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) appliesTo(principal *Principal) bool {
+	if r.Principal == "*" {
+		return true
+	}
+	if principal == nil {
+		return false
+	}
+	if strings.HasPrefix(r.Principal, "role:") {
+		for _, role := range principal.Roles {
+			if "role:"+role == r.Principal {
+				return true
+			}
+		}
+		return false
+	}
+	return r.Principal == principal.Subject
+}
+
+// isUnder tells whether the path is the folder or is under it
+func isUnder(path string, folder string) bool {
+	if path == folder || folder == string(filepath.Separator) {
+		return true
+	}
+	return strings.HasPrefix(path, folder+string(filepath.Separator))
+}
+
+// Decision explains why an access is allowed or denied, the rules are the ones matching the access,
+// from the most specific path to the least specific one
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Subject string `json:"subject"`
+	Right   string `json:"right"`
+	Path    string `json:"path"`
+	Reason  string `json:"reason"`
+	Rules   []Rule `json:"rules"`
+}
+
+// Policy grants rights on paths to the principals. Access is denied unless a rule allows it, and a rule
+// denying it overrides any rule allowing it. The rules are kept in a JSON file, rewritten on every change.
+type Policy struct {
+	filePath string
+	mu       sync.RWMutex
+	rules    []Rule
+	nextID   int
+}
+
+// LoadPolicy reads the rules of a policy file, the file is created with the first rule if it doesn't exist
+func LoadPolicy(filePath string) (*Policy, error) {
+	p := &Policy{filePath: filePath, nextID: 1}
+	b, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var config struct {
+		Rules []Rule `json:"rules"`
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %v", filePath, err)
+	}
+	for _, rule := range config.Rules {
+		if _, err := p.addRule(rule); err != nil {
+			return nil, fmt.Errorf("invalid rule %s in %s: %v", rule.ID, filePath, err)
+		}
+	}
+	return p, nil
+}
+
+// Rules returns the rules of the policy
+func (p *Policy) Rules() []Rule {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]Rule{}, p.rules...)
+}
+
+// AddRule checks and adds a rule, an id is given to the rules without one
+func (p *Policy) AddRule(rule Rule) (Rule, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rule, err := p.addRule(rule)
+	if err != nil {
+		return rule, err
+	}
+	if err := p.save(); err != nil {
+		p.rules = p.rules[:len(p.rules)-1]
+		return rule, err
+	}
+	return rule, nil
+}
+
+func (p *Policy) addRule(rule Rule) (Rule, error) {
+	if rule.Principal == "" || rule.Path == "" || len(rule.Rights) == 0 {
+		return rule, fmt.Errorf("a rule needs a principal, a path and rights")
+	}
+	if rule.Effect != EffectAllow && rule.Effect != EffectDeny {
+		return rule, fmt.Errorf("invalid effect %s, expect allow or deny", rule.Effect)
+	}
+	for _, right := range rule.Rights {
+		known := false
+		for _, knownRight := range knownRights {
+			known = known || right == knownRight
+		}
+		if !known {
+			return rule, fmt.Errorf("unknown right %s, expect one of %s", right, strings.Join(knownRights, ", "))
+		}
+	}
+	path, err := CanonicalPath(rule.Path)
+	if err != nil {
+		return rule, err
+	}
+	rule.Path = path
+
+	if rule.ID == "" {
+		for p.hasRule("r" + strconv.Itoa(p.nextID)) {
+			p.nextID++
+		}
+		rule.ID = "r" + strconv.Itoa(p.nextID)
+	} else if p.hasRule(rule.ID) {
+		return rule, fmt.Errorf("duplicate rule id %s", rule.ID)
+	}
+	p.rules = append(p.rules, rule)
+	return rule, nil
+}
+
+func (p *Policy) hasRule(id string) bool {
+	for _, rule := range p.rules {
+		if rule.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveRule removes a rule by id
+func (p *Policy) RemoveRule(id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, rule := range p.rules {
+		if rule.ID == id {
+			rules := p.rules
+			p.rules = append(append([]Rule{}, rules[:i]...), rules[i+1:]...)
+			if err := p.save(); err != nil {
+				p.rules = rules
+				return err
+			}
+			return nil
+		}
+	}
+	return ErrRuleNotFound
+}
+
+// save writes the rules to a tmp file before renaming it to the policy file
+func (p *Policy) save() error {
+	b, err := json.MarshalIndent(struct {
+		Rules []Rule `json:"rules"`
+	}{p.rules}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := p.filePath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, b, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, p.filePath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// Allowed tells whether the principal, nil if anonymous, has the right on the path
+func (p *Policy) Allowed(principal *Principal, right string, path string) bool {
+	return p.Decide(principal, right, path).Allowed
+}
+
+// Decide decides whether the principal, nil if anonymous, has the right on the path, and why
+func (p *Policy) Decide(principal *Principal, right string, path string) Decision {
+	decision := Decision{Right: right, Rules: []Rule{}}
+	if principal != nil {
+		decision.Subject = principal.Subject
+	}
+	canonicalPath, err := CanonicalPath(path)
+	if err != nil {
+		decision.Path = path
+		decision.Reason = fmt.Sprintf("Invalid path: %v", err)
+		return decision
+	}
+	decision.Path = canonicalPath
+
+	p.mu.RLock()
+	for _, rule := range p.rules {
+		if rule.matches(principal, right, canonicalPath) {
+			decision.Rules = append(decision.Rules, rule)
+		}
+	}
+	p.mu.RUnlock()
+	sort.SliceStable(decision.Rules, func(i, j int) bool {
+		return len(decision.Rules[i].Path) > len(decision.Rules[j].Path)
+	})
+
+	var allowedBy *Rule
+	for i, rule := range decision.Rules {
+		if rule.Effect == EffectDeny {
+			decision.Reason = fmt.Sprintf("Denied by rule %s on %s, a denial overrides any allowance.", rule.ID, rule.Path)
+			return decision
+		}
+		if allowedBy == nil {
+			allowedBy = &decision.Rules[i]
+		}
+	}
+	if allowedBy == nil {
+		decision.Reason = fmt.Sprintf("No rule grants the right '%s' on %s.", right, canonicalPath)
+		return decision
+	}
+	decision.Allowed = true
+	decision.Reason = fmt.Sprintf("Allowed by rule %s on %s.", allowedBy.ID, allowedBy.Path)
+	return decision
+}
+
+// CanonicalPath returns the absolute path with the symbolic links of its existing part resolved,
+// so that neither ".." nor a link can reach a path through another one
+func CanonicalPath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			for i := len(missing) - 1; i >= 0; i-- {
+				resolved = filepath.Join(resolved, missing[i])
+			}
+			return resolved, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		missing = append(missing, filepath.Base(path))
+		path = parent
+	}
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "policy.json")
+
+	// A missing policy file is an empty policy, denying everything
+	policy, err := LoadPolicy(filePath)
+	if assert.NoError(t, err) {
+		assert.Empty(t, policy.Rules())
+		assert.False(t, policy.Allowed(&Principal{Subject: "alice"}, RightRead, dir))
+	}
+
+	for _, invalid := range []string{
+		`not json`,
+		`{"rules": [{"principal": "alice", "path": "/data", "rights": ["read"], "effect": "maybe"}]}`,
+		`{"rules": [{"principal": "alice", "path": "/data", "rights": ["execute"], "effect": "allow"}]}`,
+		`{"rules": [{"principal": "alice", "rights": ["read"], "effect": "allow"}]}`,
+		`{"rules": [{"id": "a", "principal": "alice", "path": "/data", "rights": ["read"], "effect": "allow"},
+			{"id": "a", "principal": "bob", "path": "/data", "rights": ["read"], "effect": "allow"}]}`,
+	} {
+		assert.NoError(t, ioutil.WriteFile(filePath, []byte(invalid), 0600))
+		_, err := LoadPolicy(filePath)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestPolicyDecide(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	dir, _ = filepath.EvalSymlinks(dir)
+	teamA := filepath.Join(dir, "team-a")
+	secrets := filepath.Join(teamA, "secrets")
+	assert.NoError(t, os.MkdirAll(secrets, 0755))
+
+	policy, err := LoadPolicy(filepath.Join(dir, "policy.json"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, rule := range []Rule{
+		{Principal: "role:team-a", Path: teamA, Rights: []string{RightRead, RightWrite}, Effect: EffectAllow},
+		{Principal: "*", Path: secrets, Rights: []string{RightRead}, Effect: EffectDeny},
+		{Principal: "bob", Path: dir, Rights: []string{RightStats}, Effect: EffectAllow},
+	} {
+		_, err := policy.AddRule(rule)
+		assert.NoError(t, err)
+	}
+
+	alice := &Principal{Subject: "alice", Roles: []string{"team-a"}}
+	bob := &Principal{Subject: "bob"}
+
+	// Rights are inherited by the paths under a rule, even the ones that don't exist yet
+	assert.True(t, policy.Allowed(alice, RightRead, filepath.Join(teamA, "a.txt")))
+	assert.True(t, policy.Allowed(alice, RightWrite, filepath.Join(teamA, "new", "b.txt")))
+	assert.False(t, policy.Allowed(alice, RightDelete, filepath.Join(teamA, "a.txt")))
+	assert.False(t, policy.Allowed(bob, RightRead, filepath.Join(teamA, "a.txt")))
+	assert.True(t, policy.Allowed(bob, RightStats, teamA))
+	assert.False(t, policy.Allowed(nil, RightStats, teamA))
+
+	// A prefix of the name isn't a parent folder
+	assert.False(t, policy.Allowed(alice, RightRead, teamA+"-archive"))
+
+	// ".." can't escape a denial
+	assert.False(t, policy.Allowed(alice, RightRead, filepath.Join(teamA, "other", "..", "secrets", "key")))
+
+	// A denial overrides an allowance, the matching rules are explained from the most specific one
+	decision := policy.Decide(alice, RightRead, filepath.Join(secrets, "key"))
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, "alice", decision.Subject)
+	if assert.Len(t, decision.Rules, 2) {
+		assert.Equal(t, "r2", decision.Rules[0].ID)
+		assert.Equal(t, "r1", decision.Rules[1].ID)
+	}
+	assert.Contains(t, decision.Reason, "r2")
+	assert.True(t, policy.Allowed(alice, RightWrite, filepath.Join(secrets, "key")))
+
+	// Links are resolved, a link can't reach a denied folder
+	link := filepath.Join(teamA, "link")
+	if assert.NoError(t, os.Symlink(secrets, link)) {
+		assert.False(t, policy.Allowed(alice, RightRead, filepath.Join(link, "key")))
+	}
+}
+
+func TestPolicyRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	dir, _ = filepath.EvalSymlinks(dir)
+	filePath := filepath.Join(dir, "policy.json")
+
+	policy, err := LoadPolicy(filePath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	rule, err := policy.AddRule(Rule{Principal: "alice", Path: dir, Rights: []string{RightRead}, Effect: EffectAllow})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "r1", rule.ID)
+	}
+	_, err = policy.AddRule(Rule{ID: "custom", Principal: "bob", Path: dir + "/./sub", Rights: []string{RightWrite}, Effect: EffectDeny})
+	assert.NoError(t, err)
+	_, err = policy.AddRule(Rule{ID: "custom", Principal: "carol", Path: dir, Rights: []string{RightRead}, Effect: EffectAllow})
+	assert.Error(t, err)
+	_, err = policy.AddRule(Rule{Principal: "carol", Path: dir, Rights: []string{"execute"}, Effect: EffectAllow})
+	assert.Error(t, err)
+
+	// The rules are saved, with their canonical paths
+	reloaded, err := LoadPolicy(filePath)
+	if assert.NoError(t, err) && assert.Len(t, reloaded.Rules(), 2) {
+		assert.Equal(t, filepath.Join(dir, "sub"), reloaded.Rules()[1].Path)
+	}
+
+	assert.Equal(t, ErrRuleNotFound, policy.RemoveRule("unknown"))
+	assert.NoError(t, policy.RemoveRule("r1"))
+	reloaded, err = LoadPolicy(filePath)
+	if assert.NoError(t, err) && assert.Len(t, reloaded.Rules(), 1) {
+		assert.Equal(t, "custom", reloaded.Rules()[0].ID)
+	}
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// How often the files of the certificate are checked for a change, at most
+const certCheckInterval = 10 * time.Second
+
+// CertReloader serves the certificate of a key pair, reloaded once its files change so that a renewed
+// certificate is used without restarting the service
+type CertReloader struct {
+	certFile  string
+	keyFile   string
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+	now       func() time.Time
+}
+
+// NewCertReloader loads the PEM encoded certificate and key
+func NewCertReloader(certFile string, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile, now: time.Now}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	r.checkedAt = r.now()
+	return r, nil
+}
+
+// GetCertificate returns the certificate for a TLS handshake, it's used as tls.Config.GetCertificate
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if now.Sub(r.checkedAt) >= certCheckInterval {
+		// Keep the previous certificate if the new one can't be loaded, e.g. while its files are
+		// being written, it's loaded again at the next check
+		r.reload()
+		r.checkedAt = now
+	}
+	return r.cert, nil
+}
+
+// reload loads the key pair if its files changed since it was last loaded
+func (r *CertReloader) reload() error {
+	var modTime time.Time
+	for _, filePath := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(filePath)
+		if err != nil {
+			return err
+		}
+		if fi.ModTime().After(modTime) {
+			modTime = fi.ModTime()
+		}
+	}
+	if r.cert != nil && modTime.Equal(r.modTime) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("invalid certificate %s or key %s: %v", r.certFile, r.keyFile, err)
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+// ServerTLSConfig returns the TLS configuration of the server. The client certificates are verified
+// against the CAs of the PEM file if any, and required if requireClientCert is set, otherwise the
+// clients without a certificate can still authenticate by other means.
+func ServerTLSConfig(certs *CertReloader, clientCAFile string, requireClientCert bool) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}
+	if clientCAFile == "" {
+		if requireClientCert {
+			return nil, fmt.Errorf("the client CA cannot be null when the client certificates are required")
+		}
+		return config, nil
+	}
+
+	b, err := ioutil.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	config.ClientCAs = x509.NewCertPool()
+	if !config.ClientCAs.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificate found in the client CA file %s", clientCAFile)
+	}
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	if requireClientCert {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// ClientCertificate is an entry of the client certificate file, mapping the subject of a certificate
+// to a principal granted scopes
+type ClientCertificate struct {
+	ID string `json:"id"`
+	// Distinguished name of the subject, as in RFC 2253, e.g. "CN=backup,O=Example"
+	Subject string   `json:"subject"`
+	Scopes  []string `json:"scopes"`
+}
+
+// ClientCertificates authenticates the requests made with a client certificate verified by the server
+type ClientCertificates struct {
+	bySubject map[string]*Principal
+}
+
+// LoadClientCertificates reads a client certificate file, a JSON object listing the subjects:
+//
+//	{"certificates": [{"id": "backup", "subject": "CN=backup,O=Example", "scopes": ["files:read"]}]}
+func LoadClientCertificates(filePath string) (*ClientCertificates, error) {
+	b, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Certificates []ClientCertificate `json:"certificates"`
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("invalid client certificate file %s: %v", filePath, err)
+	}
+
+	certs := &ClientCertificates{bySubject: make(map[string]*Principal)}
+	ids := make(map[string]bool)
+	for i, cert := range config.Certificates {
+		if cert.ID == "" || ids[cert.ID] {
+			return nil, fmt.Errorf("missing or duplicate id of certificate %d in %s", i, filePath)
+		}
+		ids[cert.ID] = true
+
+		if cert.Subject == "" || certs.bySubject[cert.Subject] != nil {
+			return nil, fmt.Errorf("missing or duplicate subject of certificate %s", cert.ID)
+		}
+		if err := checkScopes(cert.Scopes); err != nil {
+			return nil, fmt.Errorf("invalid certificate %s: %v", cert.ID, err)
+		}
+		certs.bySubject[cert.Subject] = &Principal{Subject: "cert:" + cert.ID, Scopes: cert.Scopes}
+	}
+	return certs, nil
+}
+
+func (cc *ClientCertificates) Authenticate(r *http.Request) (*Principal, error) {
+	// Only the certificates verified during the handshake are trusted
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+	subject := r.TLS.VerifiedChains[0][0].Subject.String()
+	principal, ok := cc.bySubject[subject]
+	if !ok {
+		return nil, fmt.Errorf("unknown client certificate %s", subject)
+	}
+	return principal, nil
+}
@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert returns a certificate for localhost signed by the parent, self-signed if it's nil
+func newTestCert(t *testing.T, commonName string, parent *testCert, isCA bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"Example"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	issuer, issuerKey := template, key
+	if parent != nil {
+		issuer, issuerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, issuerKey)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	cert, _ := tls.X509KeyPair(c.certPEM, c.keyPEM)
+	return cert
+}
+
+// writeTestCert writes the certificate and its key, modified at the given time
+func writeTestCert(t *testing.T, dir string, c *testCert, modTime time.Time) (string, string) {
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	assert.NoError(t, ioutil.WriteFile(certFile, c.certPEM, 0600))
+	assert.NoError(t, ioutil.WriteFile(keyFile, c.keyPEM, 0600))
+	assert.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	assert.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+	return certFile, keyFile
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	modTime := time.Now().Add(-time.Hour)
+	first := newTestCert(t, "localhost", nil, false)
+	certFile, keyFile := writeTestCert(t, dir, first, modTime)
+
+	_, err = NewCertReloader(certFile, filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err)
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+	now := time.Now()
+	reloader.now = func() time.Time { return now }
+	served := func() *x509.Certificate {
+		cert, err := reloader.GetCertificate(nil)
+		assert.NoError(t, err)
+		leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+		return leaf
+	}
+	assert.True(t, first.cert.Equal(served()))
+
+	// The renewed certificate is served once the files are checked again
+	second := newTestCert(t, "localhost", nil, false)
+	writeTestCert(t, dir, second, modTime.Add(time.Minute))
+	assert.True(t, first.cert.Equal(served()))
+	now = now.Add(certCheckInterval)
+	assert.True(t, second.cert.Equal(served()))
+
+	// A key not matching the certificate, e.g. not written yet, keeps the previous certificate
+	third := newTestCert(t, "localhost", nil, false)
+	assert.NoError(t, ioutil.WriteFile(certFile, third.certPEM, 0600))
+	now = now.Add(certCheckInterval)
+	assert.True(t, second.cert.Equal(served()))
+	writeTestCert(t, dir, third, modTime.Add(2*time.Minute))
+	now = now.Add(certCheckInterval)
+	assert.True(t, third.cert.Equal(served()))
+}
+
+func TestClientCertificates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	for _, invalid := range []string{
+		`not json`,
+		`{"certificates": [{"subject": "CN=a", "scopes": []}]}`,
+		`{"certificates": [{"id": "a", "scopes": []}]}`,
+		`{"certificates": [{"id": "a", "subject": "CN=a"}, {"id": "b", "subject": "CN=a"}]}`,
+		`{"certificates": [{"id": "a", "subject": "CN=a", "scopes": ["files:delete"]}]}`,
+	} {
+		filePath := filepath.Join(dir, "certs.json")
+		assert.NoError(t, ioutil.WriteFile(filePath, []byte(invalid), 0600))
+		_, err := LoadClientCertificates(filePath)
+		assert.Error(t, err, invalid)
+	}
+
+	ca := newTestCert(t, "Example CA", nil, true)
+	server := newTestCert(t, "localhost", ca, false)
+	backup := newTestCert(t, "backup", ca, false)
+	unknown := newTestCert(t, "unknown", ca, false)
+	selfSigned := newTestCert(t, "backup", nil, false)
+
+	certFile, keyFile := writeTestCert(t, dir, server, time.Now())
+	caFile := filepath.Join(dir, "ca.pem")
+	assert.NoError(t, ioutil.WriteFile(caFile, ca.certPEM, 0600))
+	certsFile := filepath.Join(dir, "certs.json")
+	assert.NoError(t, ioutil.WriteFile(certsFile,
+		[]byte(`{"certificates": [{"id": "backup", "subject": "CN=backup,O=Example", "scopes": ["files:read"]}]}`), 0600))
+	certs, err := LoadClientCertificates(certsFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = ServerTLSConfig(reloader, "", true)
+	assert.Error(t, err)
+	_, err = ServerTLSConfig(reloader, certsFile, false)
+	assert.Error(t, err)
+
+	// serve starts an HTTPS server answering with the subject of the caller
+	serve := func(requireClientCert bool) (string, func()) {
+		config, err := ServerTLSConfig(reloader, caFile, requireClientCert)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		s := &http.Server{ErrorLog: log.New(ioutil.Discard, "", 0), Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := certs.Authenticate(r)
+			switch {
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+			case principal == nil:
+				w.Write([]byte("anonymous"))
+			default:
+				w.Write([]byte(principal.Subject))
+			}
+		})}
+		go s.Serve(tls.NewListener(listener, config))
+		return "https://" + listener.Addr().String(), func() { s.Close() }
+	}
+	request := func(url string, client *testCert) (int, string, error) {
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.cert)
+		config := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+		if client != nil {
+			// Sent even if the server wouldn't accept its issuer
+			cert := client.tlsCertificate()
+			config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return &cert, nil
+			}
+		}
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		defer httpClient.CloseIdleConnections()
+		resp, err := httpClient.Get(url)
+		if err != nil {
+			return 0, "", err
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(b), nil
+	}
+
+	url, stop := serve(true)
+	status, body, err := request(url, backup)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "cert:backup", body)
+	}
+	status, _, err = request(url, unknown)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusUnauthorized, status)
+	}
+	_, _, err = request(url, nil)
+	assert.Error(t, err)
+	_, _, err = request(url, selfSigned)
+	assert.Error(t, err)
+	stop()
+
+	// Without requiring a certificate, the callers may authenticate by other means
+	url, stop = serve(false)
+	defer stop()
+	status, body, err = request(url, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "anonymous", body)
+	}
+	_, _, err = request(url, selfSigned)
+	assert.Error(t, err)
+}
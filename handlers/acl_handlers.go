@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"../audit"
+	"../auth"
+	"../utils"
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"net/http"
+)
+
+// Policy grants the rights on the paths, every access is allowed if it's nil
+var Policy *auth.Policy
+
+// Reason of the files left out of a folder because the caller has no right on them
+const skippedDenied = "denied"
+
+// authorize ensures the caller of the request has the right on every path, the reason of a denial
+// is only logged, the explain endpoint tells it to the administrators
+func authorize(c echo.Context, right string, paths ...string) error {
+	if Policy == nil {
+		return nil
+	}
+	principal := auth.PrincipalOf(c)
+	for _, path := range paths {
+		decision := Policy.Decide(principal, right, path)
+		if !decision.Allowed {
+			log.Warnf("Access denied to '%s', right '%s' on %s: %s", decision.Subject, right, path, decision.Reason)
+			return echo.NewHTTPError(http.StatusForbidden,
+				fmt.Sprintf("Right '%s' on '%s' is denied.", right, path))
+		}
+	}
+	return nil
+}
+
+// authorizeWalk ensures the caller of the request has the right on the entry point, and leaves out
+// the files under it on which the right is denied
+func authorizeWalk(c echo.Context, right string, walkResult utils.WalkResult) utils.WalkResult {
+	if Policy == nil {
+		return walkResult
+	}
+	principal := auth.PrincipalOf(c)
+	allowed := walkResult
+	allowed.FilePaths = nil
+	allowed.FileInfos = nil
+	for i, filePath := range walkResult.FilePaths {
+		if !Policy.Allowed(principal, right, filePath) {
+			allowed.Skipped[skippedDenied]++
+			continue
+		}
+		allowed.FilePaths = append(allowed.FilePaths, filePath)
+		allowed.FileInfos = append(allowed.FileInfos, walkResult.FileInfos[i])
+	}
+	return allowed
+}
+
+// allowed returns whether the caller of the request has the right on a path, nil if every access is allowed
+func allowed(c echo.Context, right string) func(path string) bool {
+	if Policy == nil {
+		return nil
+	}
+	principal := auth.PrincipalOf(c)
+	return func(path string) bool {
+		return Policy.Allowed(principal, right, path)
+	}
+}
+
+// policy returns the policy, or an error if the access control isn't enabled
+func policy() (*auth.Policy, error) {
+	if Policy == nil {
+		return nil, echo.NewHTTPError(http.StatusConflict,
+			"The access control isn't enabled.")
+	}
+	return Policy, nil
+}
+
+func GetACLRulesHandler(c echo.Context) error {
+	policy, err := policy()
+	if err != nil {
+		return err
+	}
+
+	// Response
+	var response struct {
+		Message string      `json:"Message"`
+		Result  []auth.Rule `json:"Result"`
+	}
+	response.Message = "Retrieved successfully."
+	response.Result = policy.Rules()
+	return c.JSON(http.StatusOK, &response)
+}
+
+// AddACLRuleHandler adds the rule sent as a JSON object, e.g.
+// {"principal": "role:team-a", "path": "/data/team-a", "rights": ["read", "write"], "effect": "allow"}
+func AddACLRuleHandler(c echo.Context) error {
+	policy, err := policy()
+	if err != nil {
+		return err
+	}
+
+	var rule auth.Rule
+	if err := json.NewDecoder(c.Request().Body).Decode(&rule); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Invalid rule: %v", err))
+	}
+	if rule.Effect == "" {
+		rule.Effect = auth.EffectAllow
+	}
+	rule, err = policy.AddRule(rule)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Invalid rule: %v", err))
+	}
+	recordAudit(c, audit.Entry{Operation: auditAddACL, Path: rule.Path}, nil)
+
+	// Response
+	var response struct {
+		Message string    `json:"Message"`
+		Result  auth.Rule `json:"Result"`
+	}
+	response.Message = fmt.Sprintf("Rule '%s' has been added.", rule.ID)
+	response.Result = rule
+	return c.JSON(http.StatusCreated, &response)
+}
+
+func RemoveACLRuleHandler(c echo.Context) error {
+	id := c.QueryParam("id")
+
+	// Ensure parameter is not null
+	if id == "" {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			"Parameter 'id' cannot be null.")
+	}
+	policy, err := policy()
+	if err != nil {
+		return err
+	}
+
+	var rulePath string
+	for _, rule := range policy.Rules() {
+		if rule.ID == id {
+			rulePath = rule.Path
+		}
+	}
+	err = policy.RemoveRule(id)
+	if err == auth.ErrRuleNotFound {
+		return echo.NewHTTPError(http.StatusNotFound,
+			fmt.Sprintf("Rule '%s' doesn't exist.", id))
+	}
+	recordAudit(c, audit.Entry{Operation: auditRemoveACL, Path: rulePath}, err)
+	if err != nil {
+		log.Errorf("Error occurred while removing the rule '%s', error: %v", id, err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("Failed to remove rule: %s", id))
+	}
+
+	// Response
+	var response struct {
+		Message string `json:"Message"`
+	}
+	response.Message = fmt.Sprintf("Rule '%s' has been removed.", id)
+	return c.JSON(http.StatusOK, &response)
+}
+
+// ExplainAccessHandler tells whether a principal has a right on a path, and which rules decided it
+//
+//·right    read, write, delete or stats.
+//·path     File or folder accessed.
+//·subject  Subject of the principal, the caller of the request by default.
+//·roles    Roles of the principal, comma separated, with the subject.
+func ExplainAccessHandler(c echo.Context) error {
+	right := c.QueryParam("right")
+	path := c.QueryParam("path")
+
+	// Ensure parameters are not null
+	if right == "" || path == "" {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			"Parameter 'right' or 'path' cannot be null.")
+	}
+	policy, err := policy()
+	if err != nil {
+		return err
+	}
+
+	principal := auth.PrincipalOf(c)
+	if subject := c.QueryParam("subject"); subject != "" {
+		principal = &auth.Principal{Subject: subject, Roles: listQueryParam(c, "roles")}
+	}
+	decision := policy.Decide(principal, right, path)
+
+	// Response
+	var response struct {
+		Message string        `json:"Message"`
+		Result  auth.Decision `json:"Result"`
+	}
+	response.Message = decision.Reason
+	response.Result = decision
+	return c.JSON(http.StatusOK, &response)
+}
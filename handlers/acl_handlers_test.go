@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"../auth"
+	"encoding/json"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withPolicy enables the access control with the rules for the duration of a test
+func withPolicy(t *testing.T, dir string, rules ...auth.Rule) func() {
+	policy, err := auth.LoadPolicy(filepath.Join(dir, "policy.json"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	for _, rule := range rules {
+		if _, err := policy.AddRule(rule); !assert.NoError(t, err) {
+			t.FailNow()
+		}
+	}
+	Policy = policy
+	return func() { Policy = nil }
+}
+
+func TestACLHandlersWithoutPolicy(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/acl/rules", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	err := GetACLRulesHandler(c)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+	}
+}
+
+func TestACLRuleHandlers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handlers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	defer withPolicy(t, dir)()
+
+	e := echo.New()
+	body := `{"principal": "role:team-a", "path": "` + dir + `", "rights": ["read", "write"]}`
+	req := httptest.NewRequest(http.MethodPost, "/acl/rules", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	if assert.NoError(t, AddACLRuleHandler(c)) {
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/acl/rules", strings.NewReader(`{"principal": "bob", "path": "/", "rights": ["execute"]}`))
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	err = AddACLRuleHandler(c)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/acl/rules", nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	if assert.NoError(t, GetACLRulesHandler(c)) {
+		var response struct {
+			Result []auth.Rule `json:"Result"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		if assert.Len(t, response.Result, 1) {
+			assert.Equal(t, "r1", response.Result[0].ID)
+			assert.Equal(t, auth.EffectAllow, response.Result[0].Effect)
+		}
+	}
+
+	// The caller of the request is explained by default, another principal can be given
+	q := make(url.Values)
+	q.Set("right", auth.RightWrite)
+	q.Set("path", filepath.Join(dir, "a.txt"))
+	q.Set("subject", "alice")
+	q.Set("roles", "team-b,team-a")
+	req = httptest.NewRequest(http.MethodGet, "/acl/explain?"+q.Encode(), nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.Set(auth.PrincipalKey, &auth.Principal{Subject: "admin"})
+	if assert.NoError(t, ExplainAccessHandler(c)) {
+		var response struct {
+			Result auth.Decision `json:"Result"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.True(t, response.Result.Allowed)
+		assert.Equal(t, "alice", response.Result.Subject)
+		assert.Len(t, response.Result.Rules, 1)
+	}
+
+	q.Del("subject")
+	req = httptest.NewRequest(http.MethodGet, "/acl/explain?"+q.Encode(), nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.Set(auth.PrincipalKey, &auth.Principal{Subject: "admin"})
+	if assert.NoError(t, ExplainAccessHandler(c)) {
+		var response struct {
+			Result auth.Decision `json:"Result"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.False(t, response.Result.Allowed)
+		assert.Equal(t, "admin", response.Result.Subject)
+	}
+
+	for id, code := range map[string]int{"r1": http.StatusOK, "r2": http.StatusNotFound} {
+		req = httptest.NewRequest(http.MethodDelete, "/acl/rules?id="+id, nil)
+		rec = httptest.NewRecorder()
+		c = e.NewContext(req, rec)
+		err := RemoveACLRuleHandler(c)
+		if code == http.StatusOK {
+			assert.NoError(t, err)
+		} else if assert.Error(t, err) {
+			assert.Equal(t, code, err.(*echo.HTTPError).Code)
+		}
+	}
+	assert.Empty(t, Policy.Rules())
+}
+
+func TestACLEnforcedByHandlers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handlers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	dir, _ = filepath.EvalSymlinks(dir)
+	shared := filepath.Join(dir, "shared")
+	public := filepath.Join(shared, "public")
+	private := filepath.Join(shared, "private")
+	assert.NoError(t, os.MkdirAll(public, 0755))
+	assert.NoError(t, os.MkdirAll(private, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(public, "a.txt"), []byte("Hello, World!"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(private, "b.txt"), []byte("Secret"), 0644))
+
+	defer withPolicy(t, dir,
+		auth.Rule{Principal: "alice", Path: dir, Rights: []string{auth.RightRead, auth.RightStats}, Effect: auth.EffectAllow},
+		auth.Rule{Principal: "*", Path: private, Rights: []string{auth.RightRead, auth.RightStats}, Effect: auth.EffectDeny},
+	)()
+	alice := &auth.Principal{Subject: "alice"}
+
+	e := echo.New()
+	q := make(url.Values)
+	q.Set("filePath", filepath.Join(private, "b.txt"))
+	req := httptest.NewRequest(http.MethodGet, "/file?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set(auth.PrincipalKey, alice)
+	err = GetFileContentHandler(c)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusForbidden, err.(*echo.HTTPError).Code)
+	}
+
+	// The denial doesn't depend on the existence of the file
+	q.Set("filePath", filepath.Join(private, "missing.txt"))
+	req = httptest.NewRequest(http.MethodGet, "/file?"+q.Encode(), nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.Set(auth.PrincipalKey, alice)
+	err = GetFileContentHandler(c)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusForbidden, err.(*echo.HTTPError).Code)
+	}
+
+	q.Set("filePath", filepath.Join(public, "a.txt"))
+	req = httptest.NewRequest(http.MethodGet, "/file?"+q.Encode(), nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.Set(auth.PrincipalKey, alice)
+	if assert.NoError(t, GetFileContentHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	// Alice can't write, and nobody else can read
+	f := make(url.Values)
+	f.Set("filePath", filepath.Join(public, "a.txt"))
+	f.Set("content", "Bye")
+	req = httptest.NewRequest(http.MethodPut, "/file", strings.NewReader(f.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.Set(auth.PrincipalKey, alice)
+	err = ReplaceFileContentHandler(c)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusForbidden, err.(*echo.HTTPError).Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/file?"+q.Encode(), nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.Set(auth.PrincipalKey, &auth.Principal{Subject: "bob"})
+	err = GetFileContentHandler(c)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusForbidden, err.(*echo.HTTPError).Code)
+	}
+
+	// The denied files of a folder are left out
+	q = make(url.Values)
+	q.Set("entryPoint", shared)
+	q.Set("queryTarget", "0")
+	req = httptest.NewRequest(http.MethodGet, "/folder?"+q.Encode(), nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.Set(auth.PrincipalKey, alice)
+	if assert.NoError(t, GetFolderStatsHandler(c)) {
+		var response struct {
+			Result  map[string]int `json:"result"`
+			Skipped map[string]int `json:"skipped"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, 1, response.Result["fileCount"])
+		assert.Equal(t, 1, response.Skipped[skippedDenied])
+	}
+}
@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"../audit"
+	"../auth"
+	"../storage"
+	"../utils"
+	"bufio"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ArchiveLimits bound the uploaded archives, the size limit applies both to the archive and to its extracted files
+var ArchiveLimits = utils.ArchiveLimits{MaxEntries: 10000, MaxBytes: 1 << 30}
+
+var archiveContentTypes = map[string]string{
+	utils.ArchiveTar:   "application/x-tar",
+	utils.ArchiveTarGz: "application/gzip",
+	utils.ArchiveZip:   "application/zip",
+}
+
+// UploadArchiveHandler extracts a tar, tar.gz or zip archive under the entry point. The archive is the body
+// of the request, or the 'archive' file of a multipart form. Entries are first extracted to a staging folder,
+// files are written in place only once the whole archive has been read, and only if none of them exists yet
+// unless overwrite=true. Paths leading outside of the entry point are rejected, links are skipped.
+// A write failing midway, e.g. once a quota is full, leaves the files written before it in place.
+func UploadArchiveHandler(c echo.Context) error {
+	entryPoint := c.QueryParam("entryPoint")
+
+	// Ensure parameter is not null
+	if entryPoint == "" {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			"Parameter 'entryPoint' cannot be null.")
+	}
+	if err := authorize(c, auth.RightWrite, entryPoint); err != nil {
+		return err
+	}
+	if err := checkEntryPoint(entryPoint); err != nil {
+		return err
+	}
+	overwrite, err := boolQueryParam(c, "overwrite", false)
+	if err != nil {
+		return err
+	}
+
+	body, err := archiveBody(c)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	// Staging folder inside the entry point, so the files can be renamed in place
+	staging, err := ioutil.TempDir(entryPoint, ".archive-")
+	if err != nil {
+		log.Errorf("Failed to create a staging folder in %s, error: %v", entryPoint, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to extract the archive.")
+	}
+	defer os.RemoveAll(staging)
+
+	// The entries are streamed to the staging files, never held in memory
+	var names []string
+	sizes := make(map[string]int64)
+	summary, err := extractArchive(body, c.QueryParam("format"), func(name string, r io.Reader) error {
+		filePath := filepath.Join(staging, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			if os.IsExist(err) {
+				return fmt.Errorf("duplicate entry in the archive: %s", name)
+			}
+			return err
+		}
+		size, err := io.Copy(f, r)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+		sizes[name] = size
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The files are locked from the checks until they are all in place
+	filePaths := make([]string, len(names))
+	for i, name := range names {
+		filePaths[i] = filepath.Join(entryPoint, filepath.FromSlash(name))
+	}
+	defer fileLocks.Lock(filePaths...)()
+
+	// Check the rights and the conflicts before moving any file, a rule may deny a folder under the entry point
+	// and a folder under it may be a link to somewhere else
+	root, err := auth.CanonicalPath(entryPoint)
+	if err != nil {
+		log.Errorf("Failed to resolve the entry point %s, error: %v", entryPoint, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to extract the archive.")
+	}
+	overwritten := make(map[string]string)
+	for i, name := range names {
+		filePath := filePaths[i]
+		folder, err := auth.CanonicalPath(filepath.Dir(filePath))
+		if err == nil {
+			folder, err = filepath.Rel(root, folder)
+		}
+		if err != nil || folder == ".." || strings.HasPrefix(folder, ".."+string(filepath.Separator)) {
+			return echo.NewHTTPError(http.StatusConflict,
+				fmt.Sprintf("Folder '%s' is outside of the entry point.", filepath.Dir(filePath)))
+		}
+		if err := authorize(c, auth.RightWrite, filePath); err != nil {
+			return err
+		}
+		if err := checkContentSize(filePath, sizes[name]); err != nil {
+			return err
+		}
+		if fi, err := os.Lstat(filePath); err == nil {
+			if !overwrite || !fi.Mode().IsRegular() {
+				return echo.NewHTTPError(http.StatusConflict,
+					fmt.Sprintf("File '%s' already exists.", filePath))
+			}
+			overwritten[filePath], _ = auditedContent(filePath)
+		}
+		if fi, err := os.Stat(filepath.Dir(filePath)); (err == nil && !fi.IsDir()) || (err != nil && !os.IsNotExist(err)) {
+			return echo.NewHTTPError(http.StatusConflict,
+				fmt.Sprintf("Folder '%s' can't be created.", filepath.Dir(filePath)))
+		}
+	}
+
+	// The quotas must have room for every file before any of them is written
+	changes := make([]storage.QuotaChange, len(names))
+	for i, name := range names {
+		changes[i] = storage.QuotaChange{FilePath: filePaths[i], Size: sizes[name]}
+	}
+	if err := checkQuota(c, changes); err != nil {
+		return err
+	}
+
+	// The files are written through the store like any other write, within the quotas
+	for i, name := range names {
+		filePath := filePaths[i]
+		content, err := ioutil.ReadFile(filepath.Join(staging, filepath.FromSlash(name)))
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(filePath), 0755)
+		}
+		oldHash, replaced := overwritten[filePath]
+		if err == nil {
+			err = writeWithinQuota(c, filePath, int64(len(content)), func() error {
+				if replaced {
+					return Store.Replace(filePath, content)
+				}
+				return Store.Create(filePath, content)
+			})
+		}
+		entry := audit.Entry{Operation: auditCreate, Path: filePath, NewHash: contentHash(content), Size: int64(len(content))}
+		if replaced {
+			entry.Operation, entry.OldHash = auditReplace, oldHash
+		}
+		recordAudit(c, entry, err)
+		if httpErr, ok := err.(*echo.HTTPError); ok {
+			return httpErr
+		}
+		if err != nil {
+			log.Errorf("Failed to write the extracted file %s, error: %v", filePath, err)
+			return echo.NewHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("Failed to extract file: %s", filePath))
+		}
+		indexFile(filePath, content)
+	}
+
+	// Response
+	var response struct {
+		Message string               `json:"Message"`
+		Result  utils.ArchiveSummary `json:"Result"`
+	}
+	response.Message = fmt.Sprintf("%d files have been extracted to '%s'.", summary.Files, entryPoint)
+	response.Result = summary
+	return c.JSON(http.StatusCreated, &response)
+}
+
+// archiveBody returns the uploaded archive
+func archiveBody(c echo.Context) (io.ReadCloser, error) {
+	if !strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		return c.Request().Body, nil
+	}
+	fileHeader, err := c.FormFile("archive")
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest,
+			"Parameter 'archive' cannot be null.")
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		log.Errorf("Failed to open the uploaded archive, error: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to read the archive.")
+	}
+	return file, nil
+}
+
+// extractArchive reads the archive in the given format, or the format detected from its first bytes,
+// and converts the errors to HTTP errors
+func extractArchive(body io.Reader, format string, fn func(name string, r io.Reader) error) (utils.ArchiveSummary, error) {
+	if ArchiveLimits.MaxBytes > 0 {
+		body = &archiveBodyReader{r: body, remaining: ArchiveLimits.MaxBytes}
+	}
+	r := bufio.NewReader(body)
+	if format == "" {
+		header, err := r.Peek(512)
+		if _, ok := err.(*utils.ArchiveLimitError); ok {
+			return utils.ArchiveSummary{}, echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+		}
+		format = utils.DetectArchiveFormat(header)
+	}
+
+	var summary utils.ArchiveSummary
+	var err error
+	switch format {
+	case utils.ArchiveTar, utils.ArchiveTarGz:
+		summary, err = utils.ReadTarArchive(r, format == utils.ArchiveTarGz, ArchiveLimits, fn)
+	case utils.ArchiveZip:
+		// Zip archives are read from their end, spool the upload first
+		var spool *os.File
+		if spool, err = ioutil.TempFile("", "archive"); err != nil {
+			break
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+		var size int64
+		if size, err = io.Copy(spool, r); err == nil {
+			summary, err = utils.ReadZipArchive(spool, size, ArchiveLimits, fn)
+		}
+	default:
+		return summary, echo.NewHTTPError(http.StatusBadRequest,
+			"Unknown archive format, expect tar, tar.gz or zip.")
+	}
+
+	if err == nil {
+		return summary, nil
+	}
+	if _, ok := err.(*utils.ArchiveLimitError); ok {
+		return summary, echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+	}
+	log.Warnf("Failed to extract the archive, error: %v", err)
+	return summary, echo.NewHTTPError(http.StatusBadRequest,
+		fmt.Sprintf("Invalid archive: %v", err))
+}
+
+// archiveBodyReader fails once more than the remaining bytes are read
+type archiveBodyReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (r *archiveBodyReader) Read(p []byte) (int, error) {
+	if r.remaining < 0 {
+		return 0, &utils.ArchiveLimitError{Limit: utils.FormatSize(ArchiveLimits.MaxBytes)}
+	}
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+	n, err := r.r.Read(p)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return n, &utils.ArchiveLimitError{Limit: utils.FormatSize(ArchiveLimits.MaxBytes)}
+	}
+	return n, err
+}
+
+// DownloadArchiveHandler streams the files under the entry point, selected by the walker parameters,
+// as a tar, tar.gz (default) or zip archive built on the fly
+func DownloadArchiveHandler(c echo.Context) error {
+	entryPoint := c.QueryParam("entryPoint")
+
+	// Ensure parameter is not null
+	if entryPoint == "" {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			"Parameter 'entryPoint' cannot be null.")
+	}
+	if err := authorize(c, auth.RightRead, entryPoint); err != nil {
+		return err
+	}
+	if err := checkEntryPoint(entryPoint); err != nil {
+		return err
+	}
+
+	format := c.QueryParam("format")
+	if format == "" {
+		format = utils.ArchiveTarGz
+	}
+	contentType, ok := archiveContentTypes[format]
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Invalid value, parameter 'format' expect tar, tar.gz or zip, got %s", format))
+	}
+
+	// Archives are backups, binary files belong to them
+	options, err := getWalkOptions(c)
+	if err != nil {
+		return err
+	}
+	options.SkipBinary = false
+	walkResult, err := walkEntryPoint(entryPoint, options)
+	if err != nil {
+		return err
+	}
+	walkResult = authorizeWalk(c, auth.RightRead, walkResult)
+
+	response := c.Response()
+	name := filepath.Base(filepath.Clean(entryPoint))
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		name = "archive"
+	}
+	response.Header().Set(echo.HeaderContentType, contentType)
+	response.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", name+"."+format))
+	response.WriteHeader(http.StatusOK)
+
+	// Errors can't be reported once the archive is being sent, the archive is left truncated
+	aw, _ := utils.NewArchiveWriter(response, format)
+	for i, filePath := range walkResult.FilePaths {
+		relativePath, err := filepath.Rel(entryPoint, filePath)
+		if err != nil {
+			continue
+		}
+		content, err := Store.Read(filePath)
+		if err != nil {
+			log.Errorf("Failed to read file %s for the archive, error: %v", filePath, err)
+			continue
+		}
+		if err := aw.Add(filepath.ToSlash(relativePath), walkResult.FileInfos[i], content); err != nil {
+			log.Errorf("Failed to send the archive of %s, error: %v", entryPoint, err)
+			return nil
+		}
+		if err := aw.Flush(); err != nil {
+			log.Errorf("Failed to send the archive of %s, error: %v", entryPoint, err)
+			return nil
+		}
+		response.Flush()
+	}
+	if err := aw.Close(); err != nil {
+		log.Errorf("Failed to send the archive of %s, error: %v", entryPoint, err)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func uploadArchive(dir string, archive []byte, overwrite bool) (*httptest.ResponseRecorder, error) {
+	e := echo.New()
+	q := make(url.Values)
+	q.Set("entryPoint", dir)
+	if overwrite {
+		q.Set("overwrite", "true")
+	}
+	req := httptest.NewRequest(http.MethodPost, "/folder/archive?"+q.Encode(), bytes.NewReader(archive))
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	return rec, UploadArchiveHandler(c)
+}
+
+func TestArchiveHandlers(t *testing.T) {
+	// Download the test data and upload it to another folder
+	e := echo.New()
+	q := make(url.Values)
+	q.Set("entryPoint", "../data")
+	q.Set("format", "zip")
+	req := httptest.NewRequest(http.MethodGet, "/folder/archive?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	if !assert.NoError(t, DownloadArchiveHandler(c)) {
+		return
+	}
+	assert.Equal(t, "application/zip", rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, `attachment; filename="data.zip"`, rec.Header().Get(echo.HeaderContentDisposition))
+	archive := rec.Body.Bytes()
+
+	dir, err := ioutil.TempDir("", "handlers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	rec, err = uploadArchive(dir, archive, false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	}
+	original, _ := ioutil.ReadFile("../data/text_files/text2.txt")
+	extracted, _ := ioutil.ReadFile(filepath.Join(dir, "text_files", "text2.txt"))
+	assert.Equal(t, original, extracted)
+	entries, _ := ioutil.ReadDir(dir)
+	assert.Equal(t, 1, len(entries))
+
+	// Existing files are only replaced on demand
+	_, err = uploadArchive(dir, archive, false)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+	}
+	rec, err = uploadArchive(dir, archive, true)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	}
+}
+
+func TestUploadArchiveHandlerUnsafe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handlers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "ok.txt", Size: 2, Mode: 0644}))
+	tw.Write([]byte("ok"))
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "../evil.txt", Size: 4, Mode: 0644}))
+	tw.Write([]byte("evil"))
+	assert.NoError(t, tw.Close())
+
+	_, err = uploadArchive(dir, buf.Bytes(), false)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	}
+	entries, _ := ioutil.ReadDir(dir)
+	assert.Equal(t, 0, len(entries))
+	_, err = os.Stat(filepath.Join(filepath.Dir(dir), "evil.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	// The folders linked to somewhere else are not written through
+	outside, err := ioutil.TempDir("", "handlers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(outside)
+	assert.NoError(t, os.Symlink(outside, filepath.Join(dir, "docs")))
+	buf.Reset()
+	tw = tar.NewWriter(&buf)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "ok.txt", Size: 2, Mode: 0644}))
+	tw.Write([]byte("ok"))
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "docs/evil.txt", Size: 4, Mode: 0644}))
+	tw.Write([]byte("evil"))
+	assert.NoError(t, tw.Close())
+	_, err = uploadArchive(dir, buf.Bytes(), false)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+	}
+	entries, _ = ioutil.ReadDir(outside)
+	assert.Equal(t, 0, len(entries))
+	_, err = os.Stat(filepath.Join(dir, "ok.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Archives larger than the limit
+	defaultLimits := ArchiveLimits
+	ArchiveLimits.MaxBytes = 100
+	defer func() { ArchiveLimits = defaultLimits }()
+	_, err = uploadArchive(dir, buf.Bytes(), false)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusRequestEntityTooLarge, err.(*echo.HTTPError).Code)
+	}
+}
+
+func TestUploadArchiveHandlerLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handlers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// A small archive of a large file, the file is larger than the limit once extracted
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "a.txt", Size: 1 << 20, Mode: 0644}))
+	tw.Write(make([]byte, 1<<20))
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+	archive := buf.Bytes()
+
+	defaultLimits := ArchiveLimits
+	ArchiveLimits.MaxBytes = 1 << 19
+	_, err = uploadArchive(dir, archive, false)
+	ArchiveLimits = defaultLimits
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusRequestEntityTooLarge, err.(*echo.HTTPError).Code)
+	}
+
+	// The extracted files are limited like the content of any other write
+	MaxContentSize = 1 << 19
+	_, err = uploadArchive(dir, archive, false)
+	MaxContentSize = 0
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusRequestEntityTooLarge, err.(*echo.HTTPError).Code)
+	}
+	entries, _ := ioutil.ReadDir(dir)
+	assert.Equal(t, 0, len(entries))
+
+	// Overwritten files are replaced through the store
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("old"), 0644))
+	store := Store
+	Store = failingMoveStore{store}
+	rec, err := uploadArchive(dir, archive, true)
+	Store = store
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	}
+	fi, err := os.Stat(filepath.Join(dir, "a.txt"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1<<20), fi.Size())
+	}
+}
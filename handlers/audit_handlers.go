@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"../audit"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"net/http"
+	"path/filepath"
+)
+
+// Audit records the operations changing the files, nothing is recorded if it's nil
+var Audit *audit.Log
+
+// Operations recorded in the audit log
+const (
+	auditCreate    = "create"
+	auditReplace   = "replace"
+	auditRemove    = "remove"
+	auditCopy      = "copy"
+	auditMove      = "move"
+	auditAddACL    = "acl.add"
+	auditRemoveACL = "acl.remove"
+	auditRewrap    = "storage.rewrap"
+	auditEncrypt   = "storage.encrypt"
+)
+
+// auditedContent returns the hash and the size of the content of a file before it's changed,
+// nothing if it can't be read or if nothing is recorded
+func auditedContent(filePath string) (string, int64) {
+	if Audit == nil {
+		return "", 0
+	}
+	content, err := Store.Read(filePath)
+	if err != nil {
+		return "", 0
+	}
+	return audit.Hash(content), int64(len(content))
+}
+
+// contentHash returns the hash of a content written, nothing if nothing is recorded
+func contentHash(content []byte) string {
+	if Audit == nil {
+		return ""
+	}
+	return audit.Hash(content)
+}
+
+// recordAudit records an operation of the caller of the request, failed if the error isn't nil.
+// The operation has been done already, a failure to record it is only logged.
+func recordAudit(c echo.Context, entry audit.Entry, err error) {
+	if Audit == nil {
+		return
+	}
+	if entry.Path != "" {
+		if path, err := filepath.Abs(entry.Path); err == nil {
+			entry.Path = path
+		}
+	}
+	if entry.SourcePath != "" {
+		if path, err := filepath.Abs(entry.SourcePath); err == nil {
+			entry.SourcePath = path
+		}
+	}
+	entry.Principal = ClientPrincipal(c)
+	entry.ClientIP = ClientIP(c)
+	entry.Result = audit.ResultSuccess
+	if err != nil {
+		entry.Result = audit.ResultFailure
+		entry.Error = err.Error()
+		if httpErr, ok := err.(*echo.HTTPError); ok {
+			entry.Error = fmt.Sprint(httpErr.Message)
+		}
+	}
+	if _, err := Audit.Append(entry); err != nil {
+		log.Errorf("Failed to record the operation %s on %s in the audit log, error: %v", entry.Operation, entry.Path, err)
+	}
+}
+
+func auditLog() (*audit.Log, error) {
+	if Audit == nil {
+		return nil, echo.NewHTTPError(http.StatusConflict,
+			"The audit log isn't enabled.")
+	}
+	return Audit, nil
+}
+
+// GetAuditEntriesHandler returns the operations recorded in the audit log
+//
+//·path       Only the operations on this file, or on the files under this folder.
+//·principal  Only the operations of this principal.
+//·since      Only the operations recorded from this time, RFC 3339, e.g. 2024-01-02T15:04:05Z.
+//·until      Only the operations recorded before this time.
+//·limit      Maximum number of entries, the most recent ones, 100 by default.
+func GetAuditEntriesHandler(c echo.Context) error {
+	auditLog, err := auditLog()
+	if err != nil {
+		return err
+	}
+
+	filter := audit.Filter{Principal: c.QueryParam("principal")}
+	if path := c.QueryParam("path"); path != "" {
+		if filter.Path, err = filepath.Abs(path); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				fmt.Sprintf("Invalid path: %s", path))
+		}
+	}
+	if filter.Since, err = timeQueryParam(c, "since"); err != nil {
+		return err
+	}
+	if filter.Until, err = timeQueryParam(c, "until"); err != nil {
+		return err
+	}
+	if filter.Limit, err = intQueryParam(c, "limit", 100); err != nil {
+		return err
+	}
+
+	entries, err := auditLog.Query(filter)
+	if err != nil {
+		log.Errorf("Error occurred while querying the audit log, error: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to query the audit log.")
+	}
+
+	// Response
+	var response struct {
+		Message string        `json:"Message"`
+		Result  []audit.Entry `json:"Result"`
+	}
+	response.Message = "Retrieved successfully."
+	response.Result = entries
+	return c.JSON(http.StatusOK, &response)
+}
+
+// VerifyAuditLogHandler verifies the chain of the audit log, and returns its last entry, whose hash
+// can be kept elsewhere to notice the entries removed from the end of the log
+func VerifyAuditLogHandler(c echo.Context) error {
+	auditLog, err := auditLog()
+	if err != nil {
+		return err
+	}
+
+	last, err := auditLog.Verify()
+	if err != nil {
+		log.Errorf("The audit log failed the verification, error: %v", err)
+		return echo.NewHTTPError(http.StatusConflict,
+			fmt.Sprintf("The audit log is invalid: %v", err))
+	}
+
+	// Response
+	var response struct {
+		Message string      `json:"Message"`
+		Result  audit.Entry `json:"Result"`
+	}
+	response.Message = fmt.Sprintf("The %d entries of the audit log are valid.", last.Seq)
+	response.Result = last
+	return c.JSON(http.StatusOK, &response)
+}
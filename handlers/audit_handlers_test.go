@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"../audit"
+	"../auth"
+	"encoding/json"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditHandlersWithoutAuditLog(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/audit", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	err := GetAuditEntriesHandler(c)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+	}
+}
+
+func TestAuditedFileHandlers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handlers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	dir, _ = filepath.EvalSymlinks(dir)
+	auditLog, err := audit.Open(filepath.Join(dir, "audit.log"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer auditLog.Close()
+	Audit = auditLog
+	defer func() { Audit = nil }()
+
+	files := filepath.Join(dir, "files")
+	assert.NoError(t, os.Mkdir(files, 0755))
+	a := filepath.Join(files, "a.txt")
+	b := filepath.Join(files, "b.txt")
+	alice := &auth.Principal{Subject: "alice"}
+
+	e := echo.New()
+	form := func(method string, values map[string]string, handler echo.HandlerFunc) {
+		f := make(url.Values)
+		for name, value := range values {
+			f.Set(name, value)
+		}
+		req := httptest.NewRequest(method, "/file", strings.NewReader(f.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.RemoteAddr = "192.0.2.1:1234"
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set(auth.PrincipalKey, alice)
+		assert.NoError(t, handler(c))
+	}
+	form(http.MethodPost, map[string]string{"filePath": a, "content": "Hello"}, CreateNewFileHandler)
+	form(http.MethodPost, map[string]string{"filePath": a, "content": "Hello, World!"}, ReplaceFileContentHandler)
+
+	batch := `[{"op": "move", "filePath": "` + a + `", "destinationPath": "` + b + `"},
+		{"op": "delete", "filePath": "` + b + `"}]`
+	req := httptest.NewRequest(http.MethodPost, "/file/batch", strings.NewReader(batch))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, BatchFileOperationsHandler(e.NewContext(req, rec)))
+
+	q := make(url.Values)
+	q.Set("path", files)
+	req = httptest.NewRequest(http.MethodGet, "/audit?"+q.Encode(), nil)
+	rec = httptest.NewRecorder()
+	if assert.NoError(t, GetAuditEntriesHandler(e.NewContext(req, rec))) {
+		var response struct {
+			Result []audit.Entry `json:"Result"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		if assert.Len(t, response.Result, 4) {
+			created, replaced, moved, removed := response.Result[0], response.Result[1], response.Result[2], response.Result[3]
+			assert.Equal(t, auditCreate, created.Operation)
+			assert.Equal(t, "alice", created.Principal)
+			assert.Equal(t, "192.0.2.1", created.ClientIP)
+			assert.Equal(t, a, created.Path)
+			assert.Equal(t, audit.Hash([]byte("Hello")), created.NewHash)
+			assert.Equal(t, audit.ResultSuccess, created.Result)
+
+			assert.Equal(t, auditReplace, replaced.Operation)
+			assert.Equal(t, created.NewHash, replaced.OldHash)
+			assert.Equal(t, audit.Hash([]byte("Hello, World!")), replaced.NewHash)
+			assert.Equal(t, int64(13), replaced.Size)
+
+			assert.Equal(t, auditMove, moved.Operation)
+			assert.Equal(t, a, moved.SourcePath)
+			assert.Equal(t, b, moved.Path)
+			assert.Equal(t, replaced.NewHash, moved.NewHash)
+			assert.Empty(t, moved.Principal)
+
+			assert.Equal(t, auditRemove, removed.Operation)
+			assert.Equal(t, replaced.NewHash, removed.OldHash)
+		}
+	}
+
+	// A failed operation is recorded as well
+	form(http.MethodPost, map[string]string{"filePath": filepath.Join(files, "missing", "c.txt"), "content": "Hello"},
+		func(c echo.Context) error {
+			assert.Error(t, CreateNewFileHandler(c))
+			return nil
+		})
+	q = make(url.Values)
+	q.Set("principal", "alice")
+	q.Set("limit", "1")
+	req = httptest.NewRequest(http.MethodGet, "/audit?"+q.Encode(), nil)
+	rec = httptest.NewRecorder()
+	if assert.NoError(t, GetAuditEntriesHandler(e.NewContext(req, rec))) {
+		var response struct {
+			Result []audit.Entry `json:"Result"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		if assert.Len(t, response.Result, 1) {
+			assert.Equal(t, audit.ResultFailure, response.Result[0].Result)
+			assert.NotEmpty(t, response.Result[0].Error)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/audit?since=yesterday", nil)
+	rec = httptest.NewRecorder()
+	err = GetAuditEntriesHandler(e.NewContext(req, rec))
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/audit/verify", nil)
+	rec = httptest.NewRecorder()
+	if assert.NoError(t, VerifyAuditLogHandler(e.NewContext(req, rec))) {
+		assert.Contains(t, rec.Body.String(), "The 5 entries of the audit log are valid.")
+	}
+}
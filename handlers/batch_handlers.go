@@ -0,0 +1,555 @@
+package handlers
+
+import (
+	"../audit"
+	"../auth"
+	"../storage"
+	"../utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// Operations of a batch
+const (
+	batchCreate  = "create"
+	batchReplace = "replace"
+	batchDelete  = "delete"
+	batchMove    = "move"
+)
+
+// Modes of a batch, an atomic batch is applied entirely or not at all
+const (
+	batchAtomic     = "atomic"
+	batchBestEffort = "bestEffort"
+)
+
+// Status of an operation after a batch
+const (
+	batchDone       = "done"
+	batchFailed     = "failed"
+	batchRolledBack = "rolledBack"
+	batchSkipped    = "skipped"
+)
+
+const maxBatchOperations = 10000
+
+// Number of batches run, to name their staging files
+var batchSequence uint64
+
+// errBatchFailed tells the quotas an atomic batch has failed, the failure itself is in the result
+var errBatchFailed = errors.New("the batch failed")
+
+type batchOperation struct {
+	Op              string  `json:"op"`
+	FilePath        string  `json:"filePath"`
+	Content         *string `json:"content"`
+	DestinationPath string  `json:"destinationPath"`
+}
+
+type batchOperationResult struct {
+	Index    int    `json:"index"`
+	Op       string `json:"op"`
+	FilePath string `json:"filePath"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+type batchResult struct {
+	Mode       string                 `json:"mode"`
+	Succeeded  int                    `json:"succeeded"`
+	Failed     int                    `json:"failed"`
+	Operations []batchOperationResult `json:"operations"`
+}
+
+// BatchFileOperationsHandler runs a list of create, replace, delete and move operations sent as a JSON array,
+// or as newline delimited JSON with the application/x-ndjson content type, e.g.
+//
+//	{"op": "create", "filePath": "a.txt", "content": "Hello"}
+//	{"op": "move", "filePath": "a.txt", "destinationPath": "b.txt"}
+//
+// In the atomic mode (default) the operations are checked, the new files are written to staging files,
+// and only then the files are moved in place and the replaced files are backed up, the applied operations
+// are rolled back if one of them fails.
+// In the bestEffort mode every operation is run on its own, failing operations don't stop the batch.
+// The files of the batch are locked against the other handlers until the batch is done.
+func BatchFileOperationsHandler(c echo.Context) error {
+	mode := c.QueryParam("mode")
+	if mode == "" {
+		mode = batchAtomic
+	}
+	if mode != batchAtomic && mode != batchBestEffort {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Invalid value, parameter 'mode' expect atomic or bestEffort, got %s", mode))
+	}
+
+	operations, err := decodeBatchOperations(c.Request())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Invalid batch: %v", err))
+	}
+	if len(operations) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "The batch has no operation.")
+	}
+	for _, operation := range operations {
+		if err := operation.authorize(c); err != nil {
+			return err
+		}
+	}
+
+	// The files of the batch are locked from the checks of its operations until they are applied
+	var paths []string
+	for _, operation := range operations {
+		paths = append(paths, operation.FilePath)
+		if operation.DestinationPath != "" {
+			paths = append(paths, operation.DestinationPath)
+		}
+	}
+	defer fileLocks.Lock(paths...)()
+
+	result := batchResult{Mode: mode, Operations: make([]batchOperationResult, len(operations))}
+	for i, operation := range operations {
+		result.Operations[i] = batchOperationResult{Index: i, Op: operation.Op, FilePath: operation.FilePath, Status: batchSkipped}
+	}
+
+	entries := auditBatch(operations)
+	status := http.StatusOK
+	if mode == batchAtomic {
+		// The quotas count the batch once it's applied, a batch rolled back isn't counted
+		err := applyWithinQuota(c, batchQuotaChanges(operations), func() error {
+			if status = runAtomicBatch(operations, result.Operations); status != http.StatusOK {
+				return errBatchFailed
+			}
+			return nil
+		})
+		if httpErr, ok := err.(*echo.HTTPError); ok {
+			return httpErr
+		}
+	} else {
+		runBestEffortBatch(c, operations, result.Operations)
+	}
+	for i, entry := range entries {
+		switch operation := result.Operations[i]; operation.Status {
+		case batchDone:
+			recordAudit(c, entry, nil)
+		case batchFailed:
+			recordAudit(c, entry, errors.New(operation.Error))
+		case batchRolledBack:
+			recordAudit(c, entry, errors.New("rolled back"))
+		}
+	}
+
+	for _, operation := range result.Operations {
+		switch operation.Status {
+		case batchDone:
+			result.Succeeded++
+		case batchFailed:
+			result.Failed++
+		}
+	}
+
+	// Response
+	var response struct {
+		Message string      `json:"Message"`
+		Result  batchResult `json:"Result"`
+	}
+	response.Message = fmt.Sprintf("%d operations succeeded, %d failed.", result.Succeeded, result.Failed)
+	if status != http.StatusOK {
+		response.Message = "The batch failed, no file has been changed."
+	}
+	response.Result = result
+	return c.JSON(status, &response)
+}
+
+func decodeBatchOperations(req *http.Request) ([]batchOperation, error) {
+	decoder := json.NewDecoder(req.Body)
+	contentType := req.Header.Get(echo.HeaderContentType)
+
+	var operations []batchOperation
+	if !strings.HasPrefix(contentType, "application/x-ndjson") && !strings.HasPrefix(contentType, "application/ndjson") {
+		if err := decoder.Decode(&operations); err != nil {
+			return nil, err
+		}
+	} else {
+		for {
+			var operation batchOperation
+			err := decoder.Decode(&operation)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("operation %d: %v", len(operations), err)
+			}
+			operations = append(operations, operation)
+			if len(operations) > maxBatchOperations {
+				break
+			}
+		}
+	}
+
+	if len(operations) > maxBatchOperations {
+		return nil, fmt.Errorf("more than %d operations", maxBatchOperations)
+	}
+	return operations, nil
+}
+
+// validate checks the parameters of an operation
+func (operation batchOperation) validate() error {
+	if operation.FilePath == "" {
+		return fmt.Errorf("Parameter 'filePath' cannot be null.")
+	}
+	switch operation.Op {
+	case batchCreate, batchReplace:
+		if operation.Content == nil {
+			return fmt.Errorf("Parameter 'content' cannot be null.")
+		}
+		if MaxContentSize > 0 && int64(len(*operation.Content)) > MaxContentSize {
+			return fmt.Errorf("Content of file '%s' is larger than %d bytes.", operation.FilePath, MaxContentSize)
+		}
+	case batchDelete:
+	case batchMove:
+		if operation.DestinationPath == "" {
+			return fmt.Errorf("Parameter 'destinationPath' cannot be null.")
+		}
+	default:
+		return fmt.Errorf("Unknown operation '%s', expect create, replace, delete or move.", operation.Op)
+	}
+	return nil
+}
+
+// authorize ensures the caller of the request has the rights the operation needs, the invalid
+// operations are left to the validation
+func (operation batchOperation) authorize(c echo.Context) error {
+	if operation.validate() != nil {
+		return nil
+	}
+	switch operation.Op {
+	case batchCreate, batchReplace:
+		return authorize(c, auth.RightWrite, operation.FilePath)
+	case batchDelete:
+		return authorize(c, auth.RightDelete, operation.FilePath)
+	case batchMove:
+		if err := authorize(c, auth.RightDelete, operation.FilePath); err != nil {
+			return err
+		}
+		return authorize(c, auth.RightWrite, operation.DestinationPath)
+	}
+	return nil
+}
+
+// auditBatch returns the audit entries of the operations of a batch, the contents replaced, removed
+// or moved are the ones the previous operations of the batch leave
+func auditBatch(operations []batchOperation) []audit.Entry {
+	if Audit == nil {
+		return nil
+	}
+	type content struct {
+		hash string
+		size int64
+	}
+	contents := make(map[string]content)
+	contentOf := func(filePath string) content {
+		if c, ok := contents[filepath.Clean(filePath)]; ok {
+			return c
+		}
+		hash, size := auditedContent(filePath)
+		return content{hash, size}
+	}
+
+	entries := make([]audit.Entry, len(operations))
+	for i, operation := range operations {
+		entry := audit.Entry{Operation: operation.Op, Path: operation.FilePath}
+		if operation.validate() == nil {
+			switch operation.Op {
+			case batchCreate, batchReplace:
+				if operation.Op == batchCreate {
+					entry.Operation = auditCreate
+				} else {
+					entry.Operation = auditReplace
+					entry.OldHash = contentOf(operation.FilePath).hash
+				}
+				entry.NewHash = audit.Hash([]byte(*operation.Content))
+				entry.Size = int64(len(*operation.Content))
+				contents[filepath.Clean(operation.FilePath)] = content{entry.NewHash, entry.Size}
+			case batchDelete:
+				old := contentOf(operation.FilePath)
+				entry.Operation = auditRemove
+				entry.OldHash, entry.Size = old.hash, old.size
+				contents[filepath.Clean(operation.FilePath)] = content{}
+			case batchMove:
+				old := contentOf(operation.FilePath)
+				entry.Operation = auditMove
+				entry.Path, entry.SourcePath = operation.DestinationPath, operation.FilePath
+				entry.NewHash, entry.Size = old.hash, old.size
+				contents[filepath.Clean(operation.FilePath)] = content{}
+				contents[filepath.Clean(operation.DestinationPath)] = old
+			}
+		}
+		entries[i] = entry
+	}
+	return entries
+}
+
+// batchFiles tells whether the files exist once the previous operations of the batch are applied
+type batchFiles map[string]bool
+
+func (files batchFiles) isFile(filePath string) bool {
+	if exists, ok := files[filepath.Clean(filePath)]; ok {
+		return exists
+	}
+	fi, err := os.Stat(filePath)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+func (files batchFiles) exists(filePath string) bool {
+	if exists, ok := files[filepath.Clean(filePath)]; ok {
+		return exists
+	}
+	_, err := os.Lstat(filePath)
+	return err == nil
+}
+
+// check returns why the operation can't be applied, and records its effect otherwise
+func (files batchFiles) check(operation batchOperation) error {
+	switch operation.Op {
+	case batchCreate:
+		if files.exists(operation.FilePath) {
+			return fmt.Errorf("File '%s' already exists.", operation.FilePath)
+		}
+		files[filepath.Clean(operation.FilePath)] = true
+	case batchReplace:
+		if !files.isFile(operation.FilePath) {
+			return fmt.Errorf("File '%s' doesn't exist.", operation.FilePath)
+		}
+	case batchDelete:
+		if !files.isFile(operation.FilePath) {
+			return fmt.Errorf("File '%s' doesn't exist.", operation.FilePath)
+		}
+		files[filepath.Clean(operation.FilePath)] = false
+	case batchMove:
+		if !files.isFile(operation.FilePath) {
+			return fmt.Errorf("File '%s' doesn't exist.", operation.FilePath)
+		}
+		if files.exists(operation.DestinationPath) {
+			return fmt.Errorf("File '%s' already exists.", operation.DestinationPath)
+		}
+		files[filepath.Clean(operation.FilePath)] = false
+		files[filepath.Clean(operation.DestinationPath)] = true
+	}
+	return nil
+}
+
+// runAtomicBatch applies all the operations or none of them and returns the status of the response
+func runAtomicBatch(operations []batchOperation, results []batchOperationResult) int {
+	fail := func(i int, err error, status int) int {
+		results[i].Status = batchFailed
+		results[i].Error = err.Error()
+		return status
+	}
+
+	// Check every operation before touching any file
+	files := make(batchFiles)
+	for i, operation := range operations {
+		if err := operation.validate(); err != nil {
+			return fail(i, err, http.StatusBadRequest)
+		}
+		if err := files.check(operation); err != nil {
+			return fail(i, err, http.StatusConflict)
+		}
+	}
+
+	// Write the new files next to their place
+	sequence := atomic.AddUint64(&batchSequence, 1)
+	stagingPath := func(filePath string, i int, suffix string) string {
+		name := fmt.Sprintf(".%s.batch-%d-%d-%d%s", filepath.Base(filePath), os.Getpid(), sequence, i, suffix)
+		return filepath.Join(filepath.Dir(filePath), name)
+	}
+	staged := make(map[int]string)
+	defer func() {
+		for _, stagedPath := range staged {
+			os.Remove(stagedPath)
+		}
+	}()
+	for i, operation := range operations {
+		if operation.Op != batchCreate {
+			continue
+		}
+		stagedPath := stagingPath(operation.FilePath, i, ".tmp")
+		if err := Store.Create(stagedPath, []byte(*operation.Content)); err != nil {
+			log.Errorf("Failed to stage file %s, error: %v", operation.FilePath, err)
+			return fail(i, err, http.StatusInternalServerError)
+		}
+		staged[i] = stagedPath
+	}
+
+	// Rename the files in place, remembering how to undo each step
+	var undo []func() error
+	var backups []string
+	for i, operation := range operations {
+		var err error
+		switch operation.Op {
+		case batchCreate:
+			if err = Store.Move(staged[i], operation.FilePath); err == nil {
+				filePath := operation.FilePath
+				undo = append(undo, func() error { return Store.Remove(filePath) })
+			}
+		case batchReplace:
+			// The backup keeps the previous content until the batch succeeds
+			backup := stagingPath(operation.FilePath, i, ".bak")
+			// The content is written in place by the store, an encrypted content is bound to its path
+			if err = os.Link(operation.FilePath, backup); err == nil {
+				if err = Store.Replace(operation.FilePath, []byte(*operation.Content)); err != nil {
+					os.Remove(backup)
+				} else {
+					filePath := operation.FilePath
+					backups = append(backups, backup)
+					undo = append(undo, func() error { return os.Rename(backup, filePath) })
+				}
+			}
+		case batchDelete:
+			backup := stagingPath(operation.FilePath, i, ".bak")
+			if err = os.Rename(operation.FilePath, backup); err == nil {
+				filePath := operation.FilePath
+				backups = append(backups, backup)
+				undo = append(undo, func() error { return os.Rename(backup, filePath) })
+			}
+		case batchMove:
+			if err = Store.Move(operation.FilePath, operation.DestinationPath); err == nil {
+				source, destination := operation.FilePath, operation.DestinationPath
+				undo = append(undo, func() error { return Store.Move(destination, source) })
+			}
+		}
+		if err != nil {
+			log.Errorf("Batch operation %d on file %s failed, rolling back, error: %v", i, operation.FilePath, err)
+			// Every applied operation has exactly one undo step
+			for j := len(undo) - 1; j >= 0; j-- {
+				if err := undo[j](); err != nil {
+					log.Errorf("Failed to roll back batch operation %d, error: %v", j, err)
+				}
+				results[j].Status = batchRolledBack
+			}
+			return fail(i, err, http.StatusInternalServerError)
+		}
+		// The staging file is in place, a failed step leaves it to be removed
+		delete(staged, i)
+	}
+
+	// Commit
+	for _, backup := range backups {
+		if err := Store.Remove(backup); err != nil {
+			log.Errorf("Failed to remove the backup %s, error: %v", backup, err)
+		}
+	}
+	for i, operation := range operations {
+		indexBatchOperation(operation)
+		results[i].Status = batchDone
+	}
+	return http.StatusOK
+}
+
+// runBestEffortBatch runs the operations one after the other, whatever happens to the previous ones
+func runBestEffortBatch(c echo.Context, operations []batchOperation, results []batchOperationResult) {
+	for i, operation := range operations {
+		err := operation.validate()
+		if err == nil {
+			err = runBatchOperation(c, operation)
+		}
+		if err != nil {
+			results[i].Status = batchFailed
+			results[i].Error = errorMessage(err)
+			continue
+		}
+		indexBatchOperation(operation)
+		results[i].Status = batchDone
+	}
+}
+
+func runBatchOperation(c echo.Context, operation batchOperation) error {
+	// The checks are those of the file handlers
+	if err := make(batchFiles).check(operation); err != nil {
+		return err
+	}
+
+	var err error
+	switch operation.Op {
+	case batchCreate:
+		err = writeWithinQuota(c, operation.FilePath, int64(len(*operation.Content)), func() error {
+			return Store.Create(operation.FilePath, []byte(*operation.Content))
+		})
+	case batchReplace:
+		err = writeWithinQuota(c, operation.FilePath, int64(len(*operation.Content)), func() error {
+			return Store.Replace(operation.FilePath, []byte(*operation.Content))
+		})
+	case batchDelete:
+		if err = Store.Remove(operation.FilePath); err == nil {
+			forgetQuota(operation.FilePath)
+		}
+	case batchMove:
+		err = moveWithinQuota(c, operation.FilePath, operation.DestinationPath, batchContentSize(operation.FilePath), func() error {
+			return Store.Move(operation.FilePath, operation.DestinationPath)
+		})
+	}
+	if _, ok := err.(*echo.HTTPError); !ok && err != nil {
+		log.Errorf("Batch operation %s on file %s failed, error: %v", operation.Op, operation.FilePath, err)
+	}
+	return err
+}
+
+// batchQuotaChanges returns the changes the valid operations of a batch make to the files counted by the quotas
+func batchQuotaChanges(operations []batchOperation) []storage.QuotaChange {
+	var changes []storage.QuotaChange
+	for _, operation := range operations {
+		if operation.validate() != nil {
+			continue
+		}
+		switch operation.Op {
+		case batchCreate, batchReplace:
+			changes = append(changes, storage.QuotaChange{FilePath: operation.FilePath, Size: int64(len(*operation.Content))})
+		case batchDelete:
+			changes = append(changes, storage.QuotaChange{FilePath: operation.FilePath, Remove: true})
+		case batchMove:
+			changes = append(changes, storage.QuotaChange{FilePath: operation.DestinationPath,
+				SourcePath: operation.FilePath, Size: batchContentSize(operation.FilePath)})
+		}
+	}
+	return changes
+}
+
+// batchContentSize returns the size of the content of a moved file, zero if it doesn't exist yet, the
+// quotas only need it for the files they don't count
+func batchContentSize(filePath string) int64 {
+	fi, err := os.Stat(filePath)
+	if err != nil {
+		return 0
+	}
+	size, err := utils.ContentSize(filePath, fi)
+	if err != nil {
+		return fi.Size()
+	}
+	return size
+}
+
+// indexBatchOperation keeps the search index up to date with an applied operation
+func indexBatchOperation(operation batchOperation) {
+	switch operation.Op {
+	case batchCreate, batchReplace:
+		indexFile(operation.FilePath, []byte(*operation.Content))
+	case batchDelete:
+		unindexFile(operation.FilePath)
+	case batchMove:
+		unindexFile(operation.FilePath)
+		if content, err := Store.Read(operation.DestinationPath); err != nil {
+			log.Errorf("Failed to read file %s to index it, error: %v", operation.DestinationPath, err)
+		} else {
+			indexFile(operation.DestinationPath, content)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"../storage"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runBatch(t *testing.T, mode string, contentType string, body string, expectedCode int) batchResult {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/file/batch?mode="+mode, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, contentType)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	var response struct {
+		Result  batchResult `json:"result"`
+		Message string      `json:"message"`
+	}
+	if assert.NoError(t, BatchFileOperationsHandler(c)) {
+		assert.Equal(t, expectedCode, rec.Code)
+		err := json.Unmarshal([]byte(strings.TrimSpace(rec.Body.String())), &response)
+		if err != nil {
+			log.Fatalf("Failed to parse as json, error: %v", err)
+		}
+	}
+	return response.Result
+}
+
+// listDir returns the names of the files of the directory, staging files included
+func listDir(dir string) []string {
+	var names []string
+	entries, _ := ioutil.ReadDir(dir)
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestAtomicBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handlers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	a, b, c := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt"), filepath.Join(dir, "c.txt")
+	assert.NoError(t, ioutil.WriteFile(a, []byte("old"), 0644))
+
+	body := fmt.Sprintf(`[
+		{"op": "create", "filePath": %q, "content": "new"},
+		{"op": "replace", "filePath": %q, "content": "replaced"},
+		{"op": "move", "filePath": %q, "destinationPath": %q}
+	]`, b, a, a, c)
+	result := runBatch(t, batchAtomic, echo.MIMEApplicationJSON, body, http.StatusOK)
+	assert.Equal(t, 3, result.Succeeded)
+	assert.Equal(t, []string{"b.txt", "c.txt"}, listDir(dir))
+	content, _ := ioutil.ReadFile(c)
+	assert.Equal(t, "replaced", string(content))
+
+	// The second create conflicts, nothing is changed
+	body = fmt.Sprintf(`{"op": "delete", "filePath": %q}
+{"op": "create", "filePath": %q, "content": "again"}
+`, b, c)
+	result = runBatch(t, batchAtomic, "application/x-ndjson", body, http.StatusConflict)
+	assert.Equal(t, 1, result.Failed)
+	assert.Equal(t, batchSkipped, result.Operations[0].Status)
+	assert.Equal(t, batchFailed, result.Operations[1].Status)
+	assert.Equal(t, []string{"b.txt", "c.txt"}, listDir(dir))
+}
+
+func TestAtomicBatchRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handlers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	assert.NoError(t, ioutil.WriteFile(a, []byte("old"), 0644))
+
+	// The destination directory of the move vanishes after the checks, the applied operations are undone
+	missing := filepath.Join(dir, "missing")
+	assert.NoError(t, os.Mkdir(missing, 0755))
+	body := fmt.Sprintf(`[
+		{"op": "replace", "filePath": %q, "content": "replaced"},
+		{"op": "create", "filePath": %q, "content": "new"},
+		{"op": "move", "filePath": %q, "destinationPath": %q}
+	]`, a, b, b, filepath.Join(missing, "b.txt"))
+	assert.NoError(t, os.Remove(missing))
+
+	result := runBatch(t, batchAtomic, echo.MIMEApplicationJSON, body, http.StatusInternalServerError)
+	assert.Equal(t, batchRolledBack, result.Operations[0].Status)
+	assert.Equal(t, batchRolledBack, result.Operations[1].Status)
+	assert.Equal(t, batchFailed, result.Operations[2].Status)
+	assert.Equal(t, []string{"a.txt"}, listDir(dir))
+	content, _ := ioutil.ReadFile(a)
+	assert.Equal(t, "old", string(content))
+
+	// The staging files of the failed steps are removed too
+	store := Store
+	Store = failingMoveStore{store}
+	body = fmt.Sprintf(`[
+		{"op": "replace", "filePath": %q, "content": "replaced"},
+		{"op": "create", "filePath": %q, "content": "new"}
+	]`, a, b)
+	result = runBatch(t, batchAtomic, echo.MIMEApplicationJSON, body, http.StatusInternalServerError)
+	Store = store
+	assert.Equal(t, batchRolledBack, result.Operations[0].Status)
+	assert.Equal(t, batchFailed, result.Operations[1].Status)
+	assert.Equal(t, []string{"a.txt"}, listDir(dir))
+	content, _ = ioutil.ReadFile(a)
+	assert.Equal(t, "old", string(content))
+}
+
+// failingMoveStore fails to move any file
+type failingMoveStore struct {
+	storage.Store
+}
+
+func (failingMoveStore) Move(sourcePath string, destinationPath string) error {
+	return errors.New("the store is read-only")
+}
+
+func TestBestEffortBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handlers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.txt")
+
+	body := fmt.Sprintf(`[
+		{"op": "create", "filePath": %q, "content": "new"},
+		{"op": "delete", "filePath": %q},
+		{"op": "rename", "filePath": %q}
+	]`, a, filepath.Join(dir, "missing.txt"), a)
+	result := runBatch(t, batchBestEffort, echo.MIMEApplicationJSON, body, http.StatusOK)
+	assert.Equal(t, 1, result.Succeeded)
+	assert.Equal(t, 2, result.Failed)
+	assert.Equal(t, batchDone, result.Operations[0].Status)
+	assert.Equal(t, []string{"a.txt"}, listDir(dir))
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"../auth"
+	"../utils"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"net/http"
+	"os"
+)
+
+// Formats of a diff
+const (
+	diffUnified    = "unified"
+	diffSideBySide = "sideBySide"
+	diffWords      = "words"
+)
+
+type diffResult struct {
+	Format    string                 `json:"format"`
+	Identical bool                   `json:"identical"`
+	Diff      string                 `json:"diff,omitempty"`
+	Hunks     []utils.SideBySideHunk `json:"hunks,omitempty"`
+	Segments  []utils.DiffSegment    `json:"segments,omitempty"`
+}
+
+// GetFileDiffHandler compares a file with another file, or with the submitted content,
+// the options are query parameters
+//
+//·oldPath           File compared.
+//·newPath           File it's compared with, or
+//·content           Content it's compared with, e.g. before replacing the file.
+//·format            unified (default), sideBySide or words.
+//·context           Number of unchanged lines around the changes, 3 by default.
+//·ignoreWhitespace  none (default), trailing, change (amount of whitespace) or all.
+func GetFileDiffHandler(c echo.Context) error {
+	oldPath := c.FormValue("oldPath")
+	newPath := c.FormValue("newPath")
+	content := c.FormValue("content")
+
+	// Ensure parameters are not null, an empty content is a valid content
+	_, hasContent := c.Request().Form["content"]
+	if oldPath == "" || (newPath == "" && !hasContent) {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			"Parameter 'oldPath' and either 'newPath' or 'content' cannot be null.")
+	}
+	if err := authorize(c, auth.RightRead, oldPath); err != nil {
+		return err
+	}
+	if newPath != "" {
+		if err := authorize(c, auth.RightRead, newPath); err != nil {
+			return err
+		}
+	}
+
+	format := c.QueryParam("format")
+	if format == "" {
+		format = diffUnified
+	}
+	if format != diffUnified && format != diffSideBySide && format != diffWords {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Invalid value, parameter 'format' expect unified, sideBySide or words, got %s", format))
+	}
+	context, err := intQueryParam(c, "context", 3)
+	if err != nil {
+		return err
+	}
+	ignoreWhitespace := c.QueryParam("ignoreWhitespace")
+	normalize, err := utils.WhitespaceNormalizer(ignoreWhitespace)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Invalid value, parameter 'ignoreWhitespace' expect none, trailing, change or all, got %s", ignoreWhitespace))
+	}
+
+	oldContent, err := readDiffFile(oldPath)
+	if err != nil {
+		return err
+	}
+	newName := "(content)"
+	newContent := []byte(content)
+	if newPath != "" {
+		newName = newPath
+		if newContent, err = readDiffFile(newPath); err != nil {
+			return err
+		}
+	}
+
+	result := diffResult{Format: format}
+	if format == diffWords {
+		// The word diff errors only on the whitespace option, validated above
+		result.Segments, _ = utils.WordDiff(string(oldContent), string(newContent), ignoreWhitespace)
+		result.Identical = true
+		for _, segment := range result.Segments {
+			if segment.Op != utils.DiffEqual {
+				result.Identical = false
+			}
+		}
+	} else {
+		edits := utils.DiffNormalized(utils.SplitLines(string(oldContent)), utils.SplitLines(string(newContent)), normalize)
+		if format == diffUnified {
+			result.Diff = utils.UnifiedDiff(oldPath, newName, edits, context)
+			result.Identical = result.Diff == ""
+		} else {
+			result.Hunks = utils.SideBySide(edits, context)
+			result.Identical = len(result.Hunks) == 0
+		}
+	}
+
+	// Response
+	var response struct {
+		Message string     `json:"Message"`
+		Result  diffResult `json:"Result"`
+	}
+	response.Message = "Compared successfully."
+	response.Result = result
+	return c.JSON(http.StatusOK, &response)
+}
+
+func readDiffFile(filePath string) ([]byte, error) {
+	// Ensure the existence of file
+	if fi, err := os.Stat(filePath); err != nil || fi.IsDir() {
+		message := fmt.Sprintf("File '%s' doesn't exist.", filePath)
+		return nil, echo.NewHTTPError(http.StatusBadRequest, message)
+	}
+
+	b, err := Store.Read(filePath)
+	if err != nil {
+		log.Errorf("Failed to read content from file: %s, error: %v", filePath, err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("Failed to get content from file: %s", filePath))
+	}
+	return b, nil
+}
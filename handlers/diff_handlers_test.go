@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func diffFiles(t *testing.T, f url.Values, q url.Values) diffResult {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/file/diff?"+q.Encode(), strings.NewReader(f.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	var response struct {
+		Result  diffResult `json:"result"`
+		Message string     `json:"message"`
+	}
+	if assert.NoError(t, GetFileDiffHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		err := json.Unmarshal([]byte(strings.TrimSpace(rec.Body.String())), &response)
+		if err != nil {
+			log.Fatalf("Failed to parse as json, error: %v", err)
+		}
+	}
+	return response.Result
+}
+
+func TestGetFileDiffHandler(t *testing.T) {
+	f := make(url.Values)
+	f.Set("oldPath", "../data/text_files/text2.txt")
+	f.Set("newPath", "../data/text_files/text2.txt")
+	assert.True(t, diffFiles(t, f, url.Values{}).Identical)
+
+	// Compared with a submitted content
+	f.Del("newPath")
+	f.Set("content", "There are a few websites")
+	result := diffFiles(t, f, url.Values{})
+	assert.False(t, result.Identical)
+	assert.True(t, strings.HasPrefix(result.Diff, "--- ../data/text_files/text2.txt\n+++ (content)\n@@ -1 +1 @@\n"))
+
+	q := make(url.Values)
+	q.Set("format", "words")
+	result = diffFiles(t, f, q)
+	if assert.True(t, len(result.Segments) > 2) {
+		assert.Equal(t, "There are a ", result.Segments[0].Text)
+	}
+
+	q.Set("format", "sideBySide")
+	result = diffFiles(t, f, q)
+	if assert.Equal(t, 1, len(result.Hunks)) {
+		assert.Equal(t, "change", result.Hunks[0].Rows[0].Op)
+	}
+}
+
+func TestGetFileDiffHandlerMissingFile(t *testing.T) {
+	e := echo.New()
+	q := make(url.Values)
+	q.Set("oldPath", "../data/missing.txt")
+	q.Set("newPath", "../data/text_files/text2.txt")
+	req := httptest.NewRequest(http.MethodGet, "/file/diff?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	err := GetFileDiffHandler(c)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	}
+}
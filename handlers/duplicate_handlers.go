@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"../auth"
+	"../utils"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"net/http"
+	"os"
+)
+
+func GetFolderDuplicatesHandler(c echo.Context) error {
+	entryPoint := c.QueryParam("entryPoint")
+
+	// Ensure parameter is not null
+	if entryPoint == "" {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			"Parameter 'entryPoint' cannot be null.")
+	}
+
+	if err := authorize(c, auth.RightStats, entryPoint); err != nil {
+		return err
+	}
+	if err := checkEntryPoint(entryPoint); err != nil {
+		return err
+	}
+
+	// Near-duplicate detection is optional since it has to read every file
+	nearDuplicates, err := boolQueryParam(c, "nearDuplicates", false)
+	if err != nil {
+		return err
+	}
+	threshold, err := floatQueryParam(c, "threshold", 0.8, 0, 1)
+	if err != nil {
+		return err
+	}
+	shingleSize, err := intQueryParam(c, "shingleSize", 5)
+	if err != nil {
+		return err
+	}
+	if shingleSize == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			"Invalid value, parameter 'shingleSize' expect a positive int, got 0")
+	}
+
+	walkResult, err := listEntryPoint(c, auth.RightStats, entryPoint)
+	if err != nil {
+		return err
+	}
+
+	errorMessage := fmt.Sprintf("Failed to find the duplicate files from the entry point: %s", entryPoint)
+
+	groups, err := utils.FindDuplicates(walkResult.FilePaths, walkResult.FileInfos)
+	if err != nil {
+		log.Errorf("Error occurred while finding duplicates from the entry point: %s, error: %v", entryPoint, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, errorMessage)
+	}
+
+	var totalWastedBytes int64
+	for _, group := range groups {
+		totalWastedBytes += group.WastedBytes
+	}
+
+	// Only one copy of the identical files is compared with the other files
+	var nearDuplicateGroups []utils.NearDuplicateGroup
+	if nearDuplicates {
+		copies := make(map[string]bool)
+		for _, group := range groups {
+			for _, filePath := range group.FilePaths[1:] {
+				copies[filePath] = true
+			}
+		}
+
+		var filePaths []string
+		var fileInfos []os.FileInfo
+		for i, filePath := range walkResult.FilePaths {
+			if !copies[filePath] {
+				filePaths = append(filePaths, filePath)
+				fileInfos = append(fileInfos, walkResult.FileInfos[i])
+			}
+		}
+
+		nearDuplicateGroups, err = utils.FindNearDuplicates(filePaths, fileInfos,
+			utils.NearDuplicateOptions{ShingleSize: shingleSize, Threshold: threshold})
+		if err != nil {
+			log.Errorf("Error occurred while finding near-duplicates from the entry point: %s, error: %v",
+				entryPoint, err)
+			return echo.NewHTTPError(http.StatusInternalServerError, errorMessage)
+		}
+	}
+
+	// Response
+	type duplicatesResult struct {
+		Groups              []utils.DuplicateGroup     `json:"groups"`
+		TotalWastedBytes    int64                      `json:"totalWastedBytes"`
+		NearDuplicateGroups []utils.NearDuplicateGroup `json:"nearDuplicateGroups,omitempty"`
+	}
+
+	if groups == nil {
+		groups = []utils.DuplicateGroup{}
+	}
+
+	var response folderStats
+	response.Message = fmt.Sprintf("Successfully find the duplicate files from the entry point: %s", entryPoint)
+	response.Result = duplicatesResult{
+		Groups:              groups,
+		TotalWastedBytes:    totalWastedBytes,
+		NearDuplicateGroups: nearDuplicateGroups,
+	}
+	response.Skipped = walkResult.Skipped
+	response.Reported = walkResult.Reported
+	return c.JSON(http.StatusOK, &response)
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGetFolderDuplicatesHandler(t *testing.T) {
+	e := echo.New()
+	q := make(url.Values)
+	q.Set("entryPoint", "../data")
+	q.Set("nearDuplicates", "true")
+	req := httptest.NewRequest(http.MethodGet, "/folder/duplicates?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if assert.NoError(t, GetFolderDuplicatesHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response struct {
+			Result struct {
+				Groups              []interface{} `json:"groups"`
+				TotalWastedBytes    int64         `json:"totalWastedBytes"`
+				NearDuplicateGroups []interface{} `json:"nearDuplicateGroups"`
+			} `json:"result"`
+		}
+
+		err := json.Unmarshal([]byte(strings.TrimSpace(rec.Body.String())), &response)
+		if err != nil {
+			log.Fatalf("Failed to parse as json, error: %v", err)
+		}
+		assert.Empty(t, response.Result.Groups)
+		assert.Empty(t, response.Result.NearDuplicateGroups)
+		assert.Equal(t, int64(0), response.Result.TotalWastedBytes)
+	}
+}
+
+func TestGetFolderDuplicatesHandlerInvalidThreshold(t *testing.T) {
+	e := echo.New()
+	q := make(url.Values)
+	q.Set("entryPoint", "../data")
+	q.Set("threshold", "1.5")
+	req := httptest.NewRequest(http.MethodGet, "/folder/duplicates?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	err := GetFolderDuplicatesHandler(c)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	}
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/labstack/echo"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Content codings of the requests and the responses, in order of preference
+const (
+	encodingZstd = "zstd"
+	encodingGzip = "gzip"
+)
+
+var contentEncodings = []string{encodingZstd, encodingGzip}
+
+// Content types which are already compressed, sent as they are
+var compressedContentTypes = []string{
+	"application/gzip",
+	"application/zip",
+	"application/zstd",
+	"image/",
+	"video/",
+	"audio/",
+}
+
+// DecodeRequestBody decompresses the body of the requests sent with a gzip or zstd Content-Encoding,
+// the requests sent with another coding are rejected
+func DecodeRequestBody(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		encoding := strings.ToLower(strings.TrimSpace(req.Header.Get(echo.HeaderContentEncoding)))
+
+		var body io.ReadCloser
+		switch encoding {
+		case "", "identity":
+			return next(c)
+		case encodingGzip:
+			gz, err := gzip.NewReader(req.Body)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest,
+					fmt.Sprintf("Invalid gzip body: %v", err))
+			}
+			body = gz
+		case encodingZstd:
+			zr, err := zstd.NewReader(req.Body, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest,
+					fmt.Sprintf("Invalid zstd body: %v", err))
+			}
+			body = zr.IOReadCloser()
+		default:
+			c.Response().Header().Set(echo.HeaderAcceptEncoding, strings.Join(contentEncodings, ", "))
+			return echo.NewHTTPError(http.StatusUnsupportedMediaType,
+				fmt.Sprintf("Unsupported Content-Encoding %s, expect gzip or zstd.", encoding))
+		}
+		defer body.Close()
+
+		// The handlers see the decompressed body, of unknown length
+		req.Body = body
+		req.Header.Del(echo.HeaderContentEncoding)
+		req.Header.Del(echo.HeaderContentLength)
+		req.ContentLength = -1
+		return next(c)
+	}
+}
+
+// CompressResponse compresses the responses with the coding preferred by the client among zstd and gzip,
+// according to its Accept-Encoding. Contents which are already compressed, such as archives, are sent as they are.
+func CompressResponse(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		res := c.Response()
+		res.Header().Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+		encoding := negotiateEncoding(c.Request().Header.Get(echo.HeaderAcceptEncoding))
+		if encoding == "" || c.Request().Method == http.MethodHead {
+			return next(c)
+		}
+
+		w := &compressedResponseWriter{ResponseWriter: res.Writer, encoding: encoding}
+		res.Writer = w
+		defer func() {
+			// Errors returned without writing anything are sent uncompressed by the error handler
+			w.Close()
+			res.Writer = w.ResponseWriter
+		}()
+		return next(c)
+	}
+}
+
+// negotiateEncoding returns the supported coding with the highest quality value, empty if none is accepted
+func negotiateEncoding(acceptEncoding string) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		qualities[coding] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	for _, encoding := range contentEncodings {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality = qualities["*"]
+		}
+		if quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+	return best
+}
+
+// compressedResponseWriter decides whether to compress the response once its header is written
+type compressedResponseWriter struct {
+	http.ResponseWriter
+	encoding string
+	encoder  encoder
+	started  bool
+}
+
+// encoder is implemented by both gzip.Writer and zstd.Encoder
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+func (w *compressedResponseWriter) WriteHeader(code int) {
+	if !w.started {
+		w.started = true
+		header := w.Header()
+		if code >= http.StatusOK && code != http.StatusNoContent && code != http.StatusNotModified &&
+			header.Get(echo.HeaderContentEncoding) == "" && !isCompressedContentType(header.Get(echo.HeaderContentType)) {
+			header.Set(echo.HeaderContentEncoding, w.encoding)
+			header.Del(echo.HeaderContentLength)
+			if w.encoding == encodingZstd {
+				// Only fails on invalid options
+				w.encoder, _ = zstd.NewWriter(w.ResponseWriter, zstd.WithEncoderConcurrency(1))
+			} else {
+				w.encoder = gzip.NewWriter(w.ResponseWriter)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *compressedResponseWriter) Write(b []byte) (int, error) {
+	if !w.started {
+		if w.Header().Get(echo.HeaderContentType) == "" {
+			w.Header().Set(echo.HeaderContentType, http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.encoder == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.encoder.Write(b)
+}
+
+// Flush sends what has been compressed so far, so streamed responses reach the client
+func (w *compressedResponseWriter) Flush() {
+	if w.encoder != nil {
+		w.encoder.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *compressedResponseWriter) Close() error {
+	if w.encoder == nil {
+		return nil
+	}
+	return w.encoder.Close()
+}
+
+func isCompressedContentType(contentType string) bool {
+	for _, prefix := range compressedContentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"../storage"
+	"../utils"
+	"bytes"
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newEncodingServer() *echo.Echo {
+	e := echo.New()
+	e.Use(DecodeRequestBody, CompressResponse)
+	e.POST("/file", CreateNewFileHandler)
+	e.GET("/file", GetFileContentHandler)
+	e.GET("/folder", GetFolderStatsHandler)
+	e.GET("/folder/archive", DownloadArchiveHandler)
+	return e
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	assert.Equal(t, "", negotiateEncoding(""))
+	assert.Equal(t, "", negotiateEncoding("br, identity"))
+	assert.Equal(t, "gzip", negotiateEncoding("gzip, deflate"))
+	assert.Equal(t, "zstd", negotiateEncoding("gzip, zstd"))
+	assert.Equal(t, "gzip", negotiateEncoding("zstd;q=0.5, GZIP;q=0.8"))
+	assert.Equal(t, "gzip", negotiateEncoding("*, zstd;q=0"))
+	assert.Equal(t, "", negotiateEncoding("gzip;q=0"))
+}
+
+func TestCompressResponse(t *testing.T) {
+	e := newEncodingServer()
+	q := make(url.Values)
+	q.Set("filePath", "../data/text_files/text2.txt")
+	original, _ := ioutil.ReadFile("../data/text_files/text2.txt")
+
+	req := httptest.NewRequest(http.MethodGet, "/file?"+q.Encode(), nil)
+	req.Header.Set(echo.HeaderAcceptEncoding, "gzip")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "gzip", rec.Header().Get(echo.HeaderContentEncoding))
+	gz, err := gzip.NewReader(rec.Body)
+	if assert.NoError(t, err) {
+		body, err := ioutil.ReadAll(gz)
+		assert.NoError(t, err)
+		assert.Contains(t, string(body), `"content":`)
+		assert.Contains(t, string(body), strings.SplitN(string(original), "\n", 2)[0])
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/file?"+q.Encode(), nil)
+	req.Header.Set(echo.HeaderAcceptEncoding, "gzip;q=0.5, zstd")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, "zstd", rec.Header().Get(echo.HeaderContentEncoding))
+	zr, err := zstd.NewReader(rec.Body)
+	if assert.NoError(t, err) {
+		body, err := ioutil.ReadAll(zr)
+		assert.NoError(t, err)
+		assert.Contains(t, string(body), `"content":`)
+		zr.Close()
+	}
+
+	// Neither the errors nor the archives are compressed
+	req = httptest.NewRequest(http.MethodGet, "/file", nil)
+	req.Header.Set(echo.HeaderAcceptEncoding, "gzip")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "", rec.Header().Get(echo.HeaderContentEncoding))
+	assert.Contains(t, rec.Body.String(), "cannot be null")
+
+	q = make(url.Values)
+	q.Set("entryPoint", "../data")
+	req = httptest.NewRequest(http.MethodGet, "/folder/archive?"+q.Encode(), nil)
+	req.Header.Set(echo.HeaderAcceptEncoding, "gzip")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "", rec.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, utils.ArchiveTarGz, utils.DetectArchiveFormat(rec.Body.Bytes()))
+}
+
+func TestDecodeRequestBody(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handlers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	e := newEncodingServer()
+	form := make(url.Values)
+	form.Set("filePath", filepath.Join(dir, "a.txt"))
+	form.Set("content", "Hello, World!")
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(form.Encode()))
+	gz.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/file", bytes.NewReader(buf.Bytes()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.Header.Set(echo.HeaderContentEncoding, "gzip")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	content, _ := ioutil.ReadFile(filepath.Join(dir, "a.txt"))
+	assert.Equal(t, "Hello, World!", string(content))
+
+	req = httptest.NewRequest(http.MethodPost, "/file", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.Header.Set(echo.HeaderContentEncoding, "br")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	assert.Equal(t, "zstd, gzip", rec.Header().Get(echo.HeaderAcceptEncoding))
+
+	req = httptest.NewRequest(http.MethodPost, "/file", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.Header.Set(echo.HeaderContentEncoding, "gzip")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestCompressedStoreHandlers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handlers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	compressedStore, err := storage.NewCompressedStore(storage.NewFileStore(), storage.CompressionZstd)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func(store storage.Store, openFile func(string) (io.ReadCloser, error),
+		contentSize func(string, os.FileInfo) (int64, error)) {
+		Store = store
+		utils.OpenFile = openFile
+		utils.ContentSize = contentSize
+	}(Store, utils.OpenFile, utils.ContentSize)
+	Store = compressedStore
+	utils.OpenFile = compressedStore.Open
+	utils.ContentSize = compressedStore.ContentSize
+
+	e := newEncodingServer()
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 50)
+	form := make(url.Values)
+	form.Set("filePath", filepath.Join(dir, "fox.txt"))
+	form.Set("content", text)
+	req := httptest.NewRequest(http.MethodPost, "/file", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	// The file is compressed on disk, but its content and its statistics are the ones of the text
+	fi, err := os.Stat(filepath.Join(dir, "fox.txt"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, fi.Size() < int64(len(text)))
+
+	q := make(url.Values)
+	q.Set("filePath", filepath.Join(dir, "fox.txt"))
+	req = httptest.NewRequest(http.MethodGet, "/file?"+q.Encode(), nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), text)
+
+	q = make(url.Values)
+	q.Set("entryPoint", dir)
+	q.Set("queryTarget", "totalBytes")
+	req = httptest.NewRequest(http.MethodGet, "/folder?"+q.Encode(), nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"totalBytesCount":2250`)
+	assert.Contains(t, rec.Body.String(), `"physicalBytesCount":`+strconv.FormatInt(fi.Size(), 10))
+
+	q.Set("queryTarget", "alphaChars")
+	req = httptest.NewRequest(http.MethodGet, "/folder?"+q.Encode(), nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `.txt":1750}`)
+}
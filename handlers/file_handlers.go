@@ -1,14 +1,23 @@
 package handlers
 
 import (
+	"../audit"
+	"../auth"
+	"../storage"
+	"../utils"
 	"fmt"
 	"github.com/labstack/echo"
 	"github.com/labstack/gommon/log"
-	"io/ioutil"
 	"net/http"
 	"os"
 )
 
+// Store keeps the content of the files, the file system by default
+var Store storage.Store = storage.NewFileStore()
+
+// fileLocks serialises the handlers changing the same files, so a read-modify-write doesn't lose a write
+var fileLocks = storage.NewPathLocks()
+
 func CreateNewFileHandler(c echo.Context) error {
 	// Get parameters
 	filePath := c.FormValue("filePath")
@@ -20,6 +29,14 @@ func CreateNewFileHandler(c echo.Context) error {
 			"Parameter 'filePath' or 'content' cannot be null.")
 	}
 
+	if err := authorize(c, auth.RightWrite, filePath); err != nil {
+		return err
+	}
+	if err := checkContentSize(filePath, int64(len(content))); err != nil {
+		return err
+	}
+	defer fileLocks.Lock(filePath)()
+
 	// Check if file already exists
 	if _, err := os.Stat(filePath); err == nil {
 		message := fmt.Sprintf("File '%s' already exists.", filePath)
@@ -31,35 +48,23 @@ func CreateNewFileHandler(c echo.Context) error {
 	errorMessage := fmt.Sprintf("Failed to create file: %s.", filePath)
 
 	// Assume file's filePath was totally determined by the parameter
-	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Fatalf("Failed to open/create file %s in write only mode, error: %v", filePath, err)
-		return echo.NewHTTPError(http.StatusInternalServerError, errorMessage)
+	err := writeWithinQuota(c, filePath, int64(len(content)), func() error {
+		return Store.Create(filePath, []byte(content))
+	})
+	recordAudit(c, audit.Entry{
+		Operation: auditCreate,
+		Path:      filePath,
+		NewHash:   contentHash([]byte(content)),
+		Size:      int64(len(content)),
+	}, err)
+	if httpErr, ok := err.(*echo.HTTPError); ok {
+		return httpErr
 	}
-
-	// Write content into the file
-	_, err = file.WriteString(content)
 	if err != nil {
-		log.Fatalf("Error occurred while writing file: %v", err)
-		// Remove the file if failed to close the file
-		if _, err := os.Stat(filePath); err == nil {
-			err = os.Remove(filePath)
-			log.Fatalf("Unable to remove file after failed to close it, file: %s, error: %v", filePath, err)
-		}
-		return echo.NewHTTPError(http.StatusInternalServerError, errorMessage)
-	}
-
-	// Ensure the file was closed properly or otherwise the content might be flushed into the file
-	err = file.Close()
-	if err != nil {
-		log.Fatalf("Failed to close the file after writing new content, file: %s, error: %v", filePath, err)
-		// Remove the file if failed to close the file
-		if _, err := os.Stat(filePath); err == nil {
-			err = os.Remove(filePath)
-			log.Fatalf("Unable to remove file after failed to close it, file: %s, error: %v", filePath, err)
-		}
+		log.Errorf("Failed to create file %s, error: %v", filePath, err)
 		return echo.NewHTTPError(http.StatusInternalServerError, errorMessage)
 	}
+	indexFile(filePath, []byte(content))
 
 	// Response
 	var response struct {
@@ -80,6 +85,10 @@ func GetFileContentHandler(c echo.Context) error {
 			"Parameter 'filePath' cannot be null.")
 	}
 
+	if err := authorize(c, auth.RightRead, filePath); err != nil {
+		return err
+	}
+
 	// Ensure the existence of file
 	if _, err := os.Stat(filePath); err != nil {
 		message := fmt.Sprintf("File '%s' doesn't exist.", filePath)
@@ -87,9 +96,9 @@ func GetFileContentHandler(c echo.Context) error {
 	}
 
 	// Read file's content
-	b, err := ioutil.ReadFile(filePath)
+	b, err := Store.Read(filePath)
 	if err != nil {
-		log.Fatalf("Failed to read content from file: %s, error: %v",filePath, err)
+		log.Errorf("Failed to read content from file: %s, error: %v",filePath, err)
 		message := fmt.Sprintf("Failed to get content from file: %s", filePath)
 		return echo.NewHTTPError(http.StatusInternalServerError, message)
 	}
@@ -121,39 +130,44 @@ func ReplaceFileContentHandler(c echo.Context) error {
 			"Parameter 'filePath' or 'content' cannot be null.")
 	}
 
+	if err := authorize(c, auth.RightWrite, filePath); err != nil {
+		return err
+	}
+	if err := checkContentSize(filePath, int64(len(content))); err != nil {
+		return err
+	}
+	defer fileLocks.Lock(filePath)()
+
 	// Ensure the existence of file
 	if _, err := os.Stat(filePath); err != nil {
 		message := fmt.Sprintf("File '%s' doesn't exist.", filePath)
 		return echo.NewHTTPError(http.StatusBadRequest, message)
 	}
 
-	// Write to tmp file before remove the old file
-	// Rename the tmp file if only everything running well
-	tmpPath := filePath + ".tmp"
-	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE, 0644)
-
 	// Write unified error errorMessage to client
 	errorMessage := fmt.Sprintf("Unable to replace content of file: %s", filePath)
 
-	if err != nil {
-		log.Fatalf("Unable to open file: %s, error: %v", tmpPath, err)
-		return echo.NewHTTPError(http.StatusInternalServerError, errorMessage)
+	// The store writes to a tmp file before replacing the old file,
+	// the file is replaced only if everything ran well
+	oldHash, _ := auditedContent(filePath)
+	err := writeWithinQuota(c, filePath, int64(len(content)), func() error {
+		return Store.Replace(filePath, []byte(content))
+	})
+	recordAudit(c, audit.Entry{
+		Operation: auditReplace,
+		Path:      filePath,
+		OldHash:   oldHash,
+		NewHash:   contentHash([]byte(content)),
+		Size:      int64(len(content)),
+	}, err)
+	if httpErr, ok := err.(*echo.HTTPError); ok {
+		return httpErr
 	}
-	_, err = file.WriteString(content)
 	if err != nil {
-		log.Fatalf("Unable to write content into file: %s, error: %v", tmpPath, err)
-		return echo.NewHTTPError(http.StatusInternalServerError, errorMessage)
-	}
-	if err = file.Close(); err != nil {
-		log.Fatalf("Unable to close file: %s, error: %v", tmpPath, err)
-		return echo.NewHTTPError(http.StatusInternalServerError, errorMessage)
-	}
-
-	// Rename the tmp file
-	if err := os.Rename(tmpPath, filePath); err != nil {
-		log.Fatalf("Failed to rename file from %s to %s, error: %v", tmpPath, filePath, err)
+		log.Errorf("Unable to replace content of file: %s, error: %v", filePath, err)
 		return echo.NewHTTPError(http.StatusInternalServerError, errorMessage)
 	}
+	indexFile(filePath, []byte(content))
 
 	// Response
 	var response struct {
@@ -172,6 +186,11 @@ func RemoveFileHandler(c echo.Context) error {
 			"Parameter 'filePath' or 'content' cannot be null.")
 	}
 
+	if err := authorize(c, auth.RightDelete, filePath); err != nil {
+		return err
+	}
+	defer fileLocks.Lock(filePath)()
+
 	// Ensure the existence of file
 	if _, err := os.Stat(filePath); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest,
@@ -179,11 +198,16 @@ func RemoveFileHandler(c echo.Context) error {
 	}
 
 	// Remove the file
-	if err := os.Remove(filePath); err != nil {
-		log.Fatalf("Error occurred while removing the file '%s', error: %v", filePath, err)
+	oldHash, size := auditedContent(filePath)
+	err := Store.Remove(filePath)
+	recordAudit(c, audit.Entry{Operation: auditRemove, Path: filePath, OldHash: oldHash, Size: size}, err)
+	if err != nil {
+		log.Errorf("Error occurred while removing the file '%s', error: %v", filePath, err)
 		return echo.NewHTTPError(http.StatusInternalServerError,
 			"Failed to remove file: %s", filePath)
 	}
+	unindexFile(filePath)
+	forgetQuota(filePath)
 
 	// Response
 	var response struct{
@@ -191,4 +215,151 @@ func RemoveFileHandler(c echo.Context) error {
 	}
 	response.Message = fmt.Sprintf("File '%s' content has been removed.", filePath)
 	return c.JSON(http.StatusOK, &response)
-}
\ No newline at end of file
+}
+
+func GetFileStatsHandler(c echo.Context) error {
+	filePath := c.QueryParam("filePath")
+	queryTarget := c.QueryParam("queryTarget")
+
+	// Ensure parameter is not null
+	if filePath == "" || queryTarget == "" {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			"Parameter 'filePath' or 'queryTarget' cannot be null.")
+	}
+
+	if err := authorize(c, auth.RightStats, filePath); err != nil {
+		return err
+	}
+
+	// Ensure the existence of file
+	fi, err := os.Stat(filePath)
+	if err != nil {
+		message := fmt.Sprintf("File '%s' doesn't exist.", filePath)
+		return echo.NewHTTPError(http.StatusBadRequest, message)
+	}
+	if fi.Mode().IsDir() {
+		message := fmt.Sprintf("File '%s' is a directory.", filePath)
+		return echo.NewHTTPError(http.StatusBadRequest, message)
+	}
+
+	// Ensure the value of queryTarget is valid
+	queryNumber, err := parseQueryTarget(queryTarget)
+	if err != nil {
+		return err
+	}
+
+	// The statistics of a file are the statistics of a folder containing only that file
+	response, err := computeStats(c, queryNumber, filePath, []string{filePath}, []os.FileInfo{fi})
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, &response)
+}
+
+
+func GetFileLanguageHandler(c echo.Context) error {
+	filePath := c.QueryParam("filePath")
+
+	// Ensure parameter is not null
+	if filePath == "" {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			"Parameter 'filePath' cannot be null.")
+	}
+
+	if err := authorize(c, auth.RightStats, filePath); err != nil {
+		return err
+	}
+
+	// Ensure the existence of file
+	if _, err := os.Stat(filePath); err != nil {
+		message := fmt.Sprintf("File '%s' doesn't exist.", filePath)
+		return echo.NewHTTPError(http.StatusBadRequest, message)
+	}
+
+	guess, err := utils.DetectFileLanguage(filePath)
+	if err != nil {
+		log.Errorf("Error occurred while detecting the language of file: %s, error: %v", filePath, err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("Failed to detect the language of file: %s", filePath))
+	}
+
+	// Response
+	var response struct {
+		Message string              `json:"Message"`
+		Result  utils.LanguageGuess `json:"Result"`
+	}
+	response.Message = "Detected successfully."
+	response.Result = guess
+	return c.JSON(http.StatusOK, &response)
+}
+
+func CopyFileHandler(c echo.Context) error {
+	// Get parameters
+	sourcePath := c.FormValue("sourcePath")
+	destinationPath := c.FormValue("destinationPath")
+
+	// Ensure the parameters are not null
+	if sourcePath == "" || destinationPath == "" {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			"Parameter 'sourcePath' or 'destinationPath' cannot be null.")
+	}
+
+	if err := authorize(c, auth.RightRead, sourcePath); err != nil {
+		return err
+	}
+
+	if err := authorize(c, auth.RightWrite, destinationPath); err != nil {
+		return err
+	}
+	defer fileLocks.Lock(sourcePath, destinationPath)()
+
+	// Ensure the existence of the source and the absence of the destination
+	fi, err := os.Stat(sourcePath)
+	if err != nil || fi.IsDir() {
+		message := fmt.Sprintf("File '%s' doesn't exist.", sourcePath)
+		return echo.NewHTTPError(http.StatusBadRequest, message)
+	}
+	if _, err := os.Stat(destinationPath); err == nil {
+		message := fmt.Sprintf("File '%s' already exists.", destinationPath)
+		return echo.NewHTTPError(http.StatusBadRequest, message)
+	}
+
+	// The copy counts in the quotas as a new file with the content of the source
+	size, err := utils.ContentSize(sourcePath, fi)
+	if err != nil {
+		log.Errorf("Failed to get the size of file %s, error: %v", sourcePath, err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("Failed to copy file: %s.", sourcePath))
+	}
+	hash, _ := auditedContent(sourcePath)
+	err = writeWithinQuota(c, destinationPath, size, func() error {
+		return Store.Copy(sourcePath, destinationPath)
+	})
+	recordAudit(c, audit.Entry{
+		Operation:  auditCopy,
+		Path:       destinationPath,
+		SourcePath: sourcePath,
+		NewHash:    hash,
+		Size:       size,
+	}, err)
+	if httpErr, ok := err.(*echo.HTTPError); ok {
+		return httpErr
+	}
+	if err != nil {
+		log.Errorf("Failed to copy file %s to %s, error: %v", sourcePath, destinationPath, err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("Failed to copy file: %s.", sourcePath))
+	}
+	if content, err := Store.Read(destinationPath); err != nil {
+		log.Errorf("Failed to read file %s to index it, error: %v", destinationPath, err)
+	} else {
+		indexFile(destinationPath, content)
+	}
+
+	// Response
+	var response struct {
+		Message string `json:"Message"`
+	}
+	response.Message = fmt.Sprintf("File '%s' has been copied to '%s'.", sourcePath, destinationPath)
+	return c.JSON(http.StatusCreated, &response)
+}
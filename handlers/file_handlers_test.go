@@ -66,4 +66,33 @@ func TestRemoveFileHandler(t *testing.T) {
 	if assert.NoError(t, RemoveFileHandler(c)) {
 		assert.Equal(t, http.StatusOK, rec.Code)
 	}
-}
\ No newline at end of file
+}
+
+func TestGetFileStatsHandler(t *testing.T) {
+	e := echo.New()
+	q := make(url.Values)
+	q.Set("filePath", "../data/text_files/text2.txt")
+	q.Set("queryTarget", "totalBytes")
+	req := httptest.NewRequest(http.MethodGet, "/file/stats?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if assert.NoError(t, GetFileStatsHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"totalBytesCount":160`)
+	}
+}
+
+func TestGetFileLanguageHandler(t *testing.T) {
+	e := echo.New()
+	q := make(url.Values)
+	q.Set("filePath", "../data/text_files/text1.txt")
+	req := httptest.NewRequest(http.MethodGet, "/file/language?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if assert.NoError(t, GetFileLanguageHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"language":"english"`)
+	}
+}
@@ -1,28 +1,56 @@
 package handlers
 
 import (
+	"../auth"
 	"../utils"
 	"fmt"
 	"github.com/labstack/echo"
 	"github.com/labstack/gommon/log"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 )
 
-// QueryTarget
+// QueryTarget, given either as its number or as its name
 //
-//·0      Total number of files in that folder.
-//·1      Average number of alphanumeric characters per text file (and standard deviation) in that folder.
-//·2      Average word length (and standard deviation) in that folder.
-//·3      Total number of bytes stored in that folder.
+//·0      fileCount        Total number of files in that folder.
+//·1      alphaChars       Average number of alphanumeric characters per text file (and standard deviation) in that folder.
+//·2      wordLength       Average word length (and standard deviation) in that folder.
+//·3      totalBytes       Total number of bytes stored in that folder.
+//·4      wordFrequency    Word frequency and vocabulary analysis of that folder.
+//·5      readability      Readability scores per text file (and their average) in that folder.
 const (
 	fileNumber                           = 0
 	averageNumberOfAlphaCharsPerTextFile = 1
 	averageWordLengthPerTextFile         = 2
 	totalNumberOfBytes                   = 3
+	wordFrequency                        = 4
+	readability                          = 5
 )
 
+var queryTargetNames = map[string]int{
+	"fileCount":     fileNumber,
+	"alphaChars":    averageNumberOfAlphaCharsPerTextFile,
+	"wordLength":    averageWordLengthPerTextFile,
+	"totalBytes":    totalNumberOfBytes,
+	"wordFrequency": wordFrequency,
+	"readability":   readability,
+}
+
+// folderStats is the response of every folder statistic, skipped holds the number of entries
+// left out by the walker for each reason and reported the ones worth listing individually
+type folderStats struct {
+	Message  string             `json:"message"`
+	Result   interface{}        `json:"result"`
+	Skipped  map[string]int     `json:"skipped,omitempty"`
+	Reported []utils.WalkReport `json:"reported,omitempty"`
+}
+
+// Number of distinct words counted exactly before the word frequency analysis
+// switches to an approximate count with bounded memory
+const maxExactWords = 100000
+
 
 func GetFolderStatsHandler(c echo.Context) error {
 	entryPoint := c.QueryParam("entryPoint")
@@ -34,94 +62,291 @@ func GetFolderStatsHandler(c echo.Context) error {
 			"Parameter 'entryPoint' or 'queryTarget' cannot be null.")
 	}
 
-	// Ensure the existence of file
-	if _, err := os.Stat(entryPoint); err != nil {
-		log.Warnf("Entry point '%s' doesn't exists.", entryPoint)
-		return echo.NewHTTPError(http.StatusConflict,
-			"Entry point '%s' doesn't exist.", entryPoint)
+	if err := authorize(c, auth.RightStats, entryPoint); err != nil {
+		return err
+	}
+	if err := checkEntryPoint(entryPoint); err != nil {
+		return err
 	}
 
-	// Get the status of the directory
-	fi, err := os.Stat(entryPoint)
+	// Ensure the value of queryTarget is valid
+	queryNumber, err := parseQueryTarget(queryTarget)
 	if err != nil {
-		log.Fatalf("Failed to get stats of entryPoint: %s, error: %v", entryPoint, err)
-		return echo.NewHTTPError(http.StatusInternalServerError,
-			"Currently unable to get stats of entry point '%s'.", entryPoint)
+		return err
 	}
 
-	// Ensure it's a directory
-	if !fi.Mode().IsDir() {
-		log.Warnf("EntryPoint '%s' is not directory", entryPoint)
-		return echo.NewHTTPError(http.StatusBadRequest,
-			"Entry point '%s' is not a directory", entryPoint)
+	// Get all the files first
+	walkResult, err := listEntryPoint(c, auth.RightStats, entryPoint)
+	if err != nil {
+		return err
 	}
 
-	// Ensure the value of queryTarget is valid
-	queryNumber, err := strconv.Atoi(queryTarget)
+	// Response might be different according to the value of queryTarget,
+	// and is broken down if requested
+	var response folderStats
+	if groupBy := c.QueryParam("groupBy"); groupBy != "" {
+		response, err = computeGroupedStats(c, groupBy, queryNumber, entryPoint, walkResult.FilePaths,
+			walkResult.FileInfos)
+	} else {
+		response, err = computeStats(c, queryNumber, entryPoint, walkResult.FilePaths, walkResult.FileInfos)
+	}
 	if err != nil {
-		log.Warnf("Failed to convert '%s' to number", queryTarget)
-		return echo.NewHTTPError(http.StatusBadRequest,
-			"Invalid value, parameter 'queryTarget' expect a int from 0 ~ 3, got %s", queryTarget)
+		return err
 	}
+	response.Skipped = walkResult.Skipped
+	response.Reported = walkResult.Reported
+	return c.JSON(http.StatusOK, &response)
+}
 
-	// Get all the files first
-	filePaths, err := utils.GetAllFilePathsFromEntryPoint(entryPoint)
+// listEntryPoint lists the files under the entry point selected by the walker parameters,
+// on which the caller has the right
+func listEntryPoint(c echo.Context, right string, entryPoint string) (utils.WalkResult, error) {
+	options, err := getWalkOptions(c)
+	if err != nil {
+		return utils.WalkResult{}, err
+	}
+	walkResult, err := walkEntryPoint(entryPoint, options)
 	if err != nil {
-		log.Fatalf("Error occurred while listing file from the entry point: %s, error: %v",
-			entryPoint, err)
-		return echo.NewHTTPError(http.StatusInternalServerError,
-			"Failed to list the filePaths from the entry point: %s", entryPoint)
+		return walkResult, err
 	}
+	return authorizeWalk(c, right, walkResult), nil
+}
 
-	// Response might be different according to the value of queryTarget
-	var response interface{}
+// getWalkOptions returns the walker options from the parameters
+//
+//·include       Glob patterns a file must match, any file if none.
+//·exclude       Glob patterns of the files and directories to leave out.
+//·ignoreFile    Name of the .gitignore-style files to honour, e.g. ".gitignore".
+//·maxDepth      Maximum number of directories between the entry point and a file.
+//·maxFileSize   Maximum size of a file in bytes.
+//·hidden        Whether the files and directories starting with a dot are included, true by default.
+//·skipBinary    Whether the files that don't look like text are left out, true by default.
+//·symlinks      Whether symbolic links are followed, skipped or reported: 'follow' (default), 'skip' or 'report'.
+func getWalkOptions(c echo.Context) (utils.WalkOptions, error) {
+	var err error
+	options := utils.DefaultWalkOptions()
+	options.Include = listQueryParam(c, "include")
+	options.Exclude = listQueryParam(c, "exclude")
+	options.IgnoreFileName = requestParams(c).Get("ignoreFile")
+
+	for _, pattern := range append(options.Include, options.Exclude...) {
+		if _, err := utils.CompileGlob(pattern); err != nil {
+			return options, echo.NewHTTPError(http.StatusBadRequest,
+				fmt.Sprintf("Invalid glob pattern: %s", pattern))
+		}
+	}
+	if requestParams(c).Get("maxDepth") != "" {
+		if options.MaxDepth, err = intQueryParam(c, "maxDepth", -1); err != nil {
+			return options, err
+		}
+	}
+	maxFileSize, err := intQueryParam(c, "maxFileSize", 0)
+	if err != nil {
+		return options, err
+	}
+	options.MaxFileSize = int64(maxFileSize)
+	if options.IncludeHidden, err = boolQueryParam(c, "hidden", true); err != nil {
+		return options, err
+	}
+	if options.SkipBinary, err = boolQueryParam(c, "skipBinary", true); err != nil {
+		return options, err
+	}
+	switch symlinks := requestParams(c).Get("symlinks"); symlinks {
+	case "", utils.SymlinkFollow, utils.SymlinkSkip, utils.SymlinkReport:
+		options.Symlinks = symlinks
+	default:
+		return options, echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Invalid value, parameter 'symlinks' expect 'follow', 'skip' or 'report', got %s", symlinks))
+	}
+	return options, nil
+}
+
+func walkEntryPoint(entryPoint string, options utils.WalkOptions) (utils.WalkResult, error) {
+	walkResult, err := utils.WalkEntryPoint(entryPoint, options)
+	if err != nil {
+		log.Errorf("Error occurred while listing file from the entry point: %s, error: %v", entryPoint, err)
+		return walkResult, echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("Failed to list the filePaths from the entry point: %s", entryPoint))
+	}
+	return walkResult, nil
+}
+
+// parseQueryTarget converts the number or the name of a query target to its number
+func parseQueryTarget(queryTarget string) (int, error) {
+	if queryNumber, ok := queryTargetNames[queryTarget]; ok {
+		return queryNumber, nil
+	}
 
+	queryNumber, err := strconv.Atoi(queryTarget)
+	if err != nil || queryNumber < fileNumber || queryNumber > readability {
+		log.Warnf("Got invalid value from parameter 'queryTarget', got %s", queryTarget)
+		return 0, echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Invalid value, parameter 'queryTarget' expect a int from 0 ~ 5 or a metric name, got %s",
+				queryTarget))
+	}
+	return queryNumber, nil
+}
+
+// computeStats computes the statistics selected by queryNumber over the given files, along with their status
+func computeStats(c echo.Context, queryNumber int, entryPoint string, filePaths []string,
+	fileInfos []os.FileInfo) (folderStats, error) {
 	switch queryNumber {
 	case fileNumber:
-		response, err = CountFilesFromEntryPoint(entryPoint, filePaths)
-		if err != nil {
-			return err
-		}
+		return CountFilesFromEntryPoint(entryPoint, filePaths)
 	case averageNumberOfAlphaCharsPerTextFile:
-		response, err = CountAverageNumberOfAlphaCharsPerTextFile(entryPoint, filePaths)
-		if err != nil {
-			return err
-		}
+		return CountAverageNumberOfAlphaCharsPerTextFile(entryPoint, filePaths)
 	case averageWordLengthPerTextFile:
-		response, err = CountAverageWordLengthPerTextFile(entryPoint, filePaths)
+		return CountAverageWordLengthPerTextFile(entryPoint, filePaths)
+	case totalNumberOfBytes:
+		return CountTotalNumberOfBytes(entryPoint, filePaths, fileInfos)
+	case wordFrequency:
+		return CountWordFrequency(c, entryPoint, filePaths)
+	case readability:
+		return CountReadabilityPerTextFile(entryPoint, filePaths)
+	default:
+		return folderStats{}, echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Invalid value, parameter 'queryTarget' expect a int from 0 ~ 5, got %d", queryNumber))
+	}
+}
+
+// computeGroupedStats splits the files into groups and computes the statistics of each group
+//
+// GroupBy
+//
+//·language      Language detected from the content of each file.
+//·subdirectory  Immediate subdirectory of the entry point, "." for the files directly in it.
+//·extension     Lower case file extension, "(none)" for the files without one.
+//·depth         Number of directories between the entry point and each file.
+//·mtime         Day, week or month each file was last modified in, selected by 'mtimeBucket'.
+func computeGroupedStats(c echo.Context, groupBy string, queryNumber int, entryPoint string,
+	filePaths []string, fileInfos []os.FileInfo) (folderStats, error) {
+	var groupOf func(filePath string, fi os.FileInfo) (string, error)
+
+	switch groupBy {
+	case "language":
+		groupOf = func(filePath string, fi os.FileInfo) (string, error) {
+			guess, err := utils.DetectFileLanguage(filePath)
+			return guess.Language, err
+		}
+	case "subdirectory":
+		groupOf = func(filePath string, fi os.FileInfo) (string, error) {
+			return utils.SubdirectoryOf(entryPoint, filePath)
+		}
+	case "extension":
+		groupOf = func(filePath string, fi os.FileInfo) (string, error) {
+			return utils.ExtensionOf(filePath), nil
+		}
+	case "depth":
+		groupOf = func(filePath string, fi os.FileInfo) (string, error) {
+			depth, err := utils.DepthOf(entryPoint, filePath)
+			return strconv.Itoa(depth), err
+		}
+	case "mtime":
+		bucket := c.QueryParam("mtimeBucket")
+		if bucket == "" {
+			bucket = "day"
+		}
+		if bucket != "day" && bucket != "week" && bucket != "month" {
+			return folderStats{}, echo.NewHTTPError(http.StatusBadRequest,
+				fmt.Sprintf("Invalid value, parameter 'mtimeBucket' expect 'day', 'week' or 'month', got %s", bucket))
+		}
+		groupOf = func(filePath string, fi os.FileInfo) (string, error) {
+			return utils.TimeBucket(fi.ModTime(), bucket)
+		}
+	default:
+		return folderStats{}, echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Invalid value, parameter 'groupBy' expect 'language', 'subdirectory', 'extension', "+
+				"'depth' or 'mtime', got %s", groupBy))
+	}
+
+	groupFilePaths := make(map[string][]string)
+	groupFileInfos := make(map[string][]os.FileInfo)
+	for i, filePath := range filePaths {
+		group, err := groupOf(filePath, fileInfos[i])
 		if err != nil {
-			return err
+			log.Errorf("Error occurred while grouping file: %s by %s, error: %v", filePath, groupBy, err)
+			return folderStats{}, echo.NewHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("Failed to group the files by %s from the entry point: %s", groupBy, entryPoint))
 		}
-	case totalNumberOfBytes:
-		response, err = CountTotalNumberOfBytes(entryPoint, filePaths)
+		groupFilePaths[group] = append(groupFilePaths[group], filePath)
+		groupFileInfos[group] = append(groupFileInfos[group], fileInfos[i])
+	}
+
+	// Groups are sorted by name, or by number for the depth, so the response is stable
+	groupNames := make([]string, 0, len(groupFilePaths))
+	for group := range groupFilePaths {
+		groupNames = append(groupNames, group)
+	}
+	sort.Slice(groupNames, func(i, j int) bool {
+		if groupBy == "depth" {
+			depthI, _ := strconv.Atoi(groupNames[i])
+			depthJ, _ := strconv.Atoi(groupNames[j])
+			return depthI < depthJ
+		}
+		return groupNames[i] < groupNames[j]
+	})
+
+	type folderStatsGroup struct {
+		Group     string      `json:"group"`
+		FileCount int         `json:"fileCount"`
+		Stats     interface{} `json:"stats"`
+	}
+
+	type groupedStatsResult struct {
+		GroupBy string             `json:"groupBy"`
+		Groups  []folderStatsGroup `json:"groups"`
+	}
+
+	result := groupedStatsResult{GroupBy: groupBy, Groups: make([]folderStatsGroup, 0, len(groupNames))}
+	for _, group := range groupNames {
+		stats, err := computeStats(c, queryNumber, entryPoint, groupFilePaths[group], groupFileInfos[group])
 		if err != nil {
-			return err
+			return folderStats{}, err
 		}
-	default:
-		log.Warnf("Got invalid value from parameter 'queryTarget', got %s", queryTarget)
-		return echo.NewHTTPError(http.StatusBadRequest,
-			"Invalid value, parameter 'queryTarget' expect a int from 0 ~ 3, got %s", queryTarget)
+		result.Groups = append(result.Groups, folderStatsGroup{
+			Group:     group,
+			FileCount: len(groupFilePaths[group]),
+			Stats:     stats.Result,
+		})
 	}
 
-	return c.JSON(http.StatusOK, &response)
+	var response folderStats
+	response.Result = result
+	response.Message = fmt.Sprintf("Successfully calculate the statistics grouped by %s from the entry point: %s",
+		groupBy, entryPoint)
+	return response, nil
 }
 
-func CountFilesFromEntryPoint(entryPoint string, filePaths []string) (interface{}, error) {
-	fileCount := len(filePaths)
+// checkEntryPoint ensures the entry point exists and is a directory
+func checkEntryPoint(entryPoint string) error {
+	// Get the status of the directory
+	fi, err := os.Stat(entryPoint)
+	if err != nil {
+		log.Warnf("Entry point '%s' doesn't exists.", entryPoint)
+		return echo.NewHTTPError(http.StatusConflict,
+			fmt.Sprintf("Entry point '%s' doesn't exist.", entryPoint))
+	}
 
-	var response struct {
-		Message string			`json:"message"`
-		Result  map[string]int	`json:"result"`
+	// Ensure it's a directory
+	if !fi.Mode().IsDir() {
+		log.Warnf("EntryPoint '%s' is not directory", entryPoint)
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Entry point '%s' is not a directory", entryPoint))
 	}
+	return nil
+}
+
+func CountFilesFromEntryPoint(entryPoint string, filePaths []string) (folderStats, error) {
+	fileCount := len(filePaths)
 
+	var response folderStats
 	response.Message = fmt.Sprintf("Successfully calculate the number of file from the entry point: %s.",
 		entryPoint)
-	response.Result = make(map[string]int)
-	response.Result["fileCount"] = fileCount
+	response.Result = map[string]int{"fileCount": fileCount}
 	return response, nil
 }
 
-func CountAverageNumberOfAlphaCharsPerTextFile(entryPoint string, filePaths []string) (interface{}, error) {
+func CountAverageNumberOfAlphaCharsPerTextFile(entryPoint string, filePaths []string) (folderStats, error) {
 	// Get number of alpha chars per file
 	fileAlphaCharsCountMap := make(map[string]int)
 	totalFileAlphaCharsCount := 0
@@ -131,7 +356,7 @@ func CountAverageNumberOfAlphaCharsPerTextFile(entryPoint string, filePaths []st
 	for _, filePath := range filePaths {
 		alphaCharsNumber, err = utils.CountFileAlphaChars(filePath)
 		if err != nil {
-			return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			return folderStats{}, echo.NewHTTPError(http.StatusInternalServerError,
 				"Failed to count the alpha characters in file: %s, error: %v", filePath, err)
 		}
 		fileAlphaCharsCountMap[filePath] = alphaCharsNumber
@@ -147,12 +372,8 @@ func CountAverageNumberOfAlphaCharsPerTextFile(entryPoint string, filePaths []st
 		StandardDeviation float32		  `json:"standardDeviation"`
 	}
 
-	var response struct {
-		Result  fileAlphaCharsCountResult  `json:"result"`
-		Message string					   `json:"message"`
-	}
-
 	// Response
+	var response folderStats
 	response.Message = fmt.Sprintf("Calculate the number of alphanumeric characters successfully from the entry point: %s",
 		entryPoint)
 	response.Result = fileAlphaCharsCountResult{
@@ -161,17 +382,18 @@ func CountAverageNumberOfAlphaCharsPerTextFile(entryPoint string, filePaths []st
 	return response, nil
 }
 
-func CountAverageWordLengthPerTextFile(entryPoint string, filePaths []string) (interface{}, error) {
+func CountAverageWordLengthPerTextFile(entryPoint string, filePaths []string) (folderStats, error) {
 	fileAverageWordLengthMap := make(map[string]float32)
 	var totalFileAverageWordLength float32
 
 	for _, filePath := range filePaths {
 		fileAverageWordLength, err := utils.CountFileAverageWordLength(filePath)
 		if err != nil {
-			log.Fatalf("Error occurred while calculating the average word length in file: %s, error: %v",
+			log.Errorf("Error occurred while calculating the average word length in file: %s, error: %v",
 				filePath, err)
-			return nil, echo.NewHTTPError(http.StatusInternalServerError,
-				"Failed to count the average world length per text file from the entry point: %s", entryPoint)
+			return folderStats{}, echo.NewHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("Failed to count the average world length per text file from the entry point: %s",
+					entryPoint))
 		}
 		fileAverageWordLengthMap[filePath] = fileAverageWordLength
 		totalFileAverageWordLength += fileAverageWordLength
@@ -187,11 +409,7 @@ func CountAverageWordLengthPerTextFile(entryPoint string, filePaths []string) (i
 		StandardDeviation float32			  `json:"standardDeviation"`
 	}
 
-	var response struct {
-		Result  fileAverageWordLengthResult  `json:"result"`
-		Message string						 `json:"message"`
-	}
-
+	var response folderStats
 	response.Message = fmt.Sprintf(
 		"Successfully calculate the average word length per text file from the entry point: %s",
 		entryPoint)
@@ -201,41 +419,125 @@ func CountAverageWordLengthPerTextFile(entryPoint string, filePaths []string) (i
 	return response, nil
 }
 
-func CountTotalNumberOfBytes(entryPoint string, filePaths []string) (interface{}, error) {
-	// Get file size (number of bytes) of each file
-	fileSizeMap := make(map[string]int64)
-	var totalNumberOfBytes int64
+func CountTotalNumberOfBytes(entryPoint string, filePaths []string, fileInfos []os.FileInfo) (folderStats, error) {
+	// Get file size (number of bytes) of each file from its status read by the walk, the content
+	// of a compressed file is larger than what it takes on disk
+	var totalNumberOfBytes, physicalNumberOfBytes int64
 
-	for _, filePath := range filePaths {
-		file, err := os.Open(filePath)
+	for i, filePath := range filePaths {
+		fi := fileInfos[i]
+		size, err := utils.ContentSize(filePath, fi)
 		if err != nil {
-			log.Fatalf("Failed to open the file: %s, error: %v", filePath, err)
-			return nil, echo.NewHTTPError(http.StatusInternalServerError,
-				"Failed to read the file from the entry point: %s", entryPoint)
+			log.Errorf("Error occurred while getting the content size of file: %s, error: %v", filePath, err)
+			return folderStats{}, echo.NewHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("Failed to count the total bytes from the entry point: %s", entryPoint))
 		}
+		totalNumberOfBytes += size
+		physicalNumberOfBytes += fi.Size()
+	}
 
-		fi, err := file.Stat()
+	// Response
+	type totalNumberOfBytesResult struct {
+		TotalBytesCount    int64	`json:"totalBytesCount"`
+		PhysicalBytesCount int64	`json:"physicalBytesCount"`
+	}
+
+	var response folderStats
+	response.Message = fmt.Sprintf("Successfully to calculate the total number of bytes from the entry point: %s",
+		entryPoint)
+	response.Result = totalNumberOfBytesResult{
+		TotalBytesCount:    totalNumberOfBytes,
+		PhysicalBytesCount: physicalNumberOfBytes}
+	return response, nil
+}
+
+func CountWordFrequency(c echo.Context, entryPoint string, filePaths []string) (folderStats, error) {
+	// Get the analysis options, case folding is enabled unless specified
+	topN, err := intQueryParam(c, "topN", 10)
+	if err != nil {
+		return folderStats{}, err
+	}
+	caseFolding, err := boolQueryParam(c, "caseFolding", true)
+	if err != nil {
+		return folderStats{}, err
+	}
+	minWordLength, err := intQueryParam(c, "minWordLength", 0)
+	if err != nil {
+		return folderStats{}, err
+	}
+
+	options := utils.WordOptions{CaseFolding: caseFolding, MinWordLength: minWordLength}
+	options.Stopwords = utils.ParseStopwords(c.QueryParam("stopwords"))
+
+	// Count the words of every file
+	counter := utils.NewWordCounter(topN, maxExactWords)
+	for _, filePath := range filePaths {
+		if err := counter.AddFile(filePath, options); err != nil {
+			log.Errorf("Error occurred while counting the words in file: %s, error: %v", filePath, err)
+			return folderStats{}, echo.NewHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("Failed to count the word frequency from the entry point: %s", entryPoint))
+		}
+	}
+
+	// Response
+	var response folderStats
+	response.Message = fmt.Sprintf("Successfully calculate the word frequency from the entry point: %s",
+		entryPoint)
+	response.Result = counter.Stats()
+	return response, nil
+}
+
+
+func CountReadabilityPerTextFile(entryPoint string, filePaths []string) (folderStats, error) {
+	fileReadabilityMap := make(map[string]utils.ReadabilityStats)
+	var average utils.ReadabilityStats
+
+	for _, filePath := range filePaths {
+		stats, err := utils.CountFileReadability(filePath)
 		if err != nil {
-			log.Fatalf("Error occurred while getting stats of file: %s, error: %v", filePath, err)
-			return nil, echo.NewHTTPError(http.StatusInternalServerError,
-				"Failed to count the total bytes from the entry point: %s", entryPoint)
+			log.Errorf("Error occurred while calculating the readability of file: %s, error: %v", filePath, err)
+			return folderStats{}, echo.NewHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("Failed to calculate the readability per text file from the entry point: %s", entryPoint))
 		}
-		fileSizeMap[filePath] = fi.Size()
-		totalNumberOfBytes += fi.Size()
+		fileReadabilityMap[filePath] = stats
+		average.FleschReadingEase += stats.FleschReadingEase
+		average.FleschKincaidGrade += stats.FleschKincaidGrade
+		average.GunningFog += stats.GunningFog
+		average.SMOGIndex += stats.SMOGIndex
+	}
+
+	// Calculate the average of every score
+	if fileCount := float64(len(filePaths)); fileCount > 0 {
+		average.FleschReadingEase /= fileCount
+		average.FleschKincaidGrade /= fileCount
+		average.GunningFog /= fileCount
+		average.SMOGIndex /= fileCount
 	}
 
 	// Response
-	type totalNumberOfBytesResult struct {
-		TotalBytesCount int64	`json:"totalBytesCount"`
+	type readabilityScores struct {
+		FleschReadingEase  float64 `json:"fleschReadingEase"`
+		FleschKincaidGrade float64 `json:"fleschKincaidGrade"`
+		GunningFog         float64 `json:"gunningFog"`
+		SMOGIndex          float64 `json:"smogIndex"`
 	}
 
-	var response struct {
-		Result  totalNumberOfBytesResult  `json:"result"`
-		Message string                    `json:"message"`
+	type readabilityResult struct {
+		FileStats map[string]utils.ReadabilityStats `json:"fileStats"`
+		Average   readabilityScores                 `json:"average"`
 	}
 
-	response.Message = fmt.Sprintf("Successfully to calculate the total number of bytes from the entry point: %s",
+	var response folderStats
+	response.Message = fmt.Sprintf("Successfully calculate the readability per text file from the entry point: %s",
 		entryPoint)
-	response.Result = totalNumberOfBytesResult{TotalBytesCount: totalNumberOfBytes}
+	response.Result = readabilityResult{
+		FileStats: fileReadabilityMap,
+		Average: readabilityScores{
+			FleschReadingEase:  average.FleschReadingEase,
+			FleschKincaidGrade: average.FleschKincaidGrade,
+			GunningFog:         average.GunningFog,
+			SMOGIndex:          average.SMOGIndex,
+		},
+	}
 	return response, nil
-}
\ No newline at end of file
+}
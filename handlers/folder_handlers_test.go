@@ -1,13 +1,18 @@
 package handlers
 
 import (
+	"../utils"
 	"encoding/json"
+	"fmt"
 	"github.com/labstack/echo"
 	"github.com/labstack/gommon/log"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -125,5 +130,214 @@ func TestCountTotalNumberOfBytes(t *testing.T) {
 			log.Fatalf("Failed to parse as json, error: %v", err)
 		}
 		assert.Equal(t, int64(1407), response.Result["totalBytesCount"])
+		assert.Equal(t, int64(1407), response.Result["physicalBytesCount"])
 	}
-}
\ No newline at end of file
+}
+
+func TestCountTotalNumberOfBytesOfRemovedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handlers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "a.txt")
+	assert.NoError(t, ioutil.WriteFile(filePath, []byte("Hello"), 0644))
+	fi, err := os.Stat(filePath)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The sizes come from the walk, a file removed since then is still counted
+	assert.NoError(t, os.Remove(filePath))
+	response, err := CountTotalNumberOfBytes(dir, []string{filePath}, []os.FileInfo{fi})
+	if assert.NoError(t, err) {
+		assert.Contains(t, fmt.Sprintf("%+v", response.Result), "TotalBytesCount:5")
+	}
+}
+
+func TestCountWordFrequency(t *testing.T) {
+	e := echo.New()
+	q := make(url.Values)
+	q.Set("entryPoint", "../data")
+	q.Set("queryTarget", "4")
+	q.Set("topN", "2")
+	q.Set("stopwords", "english")
+	q.Set("minWordLength", "4")
+	req := httptest.NewRequest(http.MethodGet, "/file?"+q.Encode(), nil)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if assert.NoError(t, GetFolderStatsHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response struct {
+			Result  utils.WordFrequencyStats `json:"result"`
+			Message string                   `json:"message"`
+		}
+
+		err := json.Unmarshal([]byte(strings.TrimSpace(rec.Body.String())), &response)
+		if err != nil {
+			log.Fatalf("Failed to parse as json, error: %v", err)
+		}
+		assert.Equal(t, 2, len(response.Result.TopWords))
+		assert.False(t, response.Result.Approximate)
+		assert.True(t, response.Result.VocabularySize > response.Result.HapaxCount)
+	}
+}
+
+func TestCountReadabilityPerTextFile(t *testing.T) {
+	e := echo.New()
+	q := make(url.Values)
+	q.Set("entryPoint", "../data")
+	q.Set("queryTarget", "readability")
+	req := httptest.NewRequest(http.MethodGet, "/folder?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if assert.NoError(t, GetFolderStatsHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response struct {
+			Result struct {
+				FileStats map[string]utils.ReadabilityStats `json:"fileStats"`
+				Average   utils.ReadabilityStats            `json:"average"`
+			} `json:"result"`
+			Message string `json:"message"`
+		}
+
+		err := json.Unmarshal([]byte(strings.TrimSpace(rec.Body.String())), &response)
+		if err != nil {
+			log.Fatalf("Failed to parse as json, error: %v", err)
+		}
+		assert.Equal(t, 2, len(response.Result.FileStats))
+		assert.True(t, response.Result.Average.FleschKincaidGrade > 0)
+	}
+}
+
+func TestGetFolderStatsHandlerInvalidQueryTarget(t *testing.T) {
+	e := echo.New()
+	q := make(url.Values)
+	q.Set("entryPoint", "../data")
+	q.Set("queryTarget", "unknown")
+	req := httptest.NewRequest(http.MethodGet, "/folder?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	err := GetFolderStatsHandler(c)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	}
+}
+
+func TestGetFolderStatsHandlerGroupByLanguage(t *testing.T) {
+	e := echo.New()
+	q := make(url.Values)
+	q.Set("entryPoint", "../data")
+	q.Set("queryTarget", "fileCount")
+	q.Set("groupBy", "language")
+	req := httptest.NewRequest(http.MethodGet, "/folder?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if assert.NoError(t, GetFolderStatsHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response struct {
+			Result struct {
+				GroupBy string `json:"groupBy"`
+				Groups  []struct {
+					Group     string `json:"group"`
+					FileCount int    `json:"fileCount"`
+				} `json:"groups"`
+			} `json:"result"`
+		}
+
+		err := json.Unmarshal([]byte(strings.TrimSpace(rec.Body.String())), &response)
+		if err != nil {
+			log.Fatalf("Failed to parse as json, error: %v", err)
+		}
+		if assert.Equal(t, 1, len(response.Result.Groups)) {
+			assert.Equal(t, "english", response.Result.Groups[0].Group)
+			assert.Equal(t, 2, response.Result.Groups[0].FileCount)
+		}
+	}
+}
+
+func TestGetFolderStatsHandlerGroupByDepth(t *testing.T) {
+	e := echo.New()
+	q := make(url.Values)
+	q.Set("entryPoint", "../data")
+	q.Set("queryTarget", "totalBytes")
+	q.Set("groupBy", "depth")
+	req := httptest.NewRequest(http.MethodGet, "/folder?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if assert.NoError(t, GetFolderStatsHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response struct {
+			Result struct {
+				Groups []struct {
+					Group     string `json:"group"`
+					FileCount int    `json:"fileCount"`
+					Stats     map[string]int64 `json:"stats"`
+				} `json:"groups"`
+			} `json:"result"`
+		}
+
+		err := json.Unmarshal([]byte(strings.TrimSpace(rec.Body.String())), &response)
+		if err != nil {
+			log.Fatalf("Failed to parse as json, error: %v", err)
+		}
+		if assert.Equal(t, 1, len(response.Result.Groups)) {
+			assert.Equal(t, "1", response.Result.Groups[0].Group)
+			assert.Equal(t, int64(1407), response.Result.Groups[0].Stats["totalBytesCount"])
+		}
+	}
+}
+
+func TestGetFolderStatsHandlerInvalidGroupBy(t *testing.T) {
+	e := echo.New()
+	q := make(url.Values)
+	q.Set("entryPoint", "../data")
+	q.Set("queryTarget", "fileCount")
+	q.Set("groupBy", "mtime")
+	q.Set("mtimeBucket", "year")
+	req := httptest.NewRequest(http.MethodGet, "/folder?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	err := GetFolderStatsHandler(c)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	}
+}
+
+func TestGetFolderStatsHandlerExclude(t *testing.T) {
+	e := echo.New()
+	q := make(url.Values)
+	q.Set("entryPoint", "../data")
+	q.Set("queryTarget", "fileCount")
+	q.Set("exclude", "text2.*")
+	req := httptest.NewRequest(http.MethodGet, "/folder?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if assert.NoError(t, GetFolderStatsHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response struct {
+			Result  map[string]int `json:"result"`
+			Skipped map[string]int `json:"skipped"`
+		}
+
+		err := json.Unmarshal([]byte(strings.TrimSpace(rec.Body.String())), &response)
+		if err != nil {
+			log.Fatalf("Failed to parse as json, error: %v", err)
+		}
+		assert.Equal(t, 1, response.Result["fileCount"])
+		assert.Equal(t, map[string]int{"excluded": 1}, response.Skipped)
+	}
+}
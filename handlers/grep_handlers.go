@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"../auth"
+	"../utils"
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+)
+
+const (
+	// Longest pattern accepted, RE2 runs in linear time but compiling huge patterns is expensive
+	maxGrepPatternLength = 1000
+	maxGrepContext       = 10
+	maxGrepTimeout       = time.Minute
+	// Reasons a grep stopped before the end
+	grepMaxMatches = "maxMatches"
+	grepMaxFiles   = "maxFiles"
+	grepTimeout    = "timeout"
+	grepCancelled  = "cancelled"
+	grepFailed     = "failed"
+	// Reason reported for the files that couldn't be searched
+	grepUnreadable = "unreadable"
+)
+
+// The lines of the grep response are matches followed by a summary, told apart by their type
+type grepMatchLine struct {
+	Type string `json:"type"`
+	utils.GrepMatch
+}
+
+type grepSummary struct {
+	Type          string             `json:"type"`
+	Matches       int                `json:"matches"`
+	FilesSearched int                `json:"filesSearched"`
+	FilesMatched  int                `json:"filesMatched"`
+	Truncated     string             `json:"truncated,omitempty"`
+	Skipped       map[string]int     `json:"skipped,omitempty"`
+	Reported      []utils.WalkReport `json:"reported,omitempty"`
+}
+
+// GetFolderGrepHandler streams the lines matching a RE2 regexp in the files under the entry point
+// as newline delimited JSON, one match per line followed by a summary.
+//
+//·pattern     RE2 regexp, see https://github.com/google/re2/wiki/Syntax.
+//·ignoreCase  Whether the case is ignored, false by default.
+//·context     Number of lines reported before and after every match, 0 by default.
+//·maxMatches  Maximum number of matches, 1000 by default.
+//·maxFiles    Maximum number of files searched, 10000 by default.
+//·timeout     Maximum duration of the search, 10s by default and 1m at most.
+//
+// The search stops when a limit is reached or the client goes away, the summary tells why.
+func GetFolderGrepHandler(c echo.Context) error {
+	entryPoint := c.QueryParam("entryPoint")
+	pattern := c.QueryParam("pattern")
+
+	// Ensure parameters are not null
+	if entryPoint == "" || pattern == "" {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			"Parameter 'entryPoint' or 'pattern' cannot be null.")
+	}
+	if err := authorize(c, auth.RightRead, entryPoint); err != nil {
+		return err
+	}
+	if err := checkEntryPoint(entryPoint); err != nil {
+		return err
+	}
+
+	ignoreCase, err := boolQueryParam(c, "ignoreCase", false)
+	if err != nil {
+		return err
+	}
+	if len(pattern) > maxGrepPatternLength {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Pattern is longer than %d bytes.", maxGrepPatternLength))
+	}
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Invalid pattern: %v", err))
+	}
+
+	var options utils.GrepOptions
+	if options.Context, err = intQueryParam(c, "context", 0); err != nil {
+		return err
+	}
+	if options.Context > maxGrepContext {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Invalid value, parameter 'context' expect at most %d lines", maxGrepContext))
+	}
+	maxMatches, err := intQueryParam(c, "maxMatches", 1000)
+	if err != nil {
+		return err
+	}
+	maxFiles, err := intQueryParam(c, "maxFiles", 10000)
+	if err != nil {
+		return err
+	}
+	timeout, err := durationQueryParam(c, "timeout", 10*time.Second, maxGrepTimeout)
+	if err != nil {
+		return err
+	}
+	options.Deadline = time.Now().Add(timeout)
+	walkOptions, err := getWalkOptions(c)
+	if err != nil {
+		return err
+	}
+
+	// Stream the matches as they are found
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+	response.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(response)
+	done := c.Request().Context().Done()
+
+	// The files are searched while walking, so the limits bound the walk too
+	summary := grepSummary{Type: "summary"}
+	var unreadable []utils.WalkReport
+	denied := 0
+	allow := allowed(c, auth.RightRead)
+	walkOptions.Deadline = options.Deadline
+	walkOptions.Done = done
+	walkOptions.Visit = func(filePath string, fi os.FileInfo) error {
+		if allow != nil && !allow(filePath) {
+			denied++
+			return nil
+		}
+		if summary.FilesSearched == maxFiles {
+			summary.Truncated = grepMaxFiles
+			return utils.ErrStopWalk
+		}
+		summary.FilesSearched++
+
+		matched := false
+		err := utils.GrepFile(filePath, re, options, func(match utils.GrepMatch) bool {
+			select {
+			case <-done:
+				summary.Truncated = grepCancelled
+				return false
+			default:
+			}
+			if summary.Matches == maxMatches {
+				summary.Truncated = grepMaxMatches
+				return false
+			}
+
+			summary.Matches++
+			matched = true
+			if err := encoder.Encode(grepMatchLine{Type: "match", GrepMatch: match}); err != nil {
+				summary.Truncated = grepCancelled
+				return false
+			}
+			response.Flush()
+			return true
+		})
+		if matched {
+			summary.FilesMatched++
+		}
+		if err == utils.ErrDeadline {
+			summary.Truncated = grepTimeout
+		} else if err != nil {
+			log.Errorf("Error occurred while searching file %s, error: %v", filePath, err)
+			unreadable = append(unreadable, utils.WalkReport{Path: filePath, Reason: grepUnreadable, Detail: err.Error()})
+		}
+		if summary.Truncated != "" {
+			return utils.ErrStopWalk
+		}
+		return nil
+	}
+
+	walkResult, err := utils.WalkEntryPoint(entryPoint, walkOptions)
+	switch err {
+	case nil:
+	case utils.ErrDeadline:
+		summary.Truncated = grepTimeout
+	case utils.ErrCancelled:
+		summary.Truncated = grepCancelled
+	default:
+		// The response has started, the failure can only be told by the summary
+		log.Errorf("Error occurred while listing file from the entry point: %s, error: %v", entryPoint, err)
+		summary.Truncated = grepFailed
+	}
+	summary.Skipped = walkResult.Skipped
+	if denied > 0 {
+		summary.Skipped[skippedDenied] += denied
+	}
+	summary.Reported = append(walkResult.Reported, unreadable...)
+
+	return encoder.Encode(&summary)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// grepLines runs a grep and returns the decoded lines of the response
+func grepLines(t *testing.T, q url.Values) []map[string]interface{} {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/folder/grep?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	var lines []map[string]interface{}
+	if assert.NoError(t, GetFolderGrepHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/x-ndjson", rec.Header().Get(echo.HeaderContentType))
+
+		scanner := bufio.NewScanner(rec.Body)
+		scanner.Buffer(nil, 1024*1024)
+		for scanner.Scan() {
+			var line map[string]interface{}
+			assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestGetFolderGrepHandler(t *testing.T) {
+	q := make(url.Values)
+	q.Set("entryPoint", "../data")
+	q.Set("pattern", `FREE \w+`)
+	q.Set("ignoreCase", "true")
+
+	lines := grepLines(t, q)
+	if assert.Equal(t, 3, len(lines)) {
+		assert.Equal(t, "match", lines[0]["type"])
+		assert.Equal(t, float64(1), lines[0]["line"])
+		summary := lines[2]
+		assert.Equal(t, "summary", summary["type"])
+		assert.Equal(t, float64(2), summary["matches"])
+		assert.Equal(t, float64(2), summary["filesMatched"])
+		assert.Nil(t, summary["truncated"])
+	}
+
+	q.Set("maxMatches", "1")
+	lines = grepLines(t, q)
+	if assert.Equal(t, 2, len(lines)) {
+		assert.Equal(t, "maxMatches", lines[1]["truncated"])
+	}
+}
+
+func TestGetFolderGrepHandlerMaxFiles(t *testing.T) {
+	q := make(url.Values)
+	q.Set("entryPoint", "../data")
+	q.Set("pattern", `\w`)
+	q.Set("maxFiles", "1")
+	q.Set("maxMatches", "100000")
+
+	lines := grepLines(t, q)
+	if assert.NotEmpty(t, lines) {
+		summary := lines[len(lines)-1]
+		assert.Equal(t, "summary", summary["type"])
+		assert.Equal(t, float64(1), summary["filesSearched"])
+		assert.Equal(t, "maxFiles", summary["truncated"])
+	}
+}
+
+func TestGetFolderGrepHandlerInvalidPattern(t *testing.T) {
+	e := echo.New()
+	q := make(url.Values)
+	q.Set("entryPoint", "../data")
+	q.Set("pattern", `(a`)
+	req := httptest.NewRequest(http.MethodGet, "/folder/grep?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	err := GetFolderGrepHandler(c)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	}
+}
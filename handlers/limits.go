@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"../auth"
+	"fmt"
+	"github.com/labstack/echo"
+	"golang.org/x/time/rate"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxContentSize is the maximum size of the content of a file written, unlimited if zero
+var MaxContentSize int64
+
+// The idle clients are forgotten this often
+const rateSweepInterval = time.Minute
+
+var ratePeriods = map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+
+// RateLimiter gives every client a token bucket, a request takes a token and the tokens come back
+// at a constant rate up to the burst. A nil RateLimiter doesn't limit anything.
+type RateLimiter struct {
+	limit   rate.Limit
+	burst   int
+	mu      sync.Mutex
+	clients map[string]*rateClient
+	swept   time.Time
+	now     func() time.Time
+}
+
+type rateClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewRateLimiter returns a rate limiter for a rate such as "10/s", "600/m" or "1000/h", followed by
+// the burst if it isn't the number of requests of the period, e.g. "600/m:20". It's nil if the rate is empty.
+func NewRateLimiter(spec string) (*RateLimiter, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	invalid := fmt.Errorf("invalid rate %s, expect <requests>/<s|m|h>[:<burst>]", spec)
+	rateSpec, burstSpec := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		rateSpec, burstSpec = spec[:i], spec[i+1:]
+	}
+	parts := strings.Split(rateSpec, "/")
+	if len(parts) != 2 {
+		return nil, invalid
+	}
+	requests, err := strconv.Atoi(parts[0])
+	period, ok := ratePeriods[parts[1]]
+	if err != nil || requests <= 0 || !ok {
+		return nil, invalid
+	}
+	burst := requests
+	if burstSpec != "" {
+		if burst, err = strconv.Atoi(burstSpec); err != nil || burst <= 0 {
+			return nil, invalid
+		}
+	}
+	return &RateLimiter{
+		limit:   rate.Limit(float64(requests) / period.Seconds()),
+		burst:   burst,
+		clients: make(map[string]*rateClient),
+		now:     time.Now,
+	}, nil
+}
+
+// allow takes a token from the bucket of a client, or tells how long it has to wait for one
+func (l *RateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+
+	// A client whose bucket is full again is as good as new
+	if now.Sub(l.swept) >= rateSweepInterval {
+		refill := time.Duration(float64(l.burst) / float64(l.limit) * float64(time.Second))
+		for k, client := range l.clients {
+			if now.Sub(client.lastSeen) > refill {
+				delete(l.clients, k)
+			}
+		}
+		l.swept = now
+	}
+
+	client, ok := l.clients[key]
+	if !ok {
+		client = &rateClient{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[key] = client
+	}
+	client.lastSeen = now
+	reservation := client.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// Limit returns the middleware rejecting the requests of the clients out of tokens with 429 and the number
+// of seconds to wait in Retry-After. The key identifies the client of a request, it isn't limited if empty.
+func (l *RateLimiter) Limit(key func(c echo.Context) string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if l == nil {
+				return next(c)
+			}
+			k := key(c)
+			if k == "" {
+				return next(c)
+			}
+			if ok, delay := l.allow(k); !ok {
+				seconds := int(math.Ceil(delay.Seconds()))
+				c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+				return echo.NewHTTPError(http.StatusTooManyRequests,
+					fmt.Sprintf("Too many requests, retry in %d seconds.", seconds))
+			}
+			return next(c)
+		}
+	}
+}
+
+// ClientIP identifies a client by the address it's connected from. The X-Forwarded-For and X-Real-IP
+// headers aren't trusted, a client could pick a new key on every request with them.
+func ClientIP(c echo.Context) string {
+	host, _, err := net.SplitHostPort(c.Request().RemoteAddr)
+	if err != nil {
+		return c.Request().RemoteAddr
+	}
+	return host
+}
+
+// ClientPrincipal identifies a client by its subject, e.g. its API key, the anonymous clients have none
+func ClientPrincipal(c echo.Context) string {
+	if principal := auth.PrincipalOf(c); principal != nil {
+		return principal.Subject
+	}
+	return ""
+}
+
+// ClientPrincipalOrIP identifies a client by its subject, or by its address if it's anonymous
+func ClientPrincipalOrIP(c echo.Context) string {
+	if subject := ClientPrincipal(c); subject != "" {
+		return subject
+	}
+	return ClientIP(c)
+}
+
+// LimitRequestBody returns the middleware rejecting the requests whose body is larger than maxBytes with 413,
+// once decompressed if it's after DecodeRequestBody. The forms are read right away, so that a form too large
+// isn't seen as an empty form by the handlers.
+func LimitRequestBody(maxBytes int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.ContentLength > maxBytes {
+				return bodyTooLarge(maxBytes)
+			}
+			req.Body = http.MaxBytesReader(c.Response(), req.Body, maxBytes)
+
+			if strings.HasPrefix(req.Header.Get(echo.HeaderContentType), echo.MIMEApplicationForm) {
+				if err := req.ParseForm(); err != nil {
+					if _, ok := err.(*http.MaxBytesError); ok {
+						return bodyTooLarge(maxBytes)
+					}
+					return echo.NewHTTPError(http.StatusBadRequest,
+						fmt.Sprintf("Invalid form: %v", err))
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+func bodyTooLarge(maxBytes int64) error {
+	return echo.NewHTTPError(http.StatusRequestEntityTooLarge,
+		fmt.Sprintf("The body of the request is larger than %d bytes.", maxBytes))
+}
+
+// checkContentSize ensures the content written to a file isn't larger than MaxContentSize
+func checkContentSize(filePath string, size int64) error {
+	if MaxContentSize > 0 && size > MaxContentSize {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("Content of file '%s' is larger than %d bytes.", filePath, MaxContentSize))
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewRateLimiter(t *testing.T) {
+	limiter, err := NewRateLimiter("")
+	assert.NoError(t, err)
+	assert.Nil(t, limiter)
+
+	limiter, err = NewRateLimiter("600/m:20")
+	if assert.NoError(t, err) {
+		assert.InDelta(t, 10, float64(limiter.limit), 0.001)
+		assert.Equal(t, 20, limiter.burst)
+	}
+	limiter, err = NewRateLimiter("5/h")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 5, limiter.burst)
+	}
+
+	for _, invalid := range []string{"10", "10/d", "0/s", "-1/s", "ten/s", "10/s:0", "10/s:x", "10/s/m"} {
+		_, err := NewRateLimiter(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRateLimiterLimit(t *testing.T) {
+	limiter, err := NewRateLimiter("1/s:2")
+	if !assert.NoError(t, err) {
+		return
+	}
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	handler := limiter.Limit(ClientIP)(func(c echo.Context) error {
+		return c.String(http.StatusOK, "pong")
+	})
+
+	e := echo.New()
+	request := func(remoteAddr string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.RemoteAddr = remoteAddr
+		// Forwarding headers can't be used to pick a new key
+		req.Header.Set(echo.HeaderXForwardedFor, time.Now().String())
+		rec := httptest.NewRecorder()
+		return rec, handler(e.NewContext(req, rec))
+	}
+
+	// The burst, then a token a second
+	for i := 0; i < 2; i++ {
+		_, err := request("192.0.2.1:1234")
+		assert.NoError(t, err)
+	}
+	rec, err := request("192.0.2.1:5678")
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusTooManyRequests, err.(*echo.HTTPError).Code)
+		assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	}
+	_, err = request("192.0.2.2:1234")
+	assert.NoError(t, err)
+
+	now = now.Add(time.Second)
+	_, err = request("192.0.2.1:1234")
+	assert.NoError(t, err)
+	_, err = request("192.0.2.1:1234")
+	assert.Error(t, err)
+
+	// The idle clients are forgotten once their bucket is full again
+	now = now.Add(rateSweepInterval)
+	_, err = request("192.0.2.3:1234")
+	assert.NoError(t, err)
+	assert.Len(t, limiter.clients, 1)
+
+	// A nil limiter doesn't limit anything
+	var disabled *RateLimiter
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	rec = httptest.NewRecorder()
+	assert.NoError(t, disabled.Limit(ClientIP)(func(c echo.Context) error {
+		return c.String(http.StatusOK, "pong")
+	})(e.NewContext(req, rec)))
+}
+
+func TestLimitRequestBody(t *testing.T) {
+	handler := LimitRequestBody(16)(func(c echo.Context) error {
+		return c.String(http.StatusOK, c.FormValue("content"))
+	})
+	e := echo.New()
+
+	f := make(url.Values)
+	f.Set("content", "Hello")
+	req := httptest.NewRequest(http.MethodPost, "/file", strings.NewReader(f.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	if assert.NoError(t, handler(e.NewContext(req, rec))) {
+		assert.Equal(t, "Hello", rec.Body.String())
+	}
+
+	f.Set("content", "Hello, World!")
+	req = httptest.NewRequest(http.MethodPost, "/file", strings.NewReader(f.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec = httptest.NewRecorder()
+	err := handler(e.NewContext(req, rec))
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusRequestEntityTooLarge, err.(*echo.HTTPError).Code)
+	}
+
+	// The length of a decompressed body isn't known
+	req = httptest.NewRequest(http.MethodPost, "/file", strings.NewReader(f.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	err = handler(e.NewContext(req, rec))
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusRequestEntityTooLarge, err.(*echo.HTTPError).Code)
+	}
+}
+
+func TestMaxContentSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handlers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	MaxContentSize = 8
+	defer func() { MaxContentSize = 0 }()
+
+	e := echo.New()
+	f := make(url.Values)
+	f.Set("filePath", filepath.Join(dir, "a.txt"))
+	f.Set("content", "Hello, World!")
+	req := httptest.NewRequest(http.MethodPost, "/file", strings.NewReader(f.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	err = CreateNewFileHandler(e.NewContext(req, rec))
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusRequestEntityTooLarge, err.(*echo.HTTPError).Code)
+	}
+
+	batch := `[{"op": "create", "filePath": "` + filepath.Join(dir, "b.txt") + `", "content": "Hello, World!"}]`
+	req = httptest.NewRequest(http.MethodPost, "/file/batch", strings.NewReader(batch))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	if assert.NoError(t, BatchFileOperationsHandler(e.NewContext(req, rec))) {
+		assert.Contains(t, rec.Body.String(), "larger than 8 bytes")
+	}
+	_, err = os.Stat(filepath.Join(dir, "b.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
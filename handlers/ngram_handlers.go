@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"../auth"
+	"../utils"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"net/http"
+	"os"
+)
+
+// Options shared by the file and folder n-gram endpoints
+type ngramOptions struct {
+	n            int
+	minFrequency int
+	topN         int
+	caseFolding  bool
+	scorePMI     bool
+}
+
+func getNGramOptions(c echo.Context) (ngramOptions, error) {
+	var options ngramOptions
+	var err error
+
+	if options.n, err = intQueryParam(c, "n", 2); err != nil {
+		return options, err
+	}
+	if options.n != 2 && options.n != 3 {
+		return options, echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Invalid value, parameter 'n' expect 2 or 3, got %d", options.n))
+	}
+	if options.minFrequency, err = intQueryParam(c, "minFrequency", 2); err != nil {
+		return options, err
+	}
+	if options.topN, err = intQueryParam(c, "topN", 10); err != nil {
+		return options, err
+	}
+	if options.caseFolding, err = boolQueryParam(c, "caseFolding", true); err != nil {
+		return options, err
+	}
+
+	switch scoring := c.QueryParam("scoring"); scoring {
+	case "", "frequency":
+		options.scorePMI = false
+	case "pmi":
+		options.scorePMI = true
+	default:
+		return options, echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Invalid value, parameter 'scoring' expect 'frequency' or 'pmi', got %s", scoring))
+	}
+	return options, nil
+}
+
+func GetFileNGramsHandler(c echo.Context) error {
+	filePath := c.QueryParam("filePath")
+
+	// Ensure parameter is not null
+	if filePath == "" {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			"Parameter 'filePath' cannot be null.")
+	}
+
+	if err := authorize(c, auth.RightStats, filePath); err != nil {
+		return err
+	}
+
+	// Ensure the existence of file
+	if _, err := os.Stat(filePath); err != nil {
+		message := fmt.Sprintf("File '%s' doesn't exist.", filePath)
+		return echo.NewHTTPError(http.StatusBadRequest, message)
+	}
+
+	options, err := getNGramOptions(c)
+	if err != nil {
+		return err
+	}
+
+	counter := utils.NewNGramCounter(options.n, options.caseFolding)
+	if err := counter.AddFile(filePath); err != nil {
+		log.Errorf("Error occurred while counting the n-grams in file: %s, error: %v", filePath, err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("Failed to count the n-grams in file: %s", filePath))
+	}
+
+	// Response
+	type fileNGramsResult struct {
+		NGrams []utils.NGram `json:"ngrams"`
+	}
+
+	var response struct {
+		Message string           `json:"message"`
+		Result  fileNGramsResult `json:"result"`
+	}
+	response.Message = fmt.Sprintf("Successfully calculate the most common %d-grams in file: %s",
+		options.n, filePath)
+	response.Result = fileNGramsResult{NGrams: counter.Top(options.minFrequency, options.topN, options.scorePMI)}
+	return c.JSON(http.StatusOK, &response)
+}
+
+func GetFolderNGramsHandler(c echo.Context) error {
+	entryPoint := c.QueryParam("entryPoint")
+
+	// Ensure parameter is not null
+	if entryPoint == "" {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			"Parameter 'entryPoint' cannot be null.")
+	}
+
+	if err := authorize(c, auth.RightStats, entryPoint); err != nil {
+		return err
+	}
+	if err := checkEntryPoint(entryPoint); err != nil {
+		return err
+	}
+
+	options, err := getNGramOptions(c)
+	if err != nil {
+		return err
+	}
+	perFile, err := boolQueryParam(c, "perFile", false)
+	if err != nil {
+		return err
+	}
+
+	walkResult, err := listEntryPoint(c, auth.RightStats, entryPoint)
+	if err != nil {
+		return err
+	}
+	filePaths := walkResult.FilePaths
+
+	// Count the n-grams of the whole folder, and of each file if requested
+	folderCounter := utils.NewNGramCounter(options.n, options.caseFolding)
+	fileNGramsMap := make(map[string][]utils.NGram)
+	for _, filePath := range filePaths {
+		if err := folderCounter.AddFile(filePath); err != nil {
+			log.Errorf("Error occurred while counting the n-grams in file: %s, error: %v", filePath, err)
+			return echo.NewHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("Failed to count the n-grams from the entry point: %s", entryPoint))
+		}
+
+		if perFile {
+			fileCounter := utils.NewNGramCounter(options.n, options.caseFolding)
+			if err := fileCounter.AddFile(filePath); err != nil {
+				log.Errorf("Error occurred while counting the n-grams in file: %s, error: %v", filePath, err)
+				return echo.NewHTTPError(http.StatusInternalServerError,
+					fmt.Sprintf("Failed to count the n-grams from the entry point: %s", entryPoint))
+			}
+			fileNGramsMap[filePath] = fileCounter.Top(options.minFrequency, options.topN, options.scorePMI)
+		}
+	}
+
+	// Response
+	type folderNGramsResult struct {
+		NGrams    []utils.NGram            `json:"ngrams"`
+		FileStats map[string][]utils.NGram `json:"fileStats,omitempty"`
+	}
+
+	var response struct {
+		Message  string             `json:"message"`
+		Result   folderNGramsResult `json:"result"`
+		Skipped  map[string]int     `json:"skipped,omitempty"`
+		Reported []utils.WalkReport `json:"reported,omitempty"`
+	}
+	response.Message = fmt.Sprintf("Successfully calculate the most common %d-grams from the entry point: %s",
+		options.n, entryPoint)
+	response.Result = folderNGramsResult{
+		NGrams:    folderCounter.Top(options.minFrequency, options.topN, options.scorePMI),
+		FileStats: fileNGramsMap,
+	}
+	response.Skipped = walkResult.Skipped
+	response.Reported = walkResult.Reported
+	return c.JSON(http.StatusOK, &response)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"../utils"
+	"encoding/json"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGetFileNGramsHandler(t *testing.T) {
+	e := echo.New()
+	q := make(url.Values)
+	q.Set("filePath", "../data/text_files/text2.txt")
+	q.Set("n", "2")
+	req := httptest.NewRequest(http.MethodGet, "/file/ngrams?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if assert.NoError(t, GetFileNGramsHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response struct {
+			Message string `json:"message"`
+			Result  struct {
+				NGrams []utils.NGram `json:"ngrams"`
+			} `json:"result"`
+		}
+
+		err := json.Unmarshal([]byte(strings.TrimSpace(rec.Body.String())), &response)
+		if err != nil {
+			log.Fatalf("Failed to parse as json, error: %v", err)
+		}
+		assert.Equal(t, []utils.NGram{{Words: []string{"free", "sms"}, Count: 2}}, response.Result.NGrams)
+	}
+}
+
+func TestGetFolderNGramsHandler(t *testing.T) {
+	e := echo.New()
+	q := make(url.Values)
+	q.Set("entryPoint", "../data")
+	q.Set("scoring", "pmi")
+	q.Set("perFile", "true")
+	req := httptest.NewRequest(http.MethodGet, "/folder/ngrams?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if assert.NoError(t, GetFolderNGramsHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response struct {
+			Message string `json:"message"`
+			Result  struct {
+				NGrams    []utils.NGram            `json:"ngrams"`
+				FileStats map[string][]utils.NGram `json:"fileStats"`
+			} `json:"result"`
+		}
+
+		err := json.Unmarshal([]byte(strings.TrimSpace(rec.Body.String())), &response)
+		if err != nil {
+			log.Fatalf("Failed to parse as json, error: %v", err)
+		}
+		assert.NotEmpty(t, response.Result.NGrams)
+		assert.Equal(t, 2, len(response.Result.FileStats))
+	}
+}
+
+func TestGetFolderNGramsHandlerInvalidN(t *testing.T) {
+	e := echo.New()
+	q := make(url.Values)
+	q.Set("entryPoint", "../data")
+	q.Set("n", "5")
+	req := httptest.NewRequest(http.MethodGet, "/folder/ngrams?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	err := GetFolderNGramsHandler(c)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	}
+}
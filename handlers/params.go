@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/labstack/echo"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// requestParams returns the parameters of the query, and of the body of a URL-encoded form which take precedence,
+// like FormValue does. The multipart bodies are left unread for the handlers streaming them.
+func requestParams(c echo.Context) url.Values {
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEApplicationForm) {
+		if params, err := c.FormParams(); err == nil {
+			return params
+		}
+	}
+	return c.QueryParams()
+}
+
+// intQueryParam returns the value of an optional non-negative int parameter
+func intQueryParam(c echo.Context, name string, defaultValue int) (int, error) {
+	value := requestParams(c).Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Invalid value, parameter '%s' expect a non-negative int, got %s", name, value))
+	}
+	return number, nil
+}
+
+// boolQueryParam returns the value of an optional bool parameter
+func boolQueryParam(c echo.Context, name string, defaultValue bool) (bool, error) {
+	value := requestParams(c).Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Invalid value, parameter '%s' expect a bool, got %s", name, value))
+	}
+	return b, nil
+}
+
+// floatQueryParam returns the value of an optional float parameter within [min, max]
+func floatQueryParam(c echo.Context, name string, defaultValue float64, min float64, max float64) (float64, error) {
+	value := requestParams(c).Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < min || number > max {
+		return 0, echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Invalid value, parameter '%s' expect a number from %v ~ %v, got %s", name, min, max, value))
+	}
+	return number, nil
+}
+
+// durationQueryParam returns the value of an optional duration parameter within (0, max], e.g. "500ms"
+func durationQueryParam(c echo.Context, name string, defaultValue time.Duration, max time.Duration) (time.Duration, error) {
+	value := requestParams(c).Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 || duration > max {
+		return 0, echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Invalid value, parameter '%s' expect a duration up to %v, got %s", name, max, value))
+	}
+	return duration, nil
+}
+
+// listQueryParam returns the values of a parameter given several times or as a comma separated list
+func listQueryParam(c echo.Context, name string) []string {
+	var values []string
+	for _, param := range requestParams(c)[name] {
+		for _, value := range strings.Split(param, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// timeQueryParam returns the time of an RFC 3339 parameter, the zero time if it's missing
+func timeQueryParam(c echo.Context, name string) (time.Time, error) {
+	value := requestParams(c).Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Invalid value, parameter '%s' expect an RFC 3339 time, got %s", name, value))
+	}
+	return t, nil
+}
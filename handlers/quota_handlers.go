@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"../auth"
+	"../storage"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"net/http"
+)
+
+// Quotas limits the content written by the principals and under the folders, nothing is limited if it's nil
+var Quotas *storage.Quotas
+
+// writeWithinQuota writes a file with the write function unless it would exceed a quota of the caller or of
+// a folder of the file, the quota errors are HTTP errors: 413 if the content alone is larger than the quota,
+// 507 if the quota has not enough room left for it
+func writeWithinQuota(c echo.Context, filePath string, size int64, write func() error) error {
+	return applyWithinQuota(c, []storage.QuotaChange{{FilePath: filePath, Size: size}}, write)
+}
+
+// moveWithinQuota moves a file with the move function unless the destination has no room left for it,
+// the size of the content of the source is only needed if it isn't counted yet
+func moveWithinQuota(c echo.Context, sourcePath string, destinationPath string, size int64, move func() error) error {
+	return applyWithinQuota(c, []storage.QuotaChange{{FilePath: destinationPath, SourcePath: sourcePath, Size: size}}, move)
+}
+
+// applyWithinQuota makes the changes of the caller with the apply function unless they would exceed a quota,
+// the quota errors are those of writeWithinQuota
+func applyWithinQuota(c echo.Context, changes []storage.QuotaChange, apply func() error) error {
+	if Quotas == nil {
+		return apply()
+	}
+	changes = callerChanges(c, changes)
+	return quotaHTTPError(changes, Quotas.Apply(changes, apply))
+}
+
+// checkQuota returns the error applyWithinQuota would return if the changes exceeded a quota
+func checkQuota(c echo.Context, changes []storage.QuotaChange) error {
+	if Quotas == nil {
+		return nil
+	}
+	changes = callerChanges(c, changes)
+	return quotaHTTPError(changes, Quotas.Check(changes))
+}
+
+// callerChanges returns the changes made by the caller of the request
+func callerChanges(c echo.Context, changes []storage.QuotaChange) []storage.QuotaChange {
+	var owner string
+	if principal := auth.PrincipalOf(c); principal != nil {
+		owner = principal.Subject
+	}
+	changes = append([]storage.QuotaChange{}, changes...)
+	for i := range changes {
+		changes[i].Owner = owner
+	}
+	return changes
+}
+
+// quotaHTTPError converts the quota errors of the changes to HTTP errors
+func quotaHTTPError(changes []storage.QuotaChange, err error) error {
+	switch err := err.(type) {
+	case *storage.QuotaError:
+		status := http.StatusInsufficientStorage
+		if err.TooLarge() {
+			status = http.StatusRequestEntityTooLarge
+		}
+		return echo.NewHTTPError(status, fmt.Sprintf("Failed to write file '%s', %v.", changes[err.Change].FilePath, err))
+	case *storage.LedgerError:
+		// The files are written, their owners will be missing from the ledger until their next write
+		log.Errorf("The files have been written, error: %v", err)
+		return nil
+	}
+	return err
+}
+
+// forgetQuota stops counting a removed file in the quotas
+func forgetQuota(filePath string) {
+	if Quotas == nil {
+		return
+	}
+	if err := Quotas.Forget(filePath); err != nil {
+		log.Errorf("The file %s has been removed, error: %v", filePath, err)
+	}
+}
+
+// errorMessage returns the message of an error, without the status code of the HTTP errors
+func errorMessage(err error) string {
+	if httpErr, ok := err.(*echo.HTTPError); ok {
+		return fmt.Sprint(httpErr.Message)
+	}
+	return err.Error()
+}
+
+// GetQuotaUsageHandler returns the quotas with their usage. The callers other than the storage admins
+// only get their own quotas and the ones of the folders they can read.
+//
+//·principal  Only the quotas of this principal, "me" for the caller of the request.
+func GetQuotaUsageHandler(c echo.Context) error {
+	if Quotas == nil {
+		return echo.NewHTTPError(http.StatusConflict,
+			"The quotas aren't enabled.")
+	}
+	principal := c.QueryParam("principal")
+	if principal == "me" {
+		caller := auth.PrincipalOf(c)
+		if caller == nil {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				"The caller of the request isn't authenticated.")
+		}
+		principal = caller.Subject
+	}
+
+	// Response
+	var response struct {
+		Message string               `json:"Message"`
+		Result  []storage.QuotaUsage `json:"Result"`
+	}
+	response.Message = "Retrieved successfully."
+	response.Result = Quotas.Usage(principal)
+	if caller := auth.PrincipalOf(c); caller != nil && !caller.HasScope(auth.ScopeStorageAdmin) {
+		canRead := allowed(c, auth.RightRead)
+		visible := []storage.QuotaUsage{}
+		for _, usage := range response.Result {
+			if usage.Principal == caller.Subject || (usage.Path != "" && (canRead == nil || canRead(usage.Path))) {
+				visible = append(visible, usage)
+			}
+		}
+		response.Result = visible
+	}
+	return c.JSON(http.StatusOK, &response)
+}
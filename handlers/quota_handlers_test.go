@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"../auth"
+	"../storage"
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQuotaHandlersWithoutQuotas(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/storage/quotas", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	err := GetQuotaUsageHandler(c)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+	}
+}
+
+func TestGetQuotaUsageHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handlers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	team, other := filepath.Join(dir, "team"), filepath.Join(dir, "other")
+
+	quotaFile := filepath.Join(dir, "quotas.json")
+	assert.NoError(t, ioutil.WriteFile(quotaFile, []byte(`{"quotas": [
+		{"principal": "alice", "maxBytes": 10}, {"principal": "bob", "maxBytes": 10},
+		{"path": "`+team+`", "maxFiles": 5}, {"path": "`+other+`", "maxFiles": 5}
+	]}`), 0600))
+	quotas, err := storage.LoadQuotas(quotaFile, Store)
+	if !assert.NoError(t, err) {
+		return
+	}
+	Quotas = quotas
+	defer func() { Quotas = nil }()
+	defer withPolicy(t, dir,
+		auth.Rule{Principal: "alice", Path: team, Rights: []string{auth.RightRead}, Effect: auth.EffectAllow},
+	)()
+
+	usage := func(principal *auth.Principal, query string) []storage.QuotaUsage {
+		req := httptest.NewRequest(http.MethodGet, "/storage/quotas?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.Set(auth.PrincipalKey, principal)
+		var response struct {
+			Result []storage.QuotaUsage `json:"Result"`
+		}
+		if assert.NoError(t, GetQuotaUsageHandler(c)) {
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		}
+		return response.Result
+	}
+	quotaNames := func(usages []storage.QuotaUsage) []string {
+		names := []string{}
+		for _, usage := range usages {
+			if usage.Principal != "" {
+				names = append(names, usage.Principal)
+			} else {
+				names = append(names, filepath.Base(usage.Path))
+			}
+		}
+		return names
+	}
+
+	// The admins see every quota, the other callers their own and the ones of the folders they can read
+	admin := &auth.Principal{Subject: "admin", Scopes: []string{auth.ScopeStorageAdmin}}
+	assert.Equal(t, []string{"alice", "bob", "team", "other"}, quotaNames(usage(admin, "")))
+	alice := &auth.Principal{Subject: "alice", Scopes: []string{auth.ScopeFoldersStats}}
+	assert.Equal(t, []string{"alice", "team"}, quotaNames(usage(alice, "")))
+	assert.Equal(t, []string{"alice"}, quotaNames(usage(alice, "principal=me")))
+	assert.Equal(t, []string{}, quotaNames(usage(alice, "principal=bob")))
+}
+
+func TestQuotasEnforcedByFileHandlers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handlers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	quotaFile := filepath.Join(dir, "quotas.json")
+	assert.NoError(t, ioutil.WriteFile(quotaFile, []byte(`{"quotas": [{"principal": "alice", "maxBytes": 10}]}`), 0600))
+	quotas, err := storage.LoadQuotas(quotaFile, Store)
+	if !assert.NoError(t, err) {
+		return
+	}
+	Quotas = quotas
+	defer func() { Quotas = nil }()
+	alice := &auth.Principal{Subject: "alice"}
+
+	e := echo.New()
+	for _, write := range []struct {
+		fileName string
+		content  string
+		status   int
+	}{
+		{"a.txt", "Hello, World!", http.StatusRequestEntityTooLarge},
+		{"a.txt", "Hello", http.StatusCreated},
+		{"b.txt", "World!", http.StatusInsufficientStorage},
+		{"b.txt", "World", http.StatusCreated},
+	} {
+		f := make(url.Values)
+		f.Set("filePath", filepath.Join(dir, write.fileName))
+		f.Set("content", write.content)
+		req := httptest.NewRequest(http.MethodPost, "/file", strings.NewReader(f.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set(auth.PrincipalKey, alice)
+		err := CreateNewFileHandler(c)
+		if write.status == http.StatusCreated {
+			if assert.NoError(t, err) {
+				assert.Equal(t, write.status, rec.Code)
+			}
+		} else if assert.Error(t, err) {
+			assert.Equal(t, write.status, err.(*echo.HTTPError).Code)
+		}
+	}
+
+	// Removing a file gives its room back
+	f := make(url.Values)
+	f.Set("filePath", filepath.Join(dir, "b.txt"))
+	req := httptest.NewRequest(http.MethodPost, "/file", strings.NewReader(f.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	assert.NoError(t, RemoveFileHandler(c))
+
+	f = make(url.Values)
+	f.Set("filePath", filepath.Join(dir, "a.txt"))
+	f.Set("content", "Hello!!!!!")
+	req = httptest.NewRequest(http.MethodPut, "/file", strings.NewReader(f.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.Set(auth.PrincipalKey, alice)
+	assert.NoError(t, ReplaceFileContentHandler(c))
+
+	req = httptest.NewRequest(http.MethodGet, "/storage/quotas?principal=me", nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.Set(auth.PrincipalKey, alice)
+	if assert.NoError(t, GetQuotaUsageHandler(c)) {
+		var response struct {
+			Result []storage.QuotaUsage `json:"Result"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		if assert.Len(t, response.Result, 1) {
+			assert.Equal(t, storage.Usage{Bytes: 10, Files: 1}, response.Result[0].Usage)
+		}
+	}
+}
+
+func TestQuotasEnforcedByBatchAndArchiveHandlers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handlers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	team := filepath.Join(dir, "team")
+	assert.NoError(t, os.Mkdir(team, 0755))
+
+	quotaFile := filepath.Join(dir, "quotas.json")
+	assert.NoError(t, ioutil.WriteFile(quotaFile, []byte(`{"quotas": [{"path": "`+team+`", "maxBytes": 10}]}`), 0600))
+	quotas, err := storage.LoadQuotas(quotaFile, Store)
+	if !assert.NoError(t, err) {
+		return
+	}
+	Quotas = quotas
+	defer func() { Quotas = nil }()
+	usage := func() storage.Usage {
+		return Quotas.Usage("")[0].Usage
+	}
+	a, b := filepath.Join(team, "a.txt"), filepath.Join(team, "b.txt")
+	creates := fmt.Sprintf(`[
+		{"op": "create", "filePath": %q, "content": "Hello"},
+		{"op": "create", "filePath": %q, "content": "World!"}
+	]`, a, b)
+
+	// An atomic batch exceeding the quota isn't applied at all
+	req := httptest.NewRequest(http.MethodPost, "/file/batch", strings.NewReader(creates))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	err = BatchFileOperationsHandler(echo.New().NewContext(req, httptest.NewRecorder()))
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusInsufficientStorage, err.(*echo.HTTPError).Code)
+	}
+	assert.Empty(t, listDir(team))
+	assert.Equal(t, storage.Usage{}, usage())
+
+	// A best effort batch applies the operations within the quota
+	result := runBatch(t, batchBestEffort, echo.MIMEApplicationJSON, creates, http.StatusOK)
+	assert.Equal(t, batchDone, result.Operations[0].Status)
+	if assert.Equal(t, batchFailed, result.Operations[1].Status) {
+		assert.Contains(t, result.Operations[1].Error, "Failed to write file")
+	}
+	assert.Equal(t, storage.Usage{Bytes: 5, Files: 1}, usage())
+
+	// The deleted files give their room back, the moved ones are counted under their new folder
+	outside := filepath.Join(dir, "outside.txt")
+	body := fmt.Sprintf(`[
+		{"op": "move", "filePath": %q, "destinationPath": %q},
+		{"op": "create", "filePath": %q, "content": "World!"}
+	]`, a, outside, b)
+	runBatch(t, batchAtomic, echo.MIMEApplicationJSON, body, http.StatusOK)
+	assert.Equal(t, storage.Usage{Bytes: 6, Files: 1}, usage())
+	body = fmt.Sprintf(`[
+		{"op": "delete", "filePath": %q},
+		{"op": "move", "filePath": %q, "destinationPath": %q}
+	]`, b, outside, a)
+	runBatch(t, batchBestEffort, echo.MIMEApplicationJSON, body, http.StatusOK)
+	assert.Equal(t, storage.Usage{Bytes: 5, Files: 1}, usage())
+
+	// An archive is only extracted if the quota has room for all of its files
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range []string{"c.txt", "d.txt"} {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Size: 3, Mode: 0644}))
+		tw.Write([]byte("abc"))
+	}
+	assert.NoError(t, tw.Close())
+	_, err = uploadArchive(team, buf.Bytes(), false)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusInsufficientStorage, err.(*echo.HTTPError).Code)
+	}
+	assert.Equal(t, []string{"a.txt"}, listDir(team))
+	assert.NoError(t, os.Remove(a))
+	assert.NoError(t, Quotas.Forget(a))
+	rec, err := uploadArchive(team, buf.Bytes(), false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	}
+	assert.Equal(t, storage.Usage{Bytes: 6, Files: 2}, usage())
+}
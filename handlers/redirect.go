@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"github.com/labstack/echo"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RedirectToHTTPS redirects every request to the same URL on the HTTPS server listening on the address.
+// The redirect is permanent and keeps the method and the body, unlike a 301 which clients may follow with a GET.
+func RedirectToHTTPS(httpsAddr string) echo.HandlerFunc {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return func(c echo.Context) error {
+		host := c.Request().Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		if host == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "Missing host.")
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		return c.Redirect(http.StatusPermanentRedirect, "https://"+host+c.Request().RequestURI)
+	}
+}
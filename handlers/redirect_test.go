@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectToHTTPS(t *testing.T) {
+	e := echo.New()
+	for _, test := range []struct {
+		httpsAddr string
+		host      string
+		location  string
+	}{
+		{":1323", "example.com", "https://example.com:1323/file?filePath=a.txt"},
+		{":1323", "example.com:8080", "https://example.com:1323/file?filePath=a.txt"},
+		{":443", "example.com:80", "https://example.com/file?filePath=a.txt"},
+		{"127.0.0.1:8443", "[::1]:8080", "https://[::1]:8443/file?filePath=a.txt"},
+		{":443", "[::1]", "https://[::1]/file?filePath=a.txt"},
+	} {
+		req := httptest.NewRequest(http.MethodPut, "/file?filePath=a.txt", nil)
+		req.Host = test.host
+		rec := httptest.NewRecorder()
+		if assert.NoError(t, RedirectToHTTPS(test.httpsAddr)(e.NewContext(req, rec))) {
+			assert.Equal(t, http.StatusPermanentRedirect, rec.Code)
+			assert.Equal(t, test.location, rec.Header().Get(echo.HeaderLocation))
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.Host = ""
+	rec := httptest.NewRecorder()
+	err := RedirectToHTTPS(":443")(e.NewContext(req, rec))
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	}
+}
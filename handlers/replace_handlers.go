@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"../audit"
+	"../auth"
+	"../utils"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"net/http"
+	"regexp"
+)
+
+// Status of a file after a search-and-replace
+const (
+	replacePreviewed = "previewed"
+	replaceReplaced  = "replaced"
+	replaceFailed    = "failed"
+)
+
+// Number of context lines of the diffs previewed
+const replaceDiffContext = 3
+
+type fileReplacement struct {
+	FilePath     string `json:"filePath"`
+	Replacements int    `json:"replacements"`
+	Status       string `json:"status"`
+	Diff         string `json:"diff,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+type replaceResult struct {
+	DryRun       bool              `json:"dryRun"`
+	FilesChanged int               `json:"filesChanged"`
+	Replacements int               `json:"replacements"`
+	Failures     int               `json:"failures"`
+	Files        []fileReplacement `json:"files"`
+}
+
+// ReplaceInFolderHandler replaces a pattern in every file under the entry point selected by the walker
+// parameters. By default it's a dry run returning the diff of every file that would change, the files
+// are only written with dryRun=false, each of them is replaced atomically like ReplaceFileContentHandler does.
+//
+//·pattern      Text to replace, or RE2 regexp with regex=true.
+//·replacement  Replacement, $1 or ${name} are expanded to the groups of the regexp with regex=true.
+//·regex        Whether the pattern is a regexp, false by default.
+//·ignoreCase   Whether the case is ignored, false by default.
+//·dryRun       Whether the changes are only previewed, true by default.
+func ReplaceInFolderHandler(c echo.Context) error {
+	entryPoint := c.FormValue("entryPoint")
+	pattern := c.FormValue("pattern")
+	replacement := c.FormValue("replacement")
+
+	// Ensure parameters are not null, the replacement can be empty to remove the pattern
+	if entryPoint == "" || pattern == "" {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			"Parameter 'entryPoint' or 'pattern' cannot be null.")
+	}
+	if err := authorize(c, auth.RightWrite, entryPoint); err != nil {
+		return err
+	}
+	if err := checkEntryPoint(entryPoint); err != nil {
+		return err
+	}
+
+	isRegex, err := boolQueryParam(c, "regex", false)
+	if err != nil {
+		return err
+	}
+	ignoreCase, err := boolQueryParam(c, "ignoreCase", false)
+	if err != nil {
+		return err
+	}
+	dryRun, err := boolQueryParam(c, "dryRun", true)
+	if err != nil {
+		return err
+	}
+
+	if !isRegex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Invalid pattern: %v", err))
+	}
+
+	walkResult, err := listEntryPoint(c, auth.RightWrite, entryPoint)
+	if err != nil {
+		return err
+	}
+
+	result := replaceResult{DryRun: dryRun, Files: []fileReplacement{}}
+	for _, filePath := range walkResult.FilePaths {
+		file := replaceInFile(c, filePath, re, replacement, isRegex, dryRun)
+		if file.Replacements == 0 && file.Status != replaceFailed {
+			continue
+		}
+		if file.Status == replaceFailed {
+			result.Failures++
+		} else {
+			result.FilesChanged++
+			result.Replacements += file.Replacements
+		}
+		result.Files = append(result.Files, file)
+	}
+
+	// Response
+	response := folderStats{
+		Message:  fmt.Sprintf("%d replacements in %d files.", result.Replacements, result.FilesChanged),
+		Result:   result,
+		Skipped:  walkResult.Skipped,
+		Reported: walkResult.Reported,
+	}
+	if dryRun {
+		response.Message = fmt.Sprintf("%d replacements in %d files would be made.", result.Replacements, result.FilesChanged)
+	}
+	return c.JSON(http.StatusOK, &response)
+}
+
+// replaceInFile replaces the pattern in a file, or only previews the replacements on a dry run.
+// The file is locked from its read to its write, and only replaced if its content is still the one read.
+func replaceInFile(c echo.Context, filePath string, re *regexp.Regexp, replacement string, expand bool, dryRun bool) fileReplacement {
+	file := fileReplacement{FilePath: filePath}
+	fail := func(err error) fileReplacement {
+		log.Errorf("Failed to replace the pattern in file %s, error: %v", filePath, err)
+		file.Status = replaceFailed
+		file.Error = errorMessage(err)
+		return file
+	}
+
+	defer fileLocks.Lock(filePath)()
+	b, err := Store.Read(filePath)
+	if err != nil {
+		return fail(err)
+	}
+	content := string(b)
+	file.Replacements = len(re.FindAllStringIndex(content, -1))
+	if file.Replacements == 0 {
+		return file
+	}
+
+	var replaced string
+	if expand {
+		replaced = re.ReplaceAllString(content, replacement)
+	} else {
+		replaced = re.ReplaceAllLiteralString(content, replacement)
+	}
+
+	if dryRun {
+		file.Status = replacePreviewed
+		edits := utils.Diff(utils.SplitLines(content), utils.SplitLines(replaced))
+		file.Diff = utils.UnifiedDiff(filePath, filePath, edits, replaceDiffContext)
+		return file
+	}
+
+	if err := checkContentSize(filePath, int64(len(replaced))); err != nil {
+		return fail(err)
+	}
+	err = writeWithinQuota(c, filePath, int64(len(replaced)), func() error {
+		// The file may have been written by something else than the handlers, e.g. by hand
+		current, err := Store.Read(filePath)
+		if err != nil {
+			return err
+		}
+		if audit.Hash(current) != audit.Hash(b) {
+			return fmt.Errorf("file %s changed while replacing, nothing is replaced", filePath)
+		}
+		return Store.Replace(filePath, []byte(replaced))
+	})
+	recordAudit(c, audit.Entry{
+		Operation: auditReplace,
+		Path:      filePath,
+		OldHash:   contentHash(b),
+		NewHash:   contentHash([]byte(replaced)),
+		Size:      int64(len(replaced)),
+	}, err)
+	if err != nil {
+		return fail(err)
+	}
+	indexFile(filePath, []byte(replaced))
+	file.Status = replaceReplaced
+	return file
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"../storage"
+	"encoding/json"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func replaceInFolder(t *testing.T, f url.Values, q url.Values) replaceResult {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/folder/replace?"+q.Encode(), strings.NewReader(f.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	var response struct {
+		Result  replaceResult `json:"result"`
+		Message string        `json:"message"`
+	}
+	if assert.NoError(t, ReplaceInFolderHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		err := json.Unmarshal([]byte(strings.TrimSpace(rec.Body.String())), &response)
+		if err != nil {
+			log.Fatalf("Failed to parse as json, error: %v", err)
+		}
+	}
+	return response.Result
+}
+
+func TestReplaceInFolderHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handlers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	assert.NoError(t, ioutil.WriteFile(a, []byte("Hello old world\nold-fashioned\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(b, []byte("Nothing to see\n"), 0644))
+
+	f := make(url.Values)
+	f.Set("entryPoint", dir)
+	f.Set("pattern", `old(\W)`)
+	f.Set("replacement", "new$1")
+	q := make(url.Values)
+	q.Set("regex", "true")
+
+	// Dry run by default
+	result := replaceInFolder(t, f, q)
+	assert.True(t, result.DryRun)
+	assert.Equal(t, 2, result.Replacements)
+	if assert.Equal(t, 1, len(result.Files)) {
+		assert.Equal(t, replacePreviewed, result.Files[0].Status)
+		assert.Contains(t, result.Files[0].Diff, "-Hello old world\n-old-fashioned\n+Hello new world\n+new-fashioned\n")
+	}
+	content, _ := ioutil.ReadFile(a)
+	assert.Equal(t, "Hello old world\nold-fashioned\n", string(content))
+
+	q.Set("dryRun", "false")
+	result = replaceInFolder(t, f, q)
+	assert.Equal(t, 1, result.FilesChanged)
+	if assert.Equal(t, 1, len(result.Files)) {
+		assert.Equal(t, replaceReplaced, result.Files[0].Status)
+		assert.Empty(t, result.Files[0].Diff)
+	}
+	content, _ = ioutil.ReadFile(a)
+	assert.Equal(t, "Hello new world\nnew-fashioned\n", string(content))
+
+	// Literal patterns
+	f.Set("pattern", "NEW-")
+	f.Set("replacement", "$1")
+	q = make(url.Values)
+	q.Set("ignoreCase", "true")
+	q.Set("dryRun", "false")
+	result = replaceInFolder(t, f, q)
+	assert.Equal(t, 1, result.Replacements)
+	content, _ = ioutil.ReadFile(a)
+	assert.Equal(t, "Hello new world\n$1fashioned\n", string(content))
+}
+
+// changingStore writes the file by hand as soon as it's read, like a concurrent writer would
+type changingStore struct {
+	storage.Store
+}
+
+func (s changingStore) Read(filePath string) ([]byte, error) {
+	b, err := s.Store.Read(filePath)
+	if err == nil {
+		err = ioutil.WriteFile(filePath, []byte("Written by hand\n"), 0644)
+	}
+	return b, err
+}
+
+func TestReplaceInFolderHandlerWrites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handlers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.txt")
+	assert.NoError(t, ioutil.WriteFile(a, []byte("Hello old world\n"), 0644))
+
+	// Every parameter may be given in the form
+	f := make(url.Values)
+	f.Set("entryPoint", dir)
+	f.Set("pattern", `o(ld)`)
+	f.Set("replacement", "o${1}er")
+	f.Set("regex", "true")
+	f.Set("dryRun", "false")
+	result := replaceInFolder(t, f, nil)
+	assert.Equal(t, 1, result.FilesChanged)
+	content, _ := ioutil.ReadFile(a)
+	assert.Equal(t, "Hello older world\n", string(content))
+
+	// The replaced content is limited like the content of any other write
+	f.Set("pattern", "older")
+	f.Set("replacement", "much older")
+	f.Set("regex", "false")
+	MaxContentSize = 20
+	result = replaceInFolder(t, f, nil)
+	MaxContentSize = 0
+	if assert.Equal(t, 1, result.Failures) {
+		assert.Contains(t, result.Files[0].Error, "is larger than 20 bytes")
+	}
+
+	quotaFile := filepath.Join(dir, "quotas.json")
+	assert.NoError(t, ioutil.WriteFile(quotaFile, []byte(`{"quotas": [{"path": "`+dir+`", "maxBytes": 20}]}`), 0600))
+	quotas, err := storage.LoadQuotas(quotaFile, Store)
+	if !assert.NoError(t, err) {
+		return
+	}
+	Quotas = quotas
+	result = replaceInFolder(t, f, nil)
+	Quotas = nil
+	if assert.Equal(t, 1, result.Failures) {
+		assert.Contains(t, result.Files[0].Error, "Failed to write file")
+	}
+	content, _ = ioutil.ReadFile(a)
+	assert.Equal(t, "Hello older world\n", string(content))
+
+	// A file written since it was read isn't replaced
+	store := Store
+	Store = changingStore{store}
+	result = replaceInFolder(t, f, nil)
+	Store = store
+	if assert.Equal(t, 1, result.Failures) {
+		assert.Contains(t, result.Files[0].Error, "changed while replacing")
+	}
+	content, _ = ioutil.ReadFile(a)
+	assert.Equal(t, "Written by hand\n", string(content))
+}
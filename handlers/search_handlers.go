@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"../auth"
+	"../search"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"net/http"
+)
+
+// Index is the full-text index of the files, kept up to date by the file handlers
+var Index = search.NewIndex()
+
+// indexFile indexes the new content of a file, a failure only makes the file unsearchable
+func indexFile(filePath string, content []byte) {
+	if err := Index.Add(filePath, content); err != nil {
+		log.Errorf("Failed to index file %s, error: %v", filePath, err)
+	}
+}
+
+func unindexFile(filePath string) {
+	if err := Index.Remove(filePath); err != nil {
+		log.Errorf("Failed to remove file %s from the index, error: %v", filePath, err)
+	}
+}
+
+// SearchHandler searches the indexed files
+//
+//·query     Terms, "phrases", prefixes* combined with AND, OR, NOT (or -term) and parentheses.
+//·folder    Only the files under this folder are searched.
+//·limit     Maximum number of results, 10 by default.
+//·snippets  Maximum number of highlighted lines per result, 3 by default.
+func SearchHandler(c echo.Context) error {
+	queryText := c.QueryParam("query")
+	folder := c.QueryParam("folder")
+
+	// Ensure parameter is not null
+	if queryText == "" {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			"Parameter 'query' cannot be null.")
+	}
+	if folder != "" {
+		if err := authorize(c, auth.RightRead, folder); err != nil {
+			return err
+		}
+		if err := checkEntryPoint(folder); err != nil {
+			return err
+		}
+	}
+
+	query, err := search.ParseQuery(queryText)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("Invalid query: %v", err))
+	}
+	limit, err := intQueryParam(c, "limit", 10)
+	if err != nil {
+		return err
+	}
+	snippets, err := intQueryParam(c, "snippets", 3)
+	if err != nil {
+		return err
+	}
+
+	result, err := Index.Search(query, search.SearchOptions{
+		Folder:   folder,
+		Limit:    limit,
+		Snippets: snippets,
+		Read:     Store.Read,
+		Allow:    allowed(c, auth.RightRead),
+	})
+	if err != nil {
+		log.Errorf("Error occurred while searching %s, error: %v", queryText, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to search the files.")
+	}
+
+	// Response
+	var response struct {
+		Message string              `json:"Message"`
+		Result  search.SearchResult `json:"Result"`
+	}
+	response.Message = "Searched successfully."
+	response.Result = result
+	return c.JSON(http.StatusOK, &response)
+}
+
+// IndexFolderHandler indexes the files under the entry point, selected by the walker parameters,
+// so the files written before the server started become searchable
+func IndexFolderHandler(c echo.Context) error {
+	entryPoint := c.QueryParam("entryPoint")
+
+	// Ensure parameter is not null
+	if entryPoint == "" {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			"Parameter 'entryPoint' cannot be null.")
+	}
+	if err := authorize(c, auth.RightRead, entryPoint); err != nil {
+		return err
+	}
+	if err := checkEntryPoint(entryPoint); err != nil {
+		return err
+	}
+
+	walkResult, err := listEntryPoint(c, auth.RightRead, entryPoint)
+	if err != nil {
+		return err
+	}
+
+	for _, filePath := range walkResult.FilePaths {
+		content, err := Store.Read(filePath)
+		if err != nil {
+			log.Errorf("Failed to read file %s, error: %v", filePath, err)
+			return echo.NewHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("Failed to index file: %s", filePath))
+		}
+		indexFile(filePath, content)
+	}
+
+	response := folderStats{
+		Message:  "Indexed successfully.",
+		Result:   map[string]int{"indexedFiles": len(walkResult.FilePaths), "totalFiles": Index.Len()},
+		Skipped:  walkResult.Skipped,
+		Reported: walkResult.Reported,
+	}
+	return c.JSON(http.StatusOK, &response)
+}
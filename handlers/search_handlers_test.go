@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"../search"
+	"encoding/json"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func searchFiles(t *testing.T, q url.Values) search.SearchResult {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/search?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	var response struct {
+		Result  search.SearchResult `json:"result"`
+		Message string              `json:"message"`
+	}
+	if assert.NoError(t, SearchHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		err := json.Unmarshal([]byte(strings.TrimSpace(rec.Body.String())), &response)
+		if err != nil {
+			log.Fatalf("Failed to parse as json, error: %v", err)
+		}
+	}
+	return response.Result
+}
+
+func TestSearchHandlerFollowsFileHandlers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handlers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	e := echo.New()
+	f := make(url.Values)
+	f.Set("filePath", filepath.Join(dir, "quote.txt"))
+	f.Set("content", "The quick brown fox\njumps over the lazy dog.")
+	req := httptest.NewRequest(http.MethodPost, "/file", strings.NewReader(f.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	if !assert.NoError(t, CreateNewFileHandler(c)) {
+		return
+	}
+
+	q := make(url.Values)
+	q.Set("query", `"lazy dog"`)
+	q.Set("folder", dir)
+	result := searchFiles(t, q)
+	if assert.Equal(t, 1, result.TotalHits) {
+		assert.Equal(t, []search.Snippet{{Line: 2, Text: "jumps over the <mark>lazy</mark> <mark>dog</mark>."}},
+			result.Results[0].Snippets)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/file", strings.NewReader(f.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	if assert.NoError(t, RemoveFileHandler(c)) {
+		assert.Equal(t, 0, searchFiles(t, q).TotalHits)
+	}
+}
+
+func TestIndexFolderHandler(t *testing.T) {
+	e := echo.New()
+	q := make(url.Values)
+	q.Set("entryPoint", "../data")
+	req := httptest.NewRequest(http.MethodPost, "/search/index?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	if assert.NoError(t, IndexFolderHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	q = make(url.Values)
+	q.Set("query", "the OR free")
+	q.Set("folder", "../data")
+	q.Set("limit", "1")
+	result := searchFiles(t, q)
+	assert.Equal(t, 2, result.TotalHits)
+	assert.Equal(t, 1, len(result.Results))
+}
+
+func TestSearchHandlerInvalidQuery(t *testing.T) {
+	e := echo.New()
+	q := make(url.Values)
+	q.Set("query", `"unterminated`)
+	req := httptest.NewRequest(http.MethodGet, "/search?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	err := SearchHandler(c)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	}
+}
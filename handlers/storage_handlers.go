@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"../audit"
+	"../auth"
+	"../storage"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"net/http"
+)
+
+// blobStore returns the blob store, or an error if the files are not stored in blobs
+func blobStore() (*storage.BlobStore, error) {
+	blobStore, ok := storage.Underlying(Store).(*storage.BlobStore)
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusConflict,
+			"The blob store isn't enabled.")
+	}
+	return blobStore, nil
+}
+
+func GetBlobStatsHandler(c echo.Context) error {
+	blobStore, err := blobStore()
+	if err != nil {
+		return err
+	}
+
+	stats, err := blobStore.Stats()
+	if err != nil {
+		log.Errorf("Error occurred while counting the blobs, error: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			"Failed to count the blobs.")
+	}
+
+	// Response
+	var response struct {
+		Message string            `json:"Message"`
+		Result  storage.BlobStats `json:"Result"`
+	}
+	response.Message = "Retrieved successfully."
+	response.Result = stats
+	return c.JSON(http.StatusOK, &response)
+}
+
+func CollectGarbageHandler(c echo.Context) error {
+	blobStore, err := blobStore()
+	if err != nil {
+		return err
+	}
+
+	gc, err := blobStore.CollectGarbage()
+	if err != nil {
+		log.Errorf("Error occurred while collecting the unreferenced blobs, error: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			"Failed to collect the unreferenced blobs.")
+	}
+
+	// Response
+	var response struct {
+		Message string                    `json:"Message"`
+		Result  storage.GarbageCollection `json:"Result"`
+	}
+	response.Message = "Unreferenced blobs have been removed."
+	response.Result = gc
+	return c.JSON(http.StatusOK, &response)
+}
+
+// encryptedStore returns the encrypted store, or an error if the files are not encrypted
+func encryptedStore() (*storage.EncryptedStore, error) {
+	for store := Store; store != nil; store = storage.Unwrap(store) {
+		if encryptedStore, ok := store.(*storage.EncryptedStore); ok {
+			return encryptedStore, nil
+		}
+	}
+	return nil, echo.NewHTTPError(http.StatusConflict,
+		"The encryption isn't enabled.")
+}
+
+type keyRotation struct {
+	ActiveKey string   `json:"activeKey"`
+	Rewrapped int      `json:"rewrapped"`
+	Encrypted int      `json:"encrypted"`
+	Unchanged int      `json:"unchanged"`
+	Failures  int      `json:"failures"`
+	Failed    []string `json:"failed,omitempty"`
+}
+
+// RotateKeysHandler reloads the keyfile, and wraps the data key of every file under the entry point,
+// selected by the walker parameters, with the active master key. The files which aren't encrypted yet
+// are encrypted. Once every file has been rewrapped, the previous master keys can be removed from the keyfile.
+func RotateKeysHandler(c echo.Context) error {
+	entryPoint := c.FormValue("entryPoint")
+
+	// Ensure parameter is not null
+	if entryPoint == "" {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			"Parameter 'entryPoint' cannot be null.")
+	}
+	if err := authorize(c, auth.RightWrite, entryPoint); err != nil {
+		return err
+	}
+	if err := checkEntryPoint(entryPoint); err != nil {
+		return err
+	}
+	encryptedStore, err := encryptedStore()
+	if err != nil {
+		return err
+	}
+
+	// Encrypted files look binary to the walker
+	options, err := getWalkOptions(c)
+	if err != nil {
+		return err
+	}
+	options.SkipBinary = false
+	walkResult, err := walkEntryPoint(entryPoint, options)
+	if err != nil {
+		return err
+	}
+	walkResult = authorizeWalk(c, auth.RightWrite, walkResult)
+
+	if err := encryptedStore.ReloadKeys(); err != nil {
+		log.Errorf("Error occurred while reloading the keyfile, error: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			"Failed to reload the keyfile.")
+	}
+
+	rotation := keyRotation{ActiveKey: encryptedStore.ActiveKey()}
+	for _, filePath := range walkResult.FilePaths {
+		outcome, err := encryptedStore.Rewrap(filePath)
+		if err != nil {
+			log.Errorf("Error occurred while rewrapping the data key of file: %s, error: %v", filePath, err)
+			recordAudit(c, audit.Entry{Operation: auditRewrap, Path: filePath}, err)
+			rotation.Failures++
+			rotation.Failed = append(rotation.Failed, filePath)
+			continue
+		}
+		switch outcome {
+		case storage.RewrapRewrapped:
+			recordAudit(c, audit.Entry{Operation: auditRewrap, Path: filePath}, nil)
+			rotation.Rewrapped++
+		case storage.RewrapEncrypted:
+			recordAudit(c, audit.Entry{Operation: auditEncrypt, Path: filePath}, nil)
+			rotation.Encrypted++
+		default:
+			rotation.Unchanged++
+		}
+	}
+
+	// Response
+	response := folderStats{
+		Message: fmt.Sprintf("%d files have been rewrapped and %d encrypted with key %s.",
+			rotation.Rewrapped, rotation.Encrypted, rotation.ActiveKey),
+		Result:   rotation,
+		Skipped:  walkResult.Skipped,
+		Reported: walkResult.Reported,
+	}
+	return c.JSON(http.StatusOK, &response)
+}
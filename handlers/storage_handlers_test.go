@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"../audit"
+	"../storage"
+	"encoding/json"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStorageHandlersWithoutBlobStore(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/storage/blobs", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	err := GetBlobStatsHandler(c)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+	}
+}
+
+func TestBlobStoreHandlers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handlers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	blobStore, err := storage.NewBlobStore(filepath.Join(dir, ".blobs"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defaultStore := Store
+	Store = blobStore
+	defer func() { Store = defaultStore }()
+
+	e := echo.New()
+	sourcePath := filepath.Join(dir, "a.txt")
+	assert.NoError(t, Store.Create(sourcePath, []byte("Hello, World!")))
+
+	f := make(url.Values)
+	f.Set("sourcePath", sourcePath)
+	f.Set("destinationPath", filepath.Join(dir, "b.txt"))
+	req := httptest.NewRequest(http.MethodPost, "/file/copy", strings.NewReader(f.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	if assert.NoError(t, CopyFileHandler(c)) {
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/storage/blobs", nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	if assert.NoError(t, GetBlobStatsHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response struct {
+			Result  storage.BlobStats `json:"result"`
+			Message string            `json:"message"`
+		}
+		err := json.Unmarshal([]byte(strings.TrimSpace(rec.Body.String())), &response)
+		if err != nil {
+			log.Fatalf("Failed to parse as json, error: %v", err)
+		}
+		assert.Equal(t, 1, response.Result.BlobCount)
+		assert.Equal(t, 2, response.Result.ReferenceCount)
+	}
+
+	assert.NoError(t, Store.Remove(sourcePath))
+	assert.NoError(t, Store.Remove(filepath.Join(dir, "b.txt")))
+	req = httptest.NewRequest(http.MethodPost, "/storage/gc", nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	if assert.NoError(t, CollectGarbageHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response struct {
+			Result  storage.GarbageCollection `json:"result"`
+			Message string                    `json:"message"`
+		}
+		err := json.Unmarshal([]byte(strings.TrimSpace(rec.Body.String())), &response)
+		if err != nil {
+			log.Fatalf("Failed to parse as json, error: %v", err)
+		}
+		assert.Equal(t, 1, response.Result.RemovedBlobs)
+	}
+}
+
+func TestRotateKeysHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handlers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	rotate := func() (*httptest.ResponseRecorder, error) {
+		e := echo.New()
+		f := make(url.Values)
+		f.Set("entryPoint", filepath.Join(dir, "files"))
+		req := httptest.NewRequest(http.MethodPost, "/storage/rotate", strings.NewReader(f.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+		return rec, RotateKeysHandler(e.NewContext(req, rec))
+	}
+
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "files"), 0755))
+	_, err = rotate()
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+	}
+
+	keyFile := filepath.Join(dir, "keys")
+	assert.NoError(t, ioutil.WriteFile(keyFile, []byte("k1 "+strings.Repeat("A", 43)+"=\n"), 0600))
+	encryptedStore, err := storage.NewEncryptedStore(storage.NewFileStore(), keyFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defaultStore := Store
+	Store = encryptedStore
+	defer func() { Store = defaultStore }()
+
+	assert.NoError(t, Store.Create(filepath.Join(dir, "files", "a.txt"), []byte("Hello, World!")))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "files", "b.txt"), []byte("Hello, World!"), 0644))
+	file, _ := os.OpenFile(keyFile, os.O_APPEND|os.O_WRONLY, 0600)
+	file.WriteString("k2 " + strings.Repeat("B", 43) + "=\n")
+	file.Close()
+
+	auditLog, err := audit.Open(filepath.Join(dir, "audit.log"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer auditLog.Close()
+	Audit = auditLog
+	defer func() { Audit = nil }()
+
+	rec, err := rotate()
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response struct {
+			Result  keyRotation `json:"result"`
+			Message string      `json:"message"`
+		}
+		err := json.Unmarshal([]byte(strings.TrimSpace(rec.Body.String())), &response)
+		if err != nil {
+			log.Fatalf("Failed to parse as json, error: %v", err)
+		}
+		assert.Equal(t, keyRotation{ActiveKey: "k2", Rewrapped: 1, Encrypted: 1}, response.Result)
+	}
+
+	rec, err = rotate()
+	if assert.NoError(t, err) {
+		assert.Contains(t, rec.Body.String(), `"unchanged":2`)
+	}
+
+	// The files rewritten are recorded, not the ones left as they were
+	entries, err := Audit.Query(audit.Filter{})
+	if assert.NoError(t, err) && assert.Equal(t, 2, len(entries)) {
+		operations := map[string]string{}
+		for _, entry := range entries {
+			operations[filepath.Base(entry.Path)] = entry.Operation
+		}
+		assert.Equal(t, map[string]string{"a.txt": auditRewrap, "b.txt": auditEncrypt}, operations)
+	}
+	content, err := Store.Read(filepath.Join(dir, "files", "b.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello, World!", string(content))
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"../auth"
+	"../utils"
+	"fmt"
+	"github.com/labstack/echo"
+	"net/http"
+)
+
+func GetFolderUsageHandler(c echo.Context) error {
+	entryPoint := c.QueryParam("entryPoint")
+
+	// Ensure parameter is not null
+	if entryPoint == "" {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			"Parameter 'entryPoint' cannot be null.")
+	}
+
+	if err := authorize(c, auth.RightStats, entryPoint); err != nil {
+		return err
+	}
+	if err := checkEntryPoint(entryPoint); err != nil {
+		return err
+	}
+
+	topN, err := intQueryParam(c, "topN", 10)
+	if err != nil {
+		return err
+	}
+
+	// Binary files use disk space as well, and sniffing them would require opening them
+	options, err := getWalkOptions(c)
+	if err != nil {
+		return err
+	}
+	options.SkipBinary = false
+	walkResult, err := walkEntryPoint(entryPoint, options)
+	if err != nil {
+		return err
+	}
+	walkResult = authorizeWalk(c, auth.RightStats, walkResult)
+
+	// Response
+	var response folderStats
+	response.Message = fmt.Sprintf("Successfully calculate the disk usage from the entry point: %s", entryPoint)
+	response.Result = utils.ComputeDiskUsage(entryPoint, walkResult.FilePaths, walkResult.FileInfos, topN)
+	response.Skipped = walkResult.Skipped
+	response.Reported = walkResult.Reported
+	return c.JSON(http.StatusOK, &response)
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"../utils"
+	"encoding/json"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGetFolderUsageHandler(t *testing.T) {
+	e := echo.New()
+	q := make(url.Values)
+	q.Set("entryPoint", "../data")
+	q.Set("topN", "1")
+	req := httptest.NewRequest(http.MethodGet, "/folder/usage?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if assert.NoError(t, GetFolderUsageHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response struct {
+			Result  utils.DiskUsage `json:"result"`
+			Message string          `json:"message"`
+		}
+
+		err := json.Unmarshal([]byte(strings.TrimSpace(rec.Body.String())), &response)
+		if err != nil {
+			log.Fatalf("Failed to parse as json, error: %v", err)
+		}
+		assert.Equal(t, 2, response.Result.FileCount)
+		assert.Equal(t, int64(1407), response.Result.ApparentSize)
+		if assert.Equal(t, 1, len(response.Result.LargestFiles)) {
+			assert.Equal(t, "../data/text_files/text1.txt", response.Result.LargestFiles[0].Path)
+		}
+	}
+}
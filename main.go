@@ -1,28 +1,285 @@
 package main
 
 import (
+	"./audit"
+	"./auth"
 	"./handlers"
+	"./storage"
+	"./utils"
+	"context"
+	"flag"
 	"github.com/labstack/echo"
+	"io"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// Time given to the requests being served to complete once the service is asked to stop
+const shutdownTimeout = 30 * time.Second
+
 func heartBeatHandler(c echo.Context) error {
 	return c.String(http.StatusOK, "pong")
 }
 
 func main() {
+	blobRoot := flag.String("blobRoot", "",
+		"Store the content of the files once in blobs under this directory, on the same file system as the files")
+	keyFile := flag.String("keyFile", "",
+		"Encrypt the content of the files written, with data keys wrapped by the last master key of this keyfile")
+	compression := flag.String("compression", "",
+		"Compress the content of the files written, with gzip or zstd")
+	quotas := flag.String("quotas", "",
+		"Limit the bytes and the files written by the principals and under the folders listed by this quota file")
+	apiKeys := flag.String("apiKeys", "",
+		"Require an API key from this file, granted scopes, on every route but /ping")
+	jwtConfig := flag.String("jwt", "",
+		"Accept the bearer tokens validated by this JWT configuration file, alongside the API keys if any")
+	rateLimit := flag.String("rateLimit", "",
+		"Limit the requests of every client address, e.g. 20/s, 600/m or 600/m:50 with a burst of 50")
+	keyRateLimit := flag.String("keyRateLimit", "",
+		"Limit the requests of every authenticated principal, such as an API key, e.g. 1000/m")
+	statsRateLimit := flag.String("statsRateLimit", "",
+		"Limit the requests walking a whole folder or the index (statistics, grep, replace, archives, search) of every principal, or address if anonymous, e.g. 10/m")
+	maxBodySize := flag.Int64("maxBodySize", 0,
+		"Reject the requests whose body is larger than this number of bytes once decompressed, unlimited if 0")
+	maxContentSize := flag.Int64("maxContentSize", 0,
+		"Reject the files whose content is larger than this number of bytes, unlimited if 0")
+	archiveMaxEntries := flag.Int("archiveMaxEntries", handlers.ArchiveLimits.MaxEntries,
+		"Reject the uploaded archives with more entries than this, unlimited if 0")
+	archiveMaxBytes := flag.Int64("archiveMaxBytes", handlers.ArchiveLimits.MaxBytes,
+		"Reject the uploaded archives larger than this number of bytes, compressed or extracted, unlimited if 0")
+	auditLog := flag.String("auditLog", "",
+		"Record who changed which file, and when, in this hash-chained audit log")
+	addr := flag.String("addr", ":1323",
+		"Listen on this address")
+	tlsCert := flag.String("tlsCert", "",
+		"Serve HTTPS with this PEM certificate, reloaded once renewed, along with -tlsKey")
+	tlsKey := flag.String("tlsKey", "",
+		"Private key of the HTTPS certificate, PEM encoded")
+	clientCA := flag.String("clientCA", "",
+		"Verify the client certificates against the CAs of this PEM file")
+	requireClientCert := flag.Bool("requireClientCert", false,
+		"Reject the TLS connections without a client certificate verified against -clientCA")
+	clientCerts := flag.String("clientCerts", "",
+		"Authenticate the client certificates whose subjects are listed by this file, granted scopes")
+	redirectHTTP := flag.String("redirectHTTP", "",
+		"Redirect the plain HTTP requests received on this address, e.g. :80, to HTTPS")
+	acl := flag.String("acl", "",
+		"Grant the rights on the paths by the rules of this policy file, created with the first rule if missing")
+	flag.Parse()
+
 	e := echo.New()
 
+	if *blobRoot != "" {
+		blobStore, err := storage.NewBlobStore(*blobRoot)
+		if err != nil {
+			e.Logger.Fatalf("Failed to open the blob store %s, error: %v", *blobRoot, err)
+		}
+		handlers.Store = blobStore
+	}
+	if *keyFile != "" {
+		encryptedStore, err := storage.NewEncryptedStore(handlers.Store, *keyFile)
+		if err != nil {
+			e.Logger.Fatalf("Failed to enable the encryption, error: %v", err)
+		}
+		handlers.Store = encryptedStore
+	}
+	// Compressed before being encrypted, encrypted content doesn't compress
+	if *compression != "" {
+		compressedStore, err := storage.NewCompressedStore(handlers.Store, *compression)
+		if err != nil {
+			e.Logger.Fatalf("Failed to enable the compression, error: %v", err)
+		}
+		handlers.Store = compressedStore
+	}
+
+	// The statistics are computed on the content of the files, whatever the store does with it
+	store := handlers.Store
+	utils.OpenFile = func(filePath string) (io.ReadCloser, error) {
+		return storage.Open(store, filePath)
+	}
+	utils.ContentSize = func(filePath string, fi os.FileInfo) (int64, error) {
+		return storage.ContentSize(store, filePath, fi)
+	}
+	if *quotas != "" {
+		loadedQuotas, err := storage.LoadQuotas(*quotas, store)
+		if err != nil {
+			e.Logger.Fatalf("Failed to load the quotas, error: %v", err)
+		}
+		handlers.Quotas = loadedQuotas
+	}
+
+	var authenticators []auth.Authenticator
+	if *apiKeys != "" {
+		keys, err := auth.LoadAPIKeys(*apiKeys)
+		if err != nil {
+			e.Logger.Fatalf("Failed to load the API keys, error: %v", err)
+		}
+		authenticators = append(authenticators, keys)
+	}
+	if *jwtConfig != "" {
+		config, err := auth.LoadJWTConfig(*jwtConfig)
+		if err != nil {
+			e.Logger.Fatalf("Failed to load the JWT configuration, error: %v", err)
+		}
+		tokens, err := auth.NewJWTAuthenticator(config)
+		if err != nil {
+			e.Logger.Fatalf("Invalid JWT configuration, error: %v", err)
+		}
+		authenticators = append(authenticators, tokens)
+	}
+	if *clientCerts != "" {
+		if *clientCA == "" {
+			e.Logger.Fatalf("The client certificates cannot be authenticated without -clientCA")
+		}
+		certs, err := auth.LoadClientCertificates(*clientCerts)
+		if err != nil {
+			e.Logger.Fatalf("Failed to load the client certificates, error: %v", err)
+		}
+		authenticators = append(authenticators, certs)
+	}
+	if *acl != "" {
+		policy, err := auth.LoadPolicy(*acl)
+		if err != nil {
+			e.Logger.Fatalf("Failed to load the access control policy, error: %v", err)
+		}
+		handlers.Policy = policy
+	}
+	if *auditLog != "" {
+		auditTrail, err := audit.Open(*auditLog)
+		if err != nil {
+			e.Logger.Fatalf("Failed to open the audit log, error: %v", err)
+		}
+		// Closed once the server is shut down
+		handlers.Audit = auditTrail
+	}
+	ipLimiter, err := handlers.NewRateLimiter(*rateLimit)
+	if err != nil {
+		e.Logger.Fatalf("Invalid rate limit, error: %v", err)
+	}
+	keyLimiter, err := handlers.NewRateLimiter(*keyRateLimit)
+	if err != nil {
+		e.Logger.Fatalf("Invalid key rate limit, error: %v", err)
+	}
+	statsLimiter, err := handlers.NewRateLimiter(*statsRateLimit)
+	if err != nil {
+		e.Logger.Fatalf("Invalid folder statistics rate limit, error: %v", err)
+	}
+	handlers.MaxContentSize = *maxContentSize
+	handlers.ArchiveLimits = utils.ArchiveLimits{MaxEntries: *archiveMaxEntries, MaxBytes: *archiveMaxBytes}
+
+	guard := auth.NewGuard(authenticators, "/ping")
+	read := guard.Require(auth.ScopeFilesRead)
+	write := guard.Require(auth.ScopeFilesWrite)
+	stats := guard.Require(auth.ScopeFoldersStats)
+	admin := guard.Require(auth.ScopeStorageAdmin)
+	aclAdmin := guard.Require(auth.ScopeACLAdmin)
+	auditRead := guard.Require(auth.ScopeAuditRead)
+
+	// Abusive addresses are turned away before checking their credentials, callers are identified
+	// before anything else, bodies may be compressed both ways and are limited once decompressed
+	e.Use(ipLimiter.Limit(handlers.ClientIP), guard.Authenticate, keyLimiter.Limit(handlers.ClientPrincipal),
+		handlers.DecodeRequestBody, handlers.CompressResponse)
+	if *maxBodySize > 0 {
+		e.Use(handlers.LimitRequestBody(*maxBodySize))
+	}
+	statsLimit := statsLimiter.Limit(handlers.ClientPrincipalOrIP)
+
 	// Monitoring handlers
 	e.GET("/ping", heartBeatHandler)
 
 	// Customised handlers
-	e.POST("/file", handlers.CreateNewFileHandler)
-	e.GET("/file", handlers.GetFileContentHandler)
-	e.PUT("/file", handlers.ReplaceFileContentHandler)
-	e.DELETE("/file", handlers.RemoveFileHandler)
+	e.POST("/file", handlers.CreateNewFileHandler, write)
+	e.GET("/file", handlers.GetFileContentHandler, read)
+	e.PUT("/file", handlers.ReplaceFileContentHandler, write)
+	e.DELETE("/file", handlers.RemoveFileHandler, write)
+	e.POST("/file/copy", handlers.CopyFileHandler, write)
+	e.POST("/file/batch", handlers.BatchFileOperationsHandler, write)
+	e.GET("/file/stats", handlers.GetFileStatsHandler, read)
+	e.GET("/file/ngrams", handlers.GetFileNGramsHandler, read)
+	e.GET("/file/language", handlers.GetFileLanguageHandler, read)
+	e.GET("/file/diff", handlers.GetFileDiffHandler, read)
+	e.POST("/file/diff", handlers.GetFileDiffHandler, read)
+
+	e.GET("/folder", handlers.GetFolderStatsHandler, stats, statsLimit)
+	e.GET("/folder/ngrams", handlers.GetFolderNGramsHandler, stats, statsLimit)
+	e.GET("/folder/usage", handlers.GetFolderUsageHandler, stats, statsLimit)
+	e.GET("/folder/duplicates", handlers.GetFolderDuplicatesHandler, stats, statsLimit)
+	e.GET("/folder/grep", handlers.GetFolderGrepHandler, read, statsLimit)
+	e.POST("/folder/replace", handlers.ReplaceInFolderHandler, write, statsLimit)
+	e.GET("/folder/archive", handlers.DownloadArchiveHandler, read, statsLimit)
+	e.POST("/folder/archive", handlers.UploadArchiveHandler, write, statsLimit)
 
-	e.GET("/folder", handlers.GetFolderStatsHandler)
+	e.GET("/search", handlers.SearchHandler, read, statsLimit)
+	e.POST("/search/index", handlers.IndexFolderHandler, admin, statsLimit)
 
-	e.Logger.Fatal(e.Start(":1323"))
-}
\ No newline at end of file
+	e.GET("/storage/blobs", handlers.GetBlobStatsHandler, admin)
+	e.GET("/storage/quotas", handlers.GetQuotaUsageHandler, stats)
+	e.POST("/storage/gc", handlers.CollectGarbageHandler, admin)
+	e.POST("/storage/rotate", handlers.RotateKeysHandler, admin)
+
+	e.GET("/acl/rules", handlers.GetACLRulesHandler, aclAdmin)
+	e.POST("/acl/rules", handlers.AddACLRuleHandler, aclAdmin)
+	e.DELETE("/acl/rules", handlers.RemoveACLRuleHandler, aclAdmin)
+	e.GET("/acl/explain", handlers.ExplainAccessHandler, aclAdmin)
+
+	e.GET("/audit", handlers.GetAuditEntriesHandler, auditRead)
+	e.GET("/audit/verify", handlers.VerifyAuditLogHandler, auditRead)
+
+	start := func() error { return e.Start(*addr) }
+	var redirect *echo.Echo
+	if *tlsCert != "" || *tlsKey != "" {
+		certs, err := auth.NewCertReloader(*tlsCert, *tlsKey)
+		if err != nil {
+			e.Logger.Fatalf("Failed to load the TLS certificate, error: %v", err)
+		}
+		tlsConfig, err := auth.ServerTLSConfig(certs, *clientCA, *requireClientCert)
+		if err != nil {
+			e.Logger.Fatalf("Invalid TLS configuration, error: %v", err)
+		}
+		if *redirectHTTP != "" {
+			redirect = echo.New()
+			redirect.HideBanner = true
+			redirect.Any("/*", handlers.RedirectToHTTPS(*addr))
+			go serve(e, func() error { return redirect.Start(*redirectHTTP) })
+		}
+		// As e.StartTLS does, which can't reload the certificate
+		tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+		e.TLSServer.Addr = *addr
+		e.TLSServer.TLSConfig = tlsConfig
+		start = func() error { return e.StartServer(e.TLSServer) }
+	} else if *clientCA != "" || *redirectHTTP != "" {
+		e.Logger.Fatalf("-clientCA and -redirectHTTP require -tlsCert and -tlsKey")
+	}
+	go serve(e, start)
+
+	// On SIGINT or SIGTERM, the requests being served are completed before the audit log is closed
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if redirect != nil {
+		if err := redirect.Shutdown(ctx); err != nil {
+			e.Logger.Errorf("Failed to shut down the HTTP redirect, error: %v", err)
+		}
+	}
+	if err := e.Shutdown(ctx); err != nil {
+		e.Logger.Errorf("Failed to shut down the server, error: %v", err)
+	}
+	if handlers.Audit != nil {
+		if err := handlers.Audit.Close(); err != nil {
+			e.Logger.Errorf("Failed to close the audit log, error: %v", err)
+		}
+	}
+}
+
+// serve runs a server until it's shut down, any other error stops the service
+func serve(e *echo.Echo, start func() error) {
+	if err := start(); err != nil && err != http.ErrServerClosed {
+		e.Logger.Fatal(err)
+	}
+}
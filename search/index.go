@@ -0,0 +1,468 @@
+package search
+
+import (
+	"bytes"
+	"html"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// BM25 parameters, k1 saturates the term frequency and b normalises by the document length
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	// Longer lines are cut around their first highlighted word
+	maxSnippetBytes = 200
+	snippetContext  = 60
+)
+
+// Index is an inverted index of the words of the files, safe for concurrent use.
+// Files are indexed by absolute path, with the positions of every word so phrases can be matched.
+type Index struct {
+	mu          sync.RWMutex
+	documents   map[string]*document
+	postings    map[string]map[string][]int
+	totalLength int
+}
+
+type document struct {
+	length int
+	terms  []string
+}
+
+// SearchOptions restrict and shape the results of a search
+type SearchOptions struct {
+	// Only the files under this folder are searched, all the files if empty
+	Folder string
+	// Maximum number of results, unlimited if zero
+	Limit int
+	// Maximum number of snippets per result
+	Snippets int
+	// Reads the content of a file to build its snippets, ioutil.ReadFile if nil
+	Read func(filePath string) ([]byte, error)
+	// Tells whether a matching file can be returned, every file if nil
+	Allow func(filePath string) bool
+}
+
+// Snippet is a line of a file containing matched words, surrounded by <mark> and </mark>. The text is
+// HTML, the content of the line is escaped.
+type Snippet struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+type Result struct {
+	FilePath string    `json:"filePath"`
+	Score    float64   `json:"score"`
+	Snippets []Snippet `json:"snippets"`
+}
+
+type SearchResult struct {
+	TotalHits int      `json:"totalHits"`
+	Results   []Result `json:"results"`
+}
+
+func NewIndex() *Index {
+	return &Index{
+		documents: make(map[string]*document),
+		postings:  make(map[string]map[string][]int),
+	}
+}
+
+// Add indexes the content of a file, replacing its previous content
+func (ix *Index) Add(filePath string, content []byte) error {
+	filePath, err := filepath.Abs(filePath)
+	if err != nil {
+		return err
+	}
+
+	tokens := tokenize(content)
+	positions := make(map[string][]int)
+	for i, t := range tokens {
+		positions[t.term] = append(positions[t.term], i)
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(filePath)
+
+	doc := &document{length: len(tokens), terms: make([]string, 0, len(positions))}
+	for term, termPositions := range positions {
+		if ix.postings[term] == nil {
+			ix.postings[term] = make(map[string][]int)
+		}
+		ix.postings[term][filePath] = termPositions
+		doc.terms = append(doc.terms, term)
+	}
+	ix.documents[filePath] = doc
+	ix.totalLength += doc.length
+	return nil
+}
+
+// Remove removes a file from the index, if it was indexed
+func (ix *Index) Remove(filePath string) error {
+	filePath, err := filepath.Abs(filePath)
+	if err != nil {
+		return err
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(filePath)
+	return nil
+}
+
+func (ix *Index) remove(filePath string) {
+	doc, ok := ix.documents[filePath]
+	if !ok {
+		return
+	}
+	for _, term := range doc.terms {
+		delete(ix.postings[term], filePath)
+		if len(ix.postings[term]) == 0 {
+			delete(ix.postings, term)
+		}
+	}
+	delete(ix.documents, filePath)
+	ix.totalLength -= doc.length
+}
+
+// Len returns the number of indexed files
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.documents)
+}
+
+// Search returns the files matching the query ranked by their BM25 score,
+// the snippets are the first lines of a file containing matched words
+func (ix *Index) Search(query Query, options SearchOptions) (SearchResult, error) {
+	scope, err := ix.scope(options.Folder)
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	ix.mu.RLock()
+	universe := make(map[string]bool)
+	for filePath := range ix.documents {
+		if scope(filePath) {
+			universe[filePath] = true
+		}
+	}
+	hits := query.root.evaluate(ix, universe)
+	ix.mu.RUnlock()
+	if options.Allow != nil {
+		for filePath := range hits {
+			if !options.Allow(filePath) {
+				delete(hits, filePath)
+			}
+		}
+	}
+
+	result := SearchResult{TotalHits: len(hits), Results: make([]Result, 0, len(hits))}
+	for filePath, h := range hits {
+		result.Results = append(result.Results, Result{FilePath: filePath, Score: h.score})
+	}
+	sort.Slice(result.Results, func(i, j int) bool {
+		if result.Results[i].Score != result.Results[j].Score {
+			return result.Results[i].Score > result.Results[j].Score
+		}
+		return result.Results[i].FilePath < result.Results[j].FilePath
+	})
+	if options.Limit > 0 && len(result.Results) > options.Limit {
+		result.Results = result.Results[:options.Limit]
+	}
+
+	// Files changed or removed since they were indexed have no snippet
+	read := options.Read
+	if read == nil {
+		read = ioutil.ReadFile
+	}
+	for i := range result.Results {
+		r := &result.Results[i]
+		r.Snippets = []Snippet{}
+		if options.Snippets == 0 {
+			continue
+		}
+		if content, err := read(r.FilePath); err == nil {
+			r.Snippets = snippets(content, hits[r.FilePath].positions, options.Snippets)
+		}
+	}
+	return result, nil
+}
+
+// scope returns whether a file is under the folder
+func (ix *Index) scope(folder string) (func(filePath string) bool, error) {
+	if folder == "" {
+		return func(string) bool { return true }, nil
+	}
+	folder, err := filepath.Abs(folder)
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.TrimSuffix(folder, string(os.PathSeparator)) + string(os.PathSeparator)
+	return func(filePath string) bool {
+		return strings.HasPrefix(filePath, prefix)
+	}, nil
+}
+
+// bm25 scores a term (or a phrase) occurring tf times in a document, df is the number of documents
+// containing it
+func (ix *Index) bm25(tf int, df int, length int) float64 {
+	n := float64(len(ix.documents))
+	idf := math.Log(1 + (n-float64(df)+0.5)/(float64(df)+0.5))
+	averageLength := float64(ix.totalLength) / n
+	norm := 1 - bm25B
+	if averageLength > 0 {
+		norm += bm25B * float64(length) / averageLength
+	}
+	return idf * float64(tf) * (bm25K1 + 1) / (float64(tf) + bm25K1*norm)
+}
+
+// hit is a matching document, the positions are those of the matched words, for the snippets
+type hit struct {
+	score     float64
+	positions []int
+}
+
+// node is a node of a parsed query, evaluated against the documents of the universe
+// while the index is locked
+type node interface {
+	evaluate(ix *Index, universe map[string]bool) map[string]*hit
+}
+
+type termNode struct {
+	term string
+}
+
+func (n *termNode) evaluate(ix *Index, universe map[string]bool) map[string]*hit {
+	hits := make(map[string]*hit)
+	addTerm(ix, universe, n.term, hits)
+	return hits
+}
+
+// addTerm adds the documents of the universe containing the term to the hits
+func addTerm(ix *Index, universe map[string]bool, term string, hits map[string]*hit) {
+	postings := ix.postings[term]
+	for filePath, positions := range postings {
+		if !universe[filePath] {
+			continue
+		}
+		h := hits[filePath]
+		if h == nil {
+			h = &hit{}
+			hits[filePath] = h
+		}
+		h.score += ix.bm25(len(positions), len(postings), ix.documents[filePath].length)
+		h.positions = append(h.positions, positions...)
+	}
+}
+
+// prefixNode matches every term starting with the prefix, each of them adds to the score
+type prefixNode struct {
+	prefix string
+}
+
+func (n *prefixNode) evaluate(ix *Index, universe map[string]bool) map[string]*hit {
+	hits := make(map[string]*hit)
+	for term := range ix.postings {
+		if strings.HasPrefix(term, n.prefix) {
+			addTerm(ix, universe, term, hits)
+		}
+	}
+	return hits
+}
+
+type phraseNode struct {
+	terms []string
+}
+
+func (n *phraseNode) evaluate(ix *Index, universe map[string]bool) map[string]*hit {
+	// Occurrences of the phrase in every document containing all its terms
+	occurrences := make(map[string][]int)
+	for filePath, first := range ix.postings[n.terms[0]] {
+		var following []map[int]bool
+		for _, term := range n.terms[1:] {
+			positions, ok := ix.postings[term][filePath]
+			if !ok {
+				following = nil
+				break
+			}
+			set := make(map[int]bool, len(positions))
+			for _, position := range positions {
+				set[position] = true
+			}
+			following = append(following, set)
+		}
+		if following == nil {
+			continue
+		}
+
+		for _, position := range first {
+			matched := true
+			for k, set := range following {
+				if !set[position+k+1] {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				occurrences[filePath] = append(occurrences[filePath], position)
+			}
+		}
+	}
+
+	hits := make(map[string]*hit)
+	for filePath, starts := range occurrences {
+		if !universe[filePath] {
+			continue
+		}
+		h := &hit{score: ix.bm25(len(starts), len(occurrences), ix.documents[filePath].length)}
+		for _, start := range starts {
+			for k := range n.terms {
+				h.positions = append(h.positions, start+k)
+			}
+		}
+		hits[filePath] = h
+	}
+	return hits
+}
+
+// andNode matches the documents matched by all its children, their scores add up
+type andNode struct {
+	children []node
+}
+
+func (n *andNode) evaluate(ix *Index, universe map[string]bool) map[string]*hit {
+	hits := n.children[0].evaluate(ix, universe)
+	for _, child := range n.children[1:] {
+		childHits := child.evaluate(ix, universe)
+		for filePath, h := range hits {
+			childHit, ok := childHits[filePath]
+			if !ok {
+				delete(hits, filePath)
+				continue
+			}
+			h.score += childHit.score
+			h.positions = append(h.positions, childHit.positions...)
+		}
+	}
+	return hits
+}
+
+// orNode matches the documents matched by any of its children, the scores of the matching children add up
+type orNode struct {
+	children []node
+}
+
+func (n *orNode) evaluate(ix *Index, universe map[string]bool) map[string]*hit {
+	hits := make(map[string]*hit)
+	for _, child := range n.children {
+		for filePath, childHit := range child.evaluate(ix, universe) {
+			h, ok := hits[filePath]
+			if !ok {
+				hits[filePath] = childHit
+				continue
+			}
+			h.score += childHit.score
+			h.positions = append(h.positions, childHit.positions...)
+		}
+	}
+	return hits
+}
+
+// notNode matches the documents of the universe its child doesn't match, they score nothing
+type notNode struct {
+	child node
+}
+
+func (n *notNode) evaluate(ix *Index, universe map[string]bool) map[string]*hit {
+	excluded := n.child.evaluate(ix, universe)
+	hits := make(map[string]*hit)
+	for filePath := range universe {
+		if _, ok := excluded[filePath]; !ok {
+			hits[filePath] = &hit{}
+		}
+	}
+	return hits
+}
+
+// snippets returns the first lines containing the words at the positions, highlighted
+func snippets(content []byte, positions []int, max int) []Snippet {
+	tokens := tokenize(content)
+	sort.Ints(positions)
+
+	var result []Snippet
+	var line []token
+	for i, position := range positions {
+		if position >= len(tokens) || (i > 0 && position == positions[i-1]) {
+			continue
+		}
+		t := tokens[position]
+		if len(line) > 0 && line[0].line != t.line {
+			result = append(result, snippet(content, line))
+			line = nil
+			if len(result) == max {
+				return result
+			}
+		}
+		line = append(line, t)
+	}
+	if len(line) > 0 {
+		result = append(result, snippet(content, line))
+	}
+	return result
+}
+
+// snippet highlights the tokens of a line, long lines are cut around the first token
+func snippet(content []byte, tokens []token) Snippet {
+	first := tokens[0]
+	lineStart := bytes.LastIndexByte(content[:first.start], '\n') + 1
+	lineEnd := len(content)
+	if i := bytes.IndexByte(content[first.start:], '\n'); i >= 0 {
+		lineEnd = first.start + i
+	}
+
+	start, end := lineStart, lineEnd
+	if end-start > maxSnippetBytes {
+		if first.start-snippetContext > start {
+			start = first.start - snippetContext
+		}
+		for start < lineEnd && !utf8.RuneStart(content[start]) {
+			start++
+		}
+		if start+maxSnippetBytes < end {
+			end = start + maxSnippetBytes
+		}
+		for end < lineEnd && !utf8.RuneStart(content[end]) {
+			end--
+		}
+	}
+
+	var b strings.Builder
+	if start > lineStart {
+		b.WriteString("…")
+	}
+	cursor := start
+	for _, t := range tokens {
+		if t.start < cursor || t.end > end {
+			continue
+		}
+		b.WriteString(html.EscapeString(string(content[cursor:t.start])))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(string(content[t.start:t.end])))
+		b.WriteString("</mark>")
+		cursor = t.end
+	}
+	b.WriteString(html.EscapeString(string(content[cursor:end])))
+	if end < lineEnd {
+		b.WriteString("…")
+	}
+	return Snippet{Line: first.line, Text: strings.TrimSpace(b.String())}
+}
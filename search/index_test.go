@@ -0,0 +1,100 @@
+package search
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func newTestIndex(t *testing.T) *Index {
+	ix := NewIndex()
+	files := map[string]string{
+		"/docs/go.txt":     "Go is a programming language.\nGo programs are fast and go is simple.",
+		"/docs/python.txt": "Python is a programming language too.\nPython programs are slower.",
+		"/other/fast.txt":  "Fast food is not a language.",
+	}
+	for filePath, content := range files {
+		assert.NoError(t, ix.Add(filePath, []byte(content)))
+	}
+	return ix
+}
+
+func search(t *testing.T, ix *Index, query string, options SearchOptions) []string {
+	q, err := ParseQuery(query)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	result, err := ix.Search(q, options)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	var filePaths []string
+	for _, r := range result.Results {
+		filePaths = append(filePaths, filepath.Base(r.FilePath))
+	}
+	return filePaths
+}
+
+func TestIndexSearch(t *testing.T) {
+	ix := newTestIndex(t)
+
+	// The most relevant files first, shorter files weigh a match more
+	assert.Equal(t, []string{"python.txt", "go.txt"}, search(t, ix, "programming", SearchOptions{}))
+	assert.Equal(t, []string{"go.txt"}, search(t, ix, "go language", SearchOptions{}))
+	assert.Equal(t, []string{"go.txt", "python.txt"}, search(t, ix, "go OR python", SearchOptions{}))
+	assert.Equal(t, []string{"fast.txt", "python.txt"}, search(t, ix, "language -go", SearchOptions{}))
+	assert.Equal(t, []string{"python.txt", "go.txt"}, search(t, ix, "program*", SearchOptions{}))
+	assert.Equal(t, []string{"go.txt"}, search(t, ix, `"are fast"`, SearchOptions{}))
+	assert.Nil(t, search(t, ix, `"fast are"`, SearchOptions{}))
+
+	// Scoped to a folder
+	assert.Equal(t, []string{"go.txt"}, search(t, ix, "fast", SearchOptions{Folder: "/docs"}))
+	assert.Equal(t, []string{"fast.txt"}, search(t, ix, "NOT programming", SearchOptions{Folder: "/other"}))
+	assert.Nil(t, search(t, ix, "fast", SearchOptions{Folder: "/do"}))
+
+	// Restricted to the allowed files, before the results are limited
+	allow := func(filePath string) bool { return filepath.Base(filePath) != "python.txt" }
+	assert.Equal(t, []string{"go.txt"}, search(t, ix, "programming", SearchOptions{Allow: allow, Limit: 1}))
+
+	// Updated and removed files
+	assert.NoError(t, ix.Add("/docs/python.txt", []byte("Snakes")))
+	assert.Equal(t, []string{"go.txt"}, search(t, ix, "programming", SearchOptions{}))
+	assert.NoError(t, ix.Remove("/docs/go.txt"))
+	assert.Nil(t, search(t, ix, "programming", SearchOptions{}))
+	assert.Equal(t, 2, ix.Len())
+}
+
+func TestIndexSnippets(t *testing.T) {
+	ix := newTestIndex(t)
+	q, _ := ParseQuery("go")
+	result, err := ix.Search(q, SearchOptions{Snippets: 3, Read: func(filePath string) ([]byte, error) {
+		return []byte("Go is a programming language.\nGo programs are fast and go is simple."), nil
+	}})
+	if assert.NoError(t, err) && assert.Equal(t, 1, result.TotalHits) {
+		assert.Equal(t, []Snippet{
+			{Line: 1, Text: "<mark>Go</mark> is a programming language."},
+			{Line: 2, Text: "<mark>Go</mark> programs are fast and <mark>go</mark> is simple."},
+		}, result.Results[0].Snippets)
+	}
+}
+
+func TestSnippetEscaped(t *testing.T) {
+	content := []byte(`<script>alert("x")</script> needle & co`)
+	s := snippets(content, []int{4}, 1)
+	if assert.Equal(t, 1, len(s)) {
+		assert.Equal(t, "&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; <mark>needle</mark> &amp; co", s[0].Text)
+	}
+}
+
+func TestLongLineSnippet(t *testing.T) {
+	line := ""
+	for i := 0; i < 50; i++ {
+		line += "word "
+	}
+	content := []byte(line + "needle " + line)
+	s := snippets(content, []int{50}, 1)
+	if assert.Equal(t, 1, len(s)) {
+		assert.Contains(t, s[0].Text, "<mark>needle</mark>")
+		assert.True(t, len(s[0].Text) < 250)
+	}
+}
@@ -0,0 +1,212 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Query is a parsed search query.
+//
+// Words are terms, double quoted words are phrases and a word ending with '*' is a prefix.
+// Terms are combined with AND (the default between two terms), OR and NOT, which are only
+// operators when written in upper case, a term preceded by '-' is negated and parentheses group terms.
+type Query struct {
+	root node
+}
+
+// ParseQuery parses a query, see Query for the syntax
+func ParseQuery(query string) (Query, error) {
+	items, err := lexQuery(query)
+	if err != nil {
+		return Query{}, err
+	}
+	if len(items) == 0 {
+		return Query{}, fmt.Errorf("empty query")
+	}
+
+	p := &parser{items: items}
+	root, err := p.parseOr()
+	if err != nil {
+		return Query{}, err
+	}
+	if p.pos < len(p.items) {
+		return Query{}, fmt.Errorf("unexpected '%s'", p.items[p.pos].text)
+	}
+	return Query{root: root}, nil
+}
+
+type itemKind int
+
+const (
+	itemWord itemKind = iota
+	itemPhrase
+	itemOpen
+	itemClose
+	itemMinus
+)
+
+type item struct {
+	kind itemKind
+	text string
+}
+
+func lexQuery(query string) ([]item, error) {
+	var items []item
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			items = append(items, item{itemOpen, "("})
+			i++
+		case r == ')':
+			items = append(items, item{itemClose, ")"})
+			i++
+		case r == '-':
+			items = append(items, item{itemMinus, "-"})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated phrase")
+			}
+			items = append(items, item{itemPhrase, string(runes[i+1 : end])})
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune(`()"`, runes[end]) {
+				end++
+			}
+			items = append(items, item{itemWord, string(runes[i:end])})
+			i = end
+		}
+	}
+	return items, nil
+}
+
+// parser is a recursive descent parser, NOT binds tighter than AND which binds tighter than OR
+type parser struct {
+	items []item
+	pos   int
+}
+
+func (p *parser) peek() (item, bool) {
+	if p.pos < len(p.items) {
+		return p.items[p.pos], true
+	}
+	return item{}, false
+}
+
+func (p *parser) isOperator(operator string) bool {
+	it, ok := p.peek()
+	return ok && it.kind == itemWord && it.text == operator
+}
+
+func (p *parser) parseOr() (node, error) {
+	children := []node{}
+	for {
+		child, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+		if !p.isOperator("OR") {
+			break
+		}
+		p.pos++
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return &orNode{children}, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	children := []node{}
+	for {
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+
+		if p.isOperator("AND") {
+			p.pos++
+			continue
+		}
+		it, ok := p.peek()
+		if !ok || it.kind == itemClose || p.isOperator("OR") {
+			break
+		}
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return &andNode{children}, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	it, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+	if it.kind == itemMinus || (it.kind == itemWord && it.text == "NOT") {
+		p.pos++
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{child}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	it, _ := p.peek()
+	p.pos++
+	switch it.kind {
+	case itemOpen:
+		child, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing, ok := p.peek(); !ok || closing.kind != itemClose {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		p.pos++
+		return child, nil
+	case itemPhrase:
+		return newPhraseNode(it.text)
+	case itemWord:
+		if it.text == "AND" || it.text == "OR" {
+			return nil, fmt.Errorf("unexpected '%s'", it.text)
+		}
+		if strings.HasSuffix(it.text, "*") {
+			terms := tokenTerms(tokenize([]byte(strings.TrimRight(it.text, "*"))))
+			if len(terms) != 1 {
+				return nil, fmt.Errorf("invalid prefix '%s'", it.text)
+			}
+			return &prefixNode{terms[0]}, nil
+		}
+		// Words made of several tokens, such as "e-mail", are phrases
+		return newPhraseNode(it.text)
+	}
+	return nil, fmt.Errorf("unexpected '%s'", it.text)
+}
+
+func newPhraseNode(text string) (node, error) {
+	terms := tokenTerms(tokenize([]byte(text)))
+	switch len(terms) {
+	case 0:
+		return nil, fmt.Errorf("'%s' contains no word", text)
+	case 1:
+		return &termNode{terms[0]}, nil
+	}
+	return &phraseNode{terms}, nil
+}
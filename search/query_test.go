@@ -0,0 +1,27 @@
+package search
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	query, err := ParseQuery(`go AND (fast OR "very quick") -slow`)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &andNode{[]node{
+			&termNode{"go"},
+			&orNode{[]node{&termNode{"fast"}, &phraseNode{[]string{"very", "quick"}}}},
+			&notNode{&termNode{"slow"}},
+		}}, query.root)
+	}
+
+	query, err = ParseQuery(`Program* OR e-mail`)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &orNode{[]node{&prefixNode{"program"}, &phraseNode{[]string{"e", "mail"}}}}, query.root)
+	}
+
+	for _, invalid := range []string{"", `"open`, "(go", "go)", "go OR", "AND go", "!!!", "*"} {
+		_, err := ParseQuery(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
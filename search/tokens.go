@@ -0,0 +1,56 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// token is a word of a file, terms are the lower case words, offsets are in bytes
+// and lines start at 1
+type token struct {
+	term  string
+	start int
+	end   int
+	line  int
+}
+
+// tokenize splits the content into words made of letters and digits
+func tokenize(content []byte) []token {
+	var tokens []token
+	line := 1
+	start := -1
+	for i := 0; i < len(content); {
+		r, size := utf8.DecodeRune(content[i:])
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+		} else {
+			if start >= 0 {
+				tokens = append(tokens, newToken(content, start, i, line))
+				start = -1
+			}
+			if r == '\n' {
+				line++
+			}
+		}
+		i += size
+	}
+	if start >= 0 {
+		tokens = append(tokens, newToken(content, start, len(content), line))
+	}
+	return tokens
+}
+
+func newToken(content []byte, start int, end int, line int) token {
+	return token{term: strings.ToLower(string(content[start:end])), start: start, end: end, line: line}
+}
+
+func tokenTerms(tokens []token) []string {
+	terms := make([]string, len(tokens))
+	for i, t := range tokens {
+		terms[i] = t.term
+	}
+	return terms
+}
@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// BlobStore stores the content of the files once, in blobs named after the SHA-256 of their content.
+// Every file is a hard link to its blob, so the blob root must be on the same file system as the files,
+// and the number of links of a blob minus one is the number of files referencing it.
+//
+// Blobs are read-only, the files are never modified in place: replacing a file links it to another blob.
+// Blobs no longer referenced by any file are removed by CollectGarbage.
+type BlobStore struct {
+	root string
+	// Held for reading from finding a blob to linking a file to it, and for writing by the garbage
+	// collection, which would otherwise remove a blob about to be linked
+	gc sync.RWMutex
+}
+
+// GarbageCollection is the result of a garbage collection
+type GarbageCollection struct {
+	BlobCount      int   `json:"blobCount"`
+	RemovedBlobs   int   `json:"removedBlobs"`
+	ReclaimedBytes int64 `json:"reclaimedBytes"`
+}
+
+// BlobStats describes the blobs of a blob store
+type BlobStats struct {
+	BlobCount       int   `json:"blobCount"`
+	ReferenceCount  int   `json:"referenceCount"`
+	StoredBytes     int64 `json:"storedBytes"`
+	ReferencedBytes int64 `json:"referencedBytes"`
+}
+
+func NewBlobStore(root string) (*BlobStore, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &BlobStore{root: root}, nil
+}
+
+// BlobPath returns the path of the blob of a content hash, blobs are spread in 256 directories
+func (s *BlobStore) BlobPath(hash string) string {
+	return filepath.Join(s.root, hash[:2], hash)
+}
+
+// writeBlob writes the blob of the content unless it already exists and returns its path
+func (s *BlobStore) writeBlob(content []byte) (string, error) {
+	sum := sha256.Sum256(content)
+	blobPath := s.BlobPath(hex.EncodeToString(sum[:]))
+	if _, err := os.Stat(blobPath); err == nil {
+		return blobPath, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(blobPath), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(blobPath), "blob")
+	if err != nil {
+		return "", err
+	}
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0444)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), blobPath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return blobPath, nil
+}
+
+func (s *BlobStore) Create(filePath string, content []byte) error {
+	s.gc.RLock()
+	defer s.gc.RUnlock()
+	blobPath, err := s.writeBlob(content)
+	if err != nil {
+		return err
+	}
+	return os.Link(blobPath, filePath)
+}
+
+// Replace links a tmp file to the new blob before renaming it to the file
+func (s *BlobStore) Replace(filePath string, content []byte) error {
+	s.gc.RLock()
+	defer s.gc.RUnlock()
+	blobPath, err := s.writeBlob(content)
+	if err != nil {
+		return err
+	}
+	return replaceWithLink(blobPath, filePath)
+}
+
+func (s *BlobStore) Read(filePath string) ([]byte, error) {
+	return ioutil.ReadFile(filePath)
+}
+
+func (s *BlobStore) Remove(filePath string) error {
+	return os.Remove(filePath)
+}
+
+// Copy only links the destination to the blob of the source, files written before the blob store
+// was enabled are added to it first
+func (s *BlobStore) Copy(sourcePath string, destinationPath string) error {
+	s.gc.RLock()
+	defer s.gc.RUnlock()
+	blobPath, err := s.blobOf(sourcePath)
+	if err != nil {
+		return err
+	}
+	return os.Link(blobPath, destinationPath)
+}
+
+// Move keeps the file linked to its blob
+func (s *BlobStore) Move(sourcePath string, destinationPath string) error {
+	return moveFile(sourcePath, destinationPath)
+}
+
+// blobOf returns the blob of a file, moving its content to a blob if needed
+func (s *BlobStore) blobOf(filePath string) (string, error) {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	blobPath, err := s.writeBlob(content)
+	if err != nil {
+		return "", err
+	}
+
+	fi, err := os.Stat(filePath)
+	if err != nil {
+		return "", err
+	}
+	blob, err := os.Stat(blobPath)
+	if err != nil {
+		return "", err
+	}
+	if !os.SameFile(fi, blob) {
+		if err := replaceWithLink(blobPath, filePath); err != nil {
+			return "", err
+		}
+	}
+	return blobPath, nil
+}
+
+// CollectGarbage removes the blobs no file links to anymore, the files are neither created, replaced
+// nor copied meanwhile
+func (s *BlobStore) CollectGarbage() (GarbageCollection, error) {
+	s.gc.Lock()
+	defer s.gc.Unlock()
+	var gc GarbageCollection
+	err := s.walkBlobs(func(blobPath string, fi os.FileInfo, links int) error {
+		gc.BlobCount++
+		if links != 1 {
+			return nil
+		}
+		if err := os.Remove(blobPath); err != nil {
+			return err
+		}
+		gc.RemovedBlobs++
+		gc.ReclaimedBytes += fi.Size()
+		return nil
+	})
+	return gc, err
+}
+
+// Stats counts the blobs and the files referencing them
+func (s *BlobStore) Stats() (BlobStats, error) {
+	var stats BlobStats
+	err := s.walkBlobs(func(blobPath string, fi os.FileInfo, links int) error {
+		stats.BlobCount++
+		stats.StoredBytes += fi.Size()
+		if links > 1 {
+			stats.ReferenceCount += links - 1
+			stats.ReferencedBytes += fi.Size() * int64(links-1)
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// walkBlobs calls fn for every blob with its number of links, the blobs whose number of links
+// can't be known on this platform are ignored
+func (s *BlobStore) walkBlobs(fn func(blobPath string, fi os.FileInfo, links int) error) error {
+	dirs, err := ioutil.ReadDir(s.root)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		blobs, err := ioutil.ReadDir(filepath.Join(s.root, dir.Name()))
+		if err != nil {
+			return err
+		}
+		for _, blob := range blobs {
+			links, ok := linkCount(blob)
+			if !blob.Mode().IsRegular() || len(blob.Name()) != sha256.Size*2 || !ok {
+				continue
+			}
+			if err := fn(filepath.Join(s.root, dir.Name(), blob.Name()), blob, links); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// replaceWithLink replaces the file by a hard link to the blob atomically
+func replaceWithLink(blobPath string, filePath string) error {
+	// Renaming a link over another link to the same blob does nothing and would leave the tmp file
+	if fi, err := os.Stat(filePath); err == nil {
+		if blob, err := os.Stat(blobPath); err == nil && os.SameFile(fi, blob) {
+			return nil
+		}
+	}
+
+	tmpPath := fmt.Sprintf("%s.%d.tmp", filePath, os.Getpid())
+	if err := os.Link(blobPath, tmpPath); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
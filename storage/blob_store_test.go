@@ -0,0 +1,119 @@
+// +build !windows
+
+package storage
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBlobStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewBlobStore(filepath.Join(dir, ".blobs"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Files with the same content share their blob
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	c := filepath.Join(dir, "c.txt")
+	assert.NoError(t, s.Create(a, []byte("Hello, World!")))
+	assert.NoError(t, s.Create(b, []byte("Hello, World!")))
+	assert.NoError(t, s.Copy(a, c))
+	assert.Error(t, s.Copy(a, b))
+
+	stats, err := s.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, BlobStats{BlobCount: 1, ReferenceCount: 3, StoredBytes: 13, ReferencedBytes: 39}, stats)
+
+	// Replacing a file doesn't modify the other files sharing its blob
+	assert.NoError(t, s.Replace(a, []byte("New Content")))
+	assert.NoError(t, s.Replace(a, []byte("New Content")))
+	content, err := s.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello, World!", string(content))
+	content, err = s.Read(a)
+	assert.NoError(t, err)
+	assert.Equal(t, "New Content", string(content))
+	entries, _ := ioutil.ReadDir(dir)
+	assert.Equal(t, 4, len(entries))
+
+	// Blobs are removed once no file links to them
+	assert.NoError(t, s.Remove(b))
+	assert.NoError(t, s.Remove(c))
+	gc, err := s.CollectGarbage()
+	assert.NoError(t, err)
+	assert.Equal(t, GarbageCollection{BlobCount: 2, RemovedBlobs: 1, ReclaimedBytes: 13}, gc)
+
+	stats, err = s.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, BlobStats{BlobCount: 1, ReferenceCount: 1, StoredBytes: 11, ReferencedBytes: 11}, stats)
+}
+
+func TestBlobStoreConcurrentGarbageCollection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewBlobStore(filepath.Join(dir, ".blobs"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The blob of a file removed is collected while the next file is linked to it
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5000; i++ {
+			filePath := filepath.Join(dir, fmt.Sprintf("%d.txt", i))
+			if !assert.NoError(t, s.Create(filePath, []byte("Hello, World!"))) {
+				return
+			}
+			assert.NoError(t, s.Remove(filePath))
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+			_, err := s.CollectGarbage()
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func TestBlobStoreCopyPlainFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewBlobStore(filepath.Join(dir, ".blobs"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Files written before the blob store was enabled are moved to a blob when copied
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	assert.NoError(t, ioutil.WriteFile(a, []byte("Hello, World!"), 0644))
+	assert.NoError(t, s.Copy(a, b))
+
+	stats, err := s.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.BlobCount)
+	assert.Equal(t, 2, stats.ReferenceCount)
+}
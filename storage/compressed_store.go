@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Compression algorithms
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// A compressed file starts with the magic, the algorithm and the size of its content.
+// Text files never start with a NUL byte, so the files written before the compression
+// was enabled are told apart and read as they are.
+var compressionMagic = []byte("\x00WSC")
+
+const compressionHeaderSize = 4 + 1 + 8
+
+var compressionMethods = map[string]byte{
+	CompressionGzip: 'g',
+	CompressionZstd: 'z',
+}
+
+// CompressedStore compresses the content of the files before handing them to another store,
+// and decompresses them when they are read
+type CompressedStore struct {
+	Store
+	algorithm string
+	encoder   *zstd.Encoder
+	decoder   *zstd.Decoder
+}
+
+func NewCompressedStore(inner Store, algorithm string) (*CompressedStore, error) {
+	if _, ok := compressionMethods[algorithm]; !ok {
+		return nil, fmt.Errorf("unknown compression algorithm %s, expect gzip or zstd", algorithm)
+	}
+
+	// Both are safe for concurrent use with EncodeAll and DecodeAll
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &CompressedStore{Store: inner, algorithm: algorithm, encoder: encoder, decoder: decoder}, nil
+}
+
+// Inner returns the store keeping the compressed files
+func (s *CompressedStore) Inner() Store {
+	return s.Store
+}
+
+func (s *CompressedStore) Create(filePath string, content []byte) error {
+	compressed, err := s.compress(content)
+	if err != nil {
+		return err
+	}
+	return s.Store.Create(filePath, compressed)
+}
+
+func (s *CompressedStore) Replace(filePath string, content []byte) error {
+	compressed, err := s.compress(content)
+	if err != nil {
+		return err
+	}
+	return s.Store.Replace(filePath, compressed)
+}
+
+func (s *CompressedStore) Read(filePath string) ([]byte, error) {
+	b, err := s.Store.Read(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return s.decompress(b)
+}
+
+// Open opens a file to read its content, decompressed on the fly
+func (s *CompressedStore) Open(filePath string) (io.ReadCloser, error) {
+	file, err := Open(s.Store, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(file)
+	header, _ := r.Peek(compressionHeaderSize)
+	method, _, ok := parseCompressionHeader(header)
+	if !ok {
+		return &compressedReader{Reader: r, file: file}, nil
+	}
+	r.Discard(compressionHeaderSize)
+
+	switch method {
+	case compressionMethods[CompressionGzip]:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &compressedReader{Reader: gz, closer: gz, file: file}, nil
+	case compressionMethods[CompressionZstd]:
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &compressedReader{Reader: zr, closer: zr.IOReadCloser(), file: file}, nil
+	}
+	file.Close()
+	return nil, fmt.Errorf("unknown compression method %q in file %s", method, filePath)
+}
+
+// ContentSize returns the size of the content of a file, read from the header of the compressed files
+func (s *CompressedStore) ContentSize(filePath string, fi os.FileInfo) (int64, error) {
+	storedSize, err := ContentSize(s.Store, filePath, fi)
+	if err != nil || storedSize < compressionHeaderSize {
+		return storedSize, err
+	}
+
+	file, err := Open(s.Store, filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	header := make([]byte, compressionHeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return 0, err
+	}
+	if _, size, ok := parseCompressionHeader(header); ok {
+		return size, nil
+	}
+	return storedSize, nil
+}
+
+// compress returns the content as it is if it doesn't get smaller,
+// unless it would be mistaken for a compressed file
+func (s *CompressedStore) compress(content []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(compressionMagic)
+	buf.WriteByte(compressionMethods[s.algorithm])
+	binary.Write(&buf, binary.LittleEndian, uint64(len(content)))
+
+	if s.algorithm == CompressionZstd {
+		buf.Write(s.encoder.EncodeAll(content, nil))
+	} else {
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(content); err != nil {
+			return nil, err
+		}
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if buf.Len() >= len(content) && !bytes.HasPrefix(content, compressionMagic) {
+		return content, nil
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *CompressedStore) decompress(b []byte) ([]byte, error) {
+	method, size, ok := parseCompressionHeader(b)
+	if !ok {
+		return b, nil
+	}
+	payload := b[compressionHeaderSize:]
+
+	var content []byte
+	var err error
+	switch method {
+	case compressionMethods[CompressionGzip]:
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(bytes.NewReader(payload)); err == nil {
+			content, err = ioutil.ReadAll(gz)
+		}
+	case compressionMethods[CompressionZstd]:
+		content, err = s.decoder.DecodeAll(payload, nil)
+	default:
+		err = fmt.Errorf("unknown compression method %q", method)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) != size {
+		return nil, fmt.Errorf("corrupted compressed file, expect %d bytes, got %d", size, len(content))
+	}
+	return content, nil
+}
+
+func parseCompressionHeader(header []byte) (byte, int64, bool) {
+	if len(header) < compressionHeaderSize || !bytes.HasPrefix(header, compressionMagic) {
+		return 0, 0, false
+	}
+	size := binary.LittleEndian.Uint64(header[len(compressionMagic)+1:])
+	return header[len(compressionMagic)], int64(size), true
+}
+
+// compressedReader closes both the decompressor and the file
+type compressedReader struct {
+	io.Reader
+	closer io.Closer
+	file   io.Closer
+}
+
+func (r *compressedReader) Close() error {
+	if r.closer != nil {
+		r.closer.Close()
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompressedStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = NewCompressedStore(NewFileStore(), "lzma")
+	assert.Error(t, err)
+
+	text := strings.Repeat("All work and no play makes Jack a dull boy.\n", 100)
+	for _, algorithm := range []string{CompressionGzip, CompressionZstd} {
+		s, err := NewCompressedStore(NewFileStore(), algorithm)
+		if !assert.NoError(t, err) {
+			return
+		}
+		filePath := filepath.Join(dir, algorithm+".txt")
+		copyPath := filepath.Join(dir, algorithm+"-copy.txt")
+
+		// The file is smaller on disk, but reads the same
+		assert.NoError(t, s.Create(filePath, []byte(text)))
+		fi, err := os.Stat(filePath)
+		assert.NoError(t, err)
+		assert.True(t, fi.Size() < int64(len(text)), algorithm)
+		content, err := s.Read(filePath)
+		assert.NoError(t, err)
+		assert.Equal(t, text, string(content))
+
+		size, err := s.ContentSize(filePath, fi)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(text)), size)
+
+		r, err := s.Open(filePath)
+		if assert.NoError(t, err) {
+			content, err = ioutil.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, text, string(content))
+			assert.NoError(t, r.Close())
+		}
+
+		assert.NoError(t, s.Replace(filePath, []byte(text+text)))
+		assert.NoError(t, s.Copy(filePath, copyPath))
+		content, err = s.Read(copyPath)
+		assert.NoError(t, err)
+		assert.Equal(t, text+text, string(content))
+	}
+}
+
+func TestCompressedStorePlainFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewCompressedStore(NewFileStore(), CompressionGzip)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Files written before the compression was enabled, or too small to shrink, are kept as they are
+	plainPath := filepath.Join(dir, "plain.txt")
+	assert.NoError(t, ioutil.WriteFile(plainPath, []byte("Hello, World!"), 0644))
+	smallPath := filepath.Join(dir, "small.txt")
+	assert.NoError(t, s.Create(smallPath, []byte("Hi")))
+	for _, filePath := range []string{plainPath, smallPath} {
+		b, err := ioutil.ReadFile(filePath)
+		assert.NoError(t, err)
+		content, err := s.Read(filePath)
+		assert.NoError(t, err)
+		assert.Equal(t, b, content)
+
+		fi, err := os.Stat(filePath)
+		assert.NoError(t, err)
+		size, err := s.ContentSize(filePath, fi)
+		assert.NoError(t, err)
+		assert.Equal(t, fi.Size(), size)
+	}
+
+	// A content looking like a compressed file is always compressed
+	magicPath := filepath.Join(dir, "magic.bin")
+	assert.NoError(t, s.Create(magicPath, compressionMagic))
+	content, err := s.Read(magicPath)
+	assert.NoError(t, err)
+	assert.Equal(t, compressionMagic, content)
+
+	// A truncated file is detected
+	truncatedPath := filepath.Join(dir, "truncated.txt")
+	assert.NoError(t, s.Create(truncatedPath, []byte(strings.Repeat("a", 1000))))
+	b, err := ioutil.ReadFile(truncatedPath)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(truncatedPath, b[:len(b)-4], 0644))
+	_, err = s.Read(truncatedPath)
+	assert.Error(t, err)
+}
@@ -0,0 +1,402 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// An encrypted file starts with the magic, the id of the master key wrapping its data key and the wrapped
+// data key, followed by the content encrypted with the data key. Rotating the master key only rewraps
+// the data key, the encrypted content is left as it is.
+//
+// The content is authenticated along with the absolute path of the file, so the content of a file put in
+// place of another one fails to decrypt.
+var encryptionMagic = []byte("\x00WSE")
+
+const (
+	dataKeySize  = 32
+	gcmNonceSize = 12
+	gcmTagSize   = 16
+	// Wrapped data key, with its nonce and tag
+	wrappedKeySize = gcmNonceSize + dataKeySize + gcmTagSize
+)
+
+// Outcomes of a rewrap
+const (
+	RewrapUnchanged = "unchanged"
+	RewrapRewrapped = "rewrapped"
+	RewrapEncrypted = "encrypted"
+)
+
+// KeyRing holds the master keys of a keyfile, the data keys are wrapped by the active one
+type KeyRing struct {
+	keys   map[string]cipher.AEAD
+	active string
+}
+
+// LoadKeyFile reads a keyfile, every line is the id of a master key followed by the base64 encoding
+// of its 32 bytes, empty lines and lines starting with # are ignored. The last key is the active one,
+// so a key is rotated by appending a new one, the previous ones are still needed to read the files
+// they wrap until they are rewrapped.
+func LoadKeyFile(keyFile string) (*KeyRing, error) {
+	file, err := os.Open(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ring := &KeyRing{keys: make(map[string]cipher.AEAD)}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 || len(fields[0]) > 255 {
+			return nil, fmt.Errorf("invalid key at line %d of %s, expect an id and a base64 key", line, keyFile)
+		}
+		if _, ok := ring.keys[fields[0]]; ok {
+			return nil, fmt.Errorf("duplicate key %s at line %d of %s", fields[0], line, keyFile)
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(key) != dataKeySize {
+			return nil, fmt.Errorf("invalid key %s at line %d of %s, expect 32 base64 encoded bytes",
+				fields[0], line, keyFile)
+		}
+		if ring.keys[fields[0]], err = newGCM(key); err != nil {
+			return nil, err
+		}
+		ring.active = fields[0]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if ring.active == "" {
+		return nil, fmt.Errorf("no key in %s", keyFile)
+	}
+	return ring, nil
+}
+
+// ActiveKey returns the id of the master key wrapping the new data keys
+func (r *KeyRing) ActiveKey() string {
+	return r.active
+}
+
+// wrap returns the header of a file whose content is encrypted with the data key
+func (r *KeyRing) wrap(dataKey []byte) ([]byte, error) {
+	header := append([]byte{}, encryptionMagic...)
+	header = append(header, byte(len(r.active)))
+	header = append(header, r.active...)
+
+	nonce := make([]byte, gcmNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	// The header is authenticated, so the key id can't be tampered with
+	wrapped := r.keys[r.active].Seal(nonce, nonce, dataKey, header)
+	return append(header, wrapped...), nil
+}
+
+// unwrap returns the data key of an encrypted file and the length of its header
+func (r *KeyRing) unwrap(b []byte) ([]byte, int, error) {
+	keyID, n, ok := parseEncryptionHeader(b)
+	if !ok {
+		return nil, 0, fmt.Errorf("not an encrypted file")
+	}
+	master, ok := r.keys[keyID]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown master key %s", keyID)
+	}
+
+	header := b[:n-wrappedKeySize]
+	wrapped := b[n-wrappedKeySize : n]
+	dataKey, err := master.Open(nil, wrapped[:gcmNonceSize], wrapped[gcmNonceSize:], header)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to unwrap the data key with master key %s: %v", keyID, err)
+	}
+	return dataKey, n, nil
+}
+
+// parseEncryptionHeader returns the id of the master key and the length of the header of an encrypted file
+func parseEncryptionHeader(b []byte) (string, int, bool) {
+	if len(b) <= len(encryptionMagic) || !bytes.HasPrefix(b, encryptionMagic) {
+		return "", 0, false
+	}
+	idLength := int(b[len(encryptionMagic)])
+	n := len(encryptionMagic) + 1 + idLength + wrappedKeySize
+	if len(b) < n {
+		return "", 0, false
+	}
+	return string(b[len(encryptionMagic)+1 : len(encryptionMagic)+1+idLength]), n, true
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptedStore encrypts the content of the files with AES-256-GCM before handing them to another store,
+// every file with its own data key wrapped by a master key. The files written before the encryption
+// was enabled are read as they are. As the content is bound to the path of its file, the files are
+// copied and moved by encrypting their content again.
+type EncryptedStore struct {
+	Store
+	keyFile string
+	mu      sync.RWMutex
+	ring    *KeyRing
+	// The writes of a file are serialised, so a rewrap doesn't undo a write
+	locks *PathLocks
+}
+
+func NewEncryptedStore(inner Store, keyFile string) (*EncryptedStore, error) {
+	ring, err := LoadKeyFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedStore{Store: inner, keyFile: keyFile, ring: ring, locks: NewPathLocks()}, nil
+}
+
+// Inner returns the store keeping the encrypted files
+func (s *EncryptedStore) Inner() Store {
+	return s.Store
+}
+
+// ReloadKeys reads the keyfile again, e.g. once a new master key has been appended to it
+func (s *EncryptedStore) ReloadKeys() error {
+	ring, err := LoadKeyFile(s.keyFile)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.ring = ring
+	s.mu.Unlock()
+	return nil
+}
+
+// ActiveKey returns the id of the master key wrapping the new data keys
+func (s *EncryptedStore) ActiveKey() string {
+	return s.keyRing().ActiveKey()
+}
+
+func (s *EncryptedStore) keyRing() *KeyRing {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ring
+}
+
+func (s *EncryptedStore) Create(filePath string, content []byte) error {
+	defer s.locks.Lock(filePath)()
+	encrypted, err := s.encrypt(filePath, content)
+	if err != nil {
+		return err
+	}
+	return s.Store.Create(filePath, encrypted)
+}
+
+func (s *EncryptedStore) Replace(filePath string, content []byte) error {
+	defer s.locks.Lock(filePath)()
+	encrypted, err := s.encrypt(filePath, content)
+	if err != nil {
+		return err
+	}
+	return s.Store.Replace(filePath, encrypted)
+}
+
+func (s *EncryptedStore) Read(filePath string) ([]byte, error) {
+	b, err := s.Store.Read(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return s.decrypt(filePath, b)
+}
+
+func (s *EncryptedStore) Remove(filePath string) error {
+	defer s.locks.Lock(filePath)()
+	return s.Store.Remove(filePath)
+}
+
+// Copy encrypts the content of the source again for the destination
+func (s *EncryptedStore) Copy(sourcePath string, destinationPath string) error {
+	defer s.locks.Lock(sourcePath, destinationPath)()
+	content, err := s.Read(sourcePath)
+	if err != nil {
+		return err
+	}
+	encrypted, err := s.encrypt(destinationPath, content)
+	if err != nil {
+		return err
+	}
+	return s.Store.Create(destinationPath, encrypted)
+}
+
+// Move encrypts the content of the source again for the destination, the files which aren't encrypted
+// are moved as they are
+func (s *EncryptedStore) Move(sourcePath string, destinationPath string) error {
+	defer s.locks.Lock(sourcePath, destinationPath)()
+	b, err := s.Store.Read(sourcePath)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(b, encryptionMagic) {
+		return s.Store.Move(sourcePath, destinationPath)
+	}
+
+	content, err := s.decrypt(sourcePath, b)
+	if err != nil {
+		return err
+	}
+	encrypted, err := s.encrypt(destinationPath, content)
+	if err != nil {
+		return err
+	}
+	if err := s.Store.Create(destinationPath, encrypted); err != nil {
+		return err
+	}
+	if err := s.Store.Remove(sourcePath); err != nil {
+		s.Store.Remove(destinationPath)
+		return err
+	}
+	return nil
+}
+
+// Open reads and decrypts the whole file, the content can't be authenticated before
+func (s *EncryptedStore) Open(filePath string) (io.ReadCloser, error) {
+	content, err := s.Read(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(content)), nil
+}
+
+// ContentSize returns the size of the content of a file, its size without the header, nonce and tag
+func (s *EncryptedStore) ContentSize(filePath string, fi os.FileInfo) (int64, error) {
+	storedSize, err := ContentSize(s.Store, filePath, fi)
+	if err != nil || storedSize <= int64(len(encryptionMagic)) {
+		return storedSize, err
+	}
+
+	file, err := Open(s.Store, filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	prefix := make([]byte, len(encryptionMagic)+1)
+	if _, err := io.ReadFull(file, prefix); err != nil {
+		return 0, err
+	}
+	if !bytes.HasPrefix(prefix, encryptionMagic) {
+		return storedSize, nil
+	}
+	overhead := int64(len(prefix)) + int64(prefix[len(encryptionMagic)]) + wrappedKeySize + gcmNonceSize + gcmTagSize
+	if storedSize < overhead {
+		return 0, fmt.Errorf("truncated encrypted file %s", filePath)
+	}
+	return storedSize - overhead, nil
+}
+
+// Rewrap wraps the data key of a file with the active master key, the content is left as it is.
+// The files which aren't encrypted yet are encrypted.
+func (s *EncryptedStore) Rewrap(filePath string) (string, error) {
+	defer s.locks.Lock(filePath)()
+	b, err := s.Store.Read(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	ring := s.keyRing()
+	keyID, _, ok := parseEncryptionHeader(b)
+	if !ok {
+		encrypted, err := s.encrypt(filePath, b)
+		if err == nil {
+			err = s.Store.Replace(filePath, encrypted)
+		}
+		return RewrapEncrypted, err
+	}
+	if keyID == ring.active {
+		return RewrapUnchanged, nil
+	}
+
+	dataKey, n, err := ring.unwrap(b)
+	if err != nil {
+		return "", err
+	}
+	header, err := ring.wrap(dataKey)
+	if err != nil {
+		return "", err
+	}
+	if err := s.Store.Replace(filePath, append(header, b[n:]...)); err != nil {
+		return "", err
+	}
+	return RewrapRewrapped, nil
+}
+
+// contentData returns the additional data the content of a file is authenticated with, its absolute path
+func contentData(filePath string) []byte {
+	if absolute, err := filepath.Abs(filePath); err == nil {
+		filePath = absolute
+	}
+	return append(append([]byte{}, encryptionMagic...), filepath.Clean(filePath)...)
+}
+
+func (s *EncryptedStore) encrypt(filePath string, content []byte) ([]byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.keyRing().wrap(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcmNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	b = append(b, nonce...)
+	return aead.Seal(b, nonce, content, contentData(filePath)), nil
+}
+
+func (s *EncryptedStore) decrypt(filePath string, b []byte) ([]byte, error) {
+	if _, _, ok := parseEncryptionHeader(b); !ok {
+		return b, nil
+	}
+	dataKey, n, err := s.keyRing().unwrap(b)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	b = b[n:]
+	if len(b) < gcmNonceSize+gcmTagSize {
+		return nil, fmt.Errorf("truncated encrypted file")
+	}
+	content, err := aead.Open(nil, b[:gcmNonceSize], b[gcmNonceSize:], contentData(filePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the file: %v", err)
+	}
+	return content, nil
+}
@@ -0,0 +1,292 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func appendKey(t *testing.T, keyFile string, keyID string) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	file, err := os.OpenFile(keyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if assert.NoError(t, err) {
+		file.WriteString(keyID + " " + base64.StdEncoding.EncodeToString(key) + "\n")
+		file.Close()
+	}
+}
+
+func TestLoadKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "keys")
+	_, err = LoadKeyFile(keyFile)
+	assert.Error(t, err)
+
+	for _, invalid := range []string{"", "# comment only\n", "k1\n", "k1 c2hvcnQ=\n", "k1 not-base64\n"} {
+		assert.NoError(t, ioutil.WriteFile(keyFile, []byte(invalid), 0600))
+		_, err = LoadKeyFile(keyFile)
+		assert.Error(t, err, invalid)
+	}
+
+	assert.NoError(t, ioutil.WriteFile(keyFile, []byte("# master keys\n\n"), 0600))
+	appendKey(t, keyFile, "k1")
+	appendKey(t, keyFile, "k2")
+	ring, err := LoadKeyFile(keyFile)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "k2", ring.ActiveKey())
+	}
+
+	appendKey(t, keyFile, "k1")
+	_, err = LoadKeyFile(keyFile)
+	assert.Error(t, err)
+}
+
+func TestEncryptedStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "keys")
+	appendKey(t, keyFile, "k1")
+	s, err := NewEncryptedStore(NewFileStore(), keyFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The content isn't on disk in clear, but reads the same
+	secret := "The password is swordfish."
+	filePath := filepath.Join(dir, "secret.txt")
+	assert.NoError(t, s.Create(filePath, []byte(secret)))
+	b, err := ioutil.ReadFile(filePath)
+	assert.NoError(t, err)
+	assert.False(t, bytes.Contains(b, []byte("swordfish")))
+	content, err := s.Read(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, secret, string(content))
+
+	fi, err := os.Stat(filePath)
+	assert.NoError(t, err)
+	size, err := s.ContentSize(filePath, fi)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(secret)), size)
+
+	r, err := s.Open(filePath)
+	if assert.NoError(t, err) {
+		content, _ = ioutil.ReadAll(r)
+		r.Close()
+		assert.Equal(t, secret, string(content))
+	}
+
+	// Every file has its own data key
+	copyPath := filepath.Join(dir, "copy.txt")
+	assert.NoError(t, s.Create(copyPath, []byte(secret)))
+	other, _ := ioutil.ReadFile(copyPath)
+	assert.NotEqual(t, b, other)
+
+	// A tampered file is detected
+	tampered := append([]byte{}, b...)
+	tampered[len(tampered)-1] ^= 1
+	assert.NoError(t, ioutil.WriteFile(copyPath, tampered, 0644))
+	_, err = s.Read(copyPath)
+	assert.Error(t, err)
+}
+
+func TestEncryptedStoreRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "keys")
+	appendKey(t, keyFile, "k1")
+	s, err := NewEncryptedStore(NewFileStore(), keyFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	filePath := filepath.Join(dir, "a.txt")
+	plainPath := filepath.Join(dir, "plain.txt")
+	assert.NoError(t, s.Create(filePath, []byte("encrypted with k1")))
+	assert.NoError(t, ioutil.WriteFile(plainPath, []byte("written in clear"), 0644))
+	encrypted, _ := ioutil.ReadFile(filePath)
+
+	outcome, err := s.Rewrap(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, RewrapUnchanged, outcome)
+
+	// Only the wrapped data key changes
+	appendKey(t, keyFile, "k2")
+	assert.NoError(t, s.ReloadKeys())
+	assert.Equal(t, "k2", s.ActiveKey())
+	outcome, err = s.Rewrap(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, RewrapRewrapped, outcome)
+	rewrapped, _ := ioutil.ReadFile(filePath)
+	assert.Equal(t, encrypted[len(encrypted)-40:], rewrapped[len(rewrapped)-40:])
+
+	outcome, err = s.Rewrap(plainPath)
+	assert.NoError(t, err)
+	assert.Equal(t, RewrapEncrypted, outcome)
+
+	// The previous key is no longer needed
+	b, _ := ioutil.ReadFile(keyFile)
+	lines := strings.SplitAfter(string(b), "\n")
+	assert.NoError(t, ioutil.WriteFile(keyFile, []byte(lines[1]), 0600))
+	assert.NoError(t, s.ReloadKeys())
+	content, err := s.Read(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "encrypted with k1", string(content))
+	content, err = s.Read(plainPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "written in clear", string(content))
+}
+
+func TestCompressedEncryptedStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "keys")
+	appendKey(t, keyFile, "k1")
+	encryptedStore, err := NewEncryptedStore(NewFileStore(), keyFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+	s, err := NewCompressedStore(encryptedStore, CompressionGzip)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, encryptedStore, Unwrap(s))
+	assert.IsType(t, &FileStore{}, Underlying(s))
+
+	text := strings.Repeat("Compressed, then encrypted. ", 100)
+	filePath := filepath.Join(dir, "a.txt")
+	assert.NoError(t, s.Create(filePath, []byte(text)))
+	fi, err := os.Stat(filePath)
+	assert.NoError(t, err)
+	assert.True(t, fi.Size() < int64(len(text)))
+
+	size, err := ContentSize(s, filePath, fi)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(text)), size)
+	r, err := Open(s, filePath)
+	if assert.NoError(t, err) {
+		content, _ := ioutil.ReadAll(r)
+		r.Close()
+		assert.Equal(t, text, string(content))
+	}
+}
+
+func TestEncryptedStorePaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "keys")
+	appendKey(t, keyFile, "k1")
+	s, err := NewEncryptedStore(NewFileStore(), keyFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+	a, b, c := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt"), filepath.Join(dir, "c.txt")
+	assert.NoError(t, s.Create(a, []byte("content of a")))
+	assert.NoError(t, s.Create(b, []byte("content of b")))
+
+	// The content of a file put in place of another one doesn't decrypt
+	encrypted, _ := ioutil.ReadFile(a)
+	assert.NoError(t, ioutil.WriteFile(b, encrypted, 0644))
+	_, err = s.Read(b)
+	assert.Error(t, err)
+
+	// The files copied or moved by the store are encrypted for their new path
+	assert.NoError(t, s.Remove(b))
+	assert.NoError(t, s.Copy(a, b))
+	assert.NoError(t, s.Move(a, c))
+	for _, filePath := range []string{b, c} {
+		content, err := s.Read(filePath)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "content of a", string(content))
+		}
+	}
+	_, err = os.Stat(a)
+	assert.True(t, os.IsNotExist(err))
+
+}
+
+// blockingStore blocks the reads until it's released
+type blockingStore struct {
+	Store
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStore) Read(filePath string) ([]byte, error) {
+	s.read <- struct{}{}
+	<-s.release
+	return s.Store.Read(filePath)
+}
+
+func TestEncryptedStoreConcurrentRewrap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "keys")
+	appendKey(t, keyFile, "k1")
+	inner := &blockingStore{Store: NewFileStore(), read: make(chan struct{}), release: make(chan struct{})}
+	s, err := NewEncryptedStore(inner, keyFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+	filePath := filepath.Join(dir, "a.txt")
+	assert.NoError(t, s.Create(filePath, []byte("first")))
+	appendKey(t, keyFile, "k2")
+	assert.NoError(t, s.ReloadKeys())
+
+	// A replace while the file is being rewrapped waits for the rewrap, instead of being undone by it
+	rewrapped := make(chan error)
+	go func() {
+		_, err := s.Rewrap(filePath)
+		rewrapped <- err
+	}()
+	<-inner.read
+	replaced := make(chan error)
+	go func() {
+		replaced <- s.Replace(filePath, []byte("second"))
+	}()
+	select {
+	case <-replaced:
+		t.Error("the file is replaced while it's rewrapped")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(inner.release)
+	assert.NoError(t, <-rewrapped)
+	assert.NoError(t, <-replaced)
+
+	go func() { <-inner.read }()
+	content, err := s.Read(filePath)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "second", string(content))
+	}
+}
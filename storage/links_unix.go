@@ -0,0 +1,16 @@
+// +build !windows
+
+package storage
+
+import (
+	"os"
+	"syscall"
+)
+
+// linkCount returns the number of hard links to a file
+func linkCount(fi os.FileInfo) (int, bool) {
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return int(stat.Nlink), true
+	}
+	return 0, false
+}
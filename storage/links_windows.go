@@ -0,0 +1,11 @@
+// +build windows
+
+package storage
+
+import "os"
+
+// linkCount returns the number of hard links to a file,
+// which isn't available from the status of a file on windows
+func linkCount(fi os.FileInfo) (int, bool) {
+	return 0, false
+}
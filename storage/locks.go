@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// PathLocks serialises the operations on the same files, e.g. a read-modify-write against a replace.
+// The paths are locked in order, so operations locking several files can't deadlock each other.
+type PathLocks struct {
+	mu    sync.Mutex
+	locks map[string]*pathLock
+}
+
+// pathLock is the lock of a path, forgotten once nobody holds or waits for it
+type pathLock struct {
+	sync.Mutex
+	refs int
+}
+
+func NewPathLocks() *PathLocks {
+	return &PathLocks{locks: make(map[string]*pathLock)}
+}
+
+// Lock locks the files, made absolute, and returns the function unlocking them
+func (l *PathLocks) Lock(paths ...string) (unlock func()) {
+	unique := make(map[string]bool)
+	for _, path := range paths {
+		if absolute, err := filepath.Abs(path); err == nil {
+			path = absolute
+		}
+		unique[path] = true
+	}
+	sorted := make([]string, 0, len(unique))
+	for path := range unique {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	locks := make([]*pathLock, len(sorted))
+	l.mu.Lock()
+	for i, path := range sorted {
+		lock, ok := l.locks[path]
+		if !ok {
+			lock = &pathLock{}
+			l.locks[path] = lock
+		}
+		lock.refs++
+		locks[i] = lock
+	}
+	l.mu.Unlock()
+
+	for _, lock := range locks {
+		lock.Lock()
+	}
+	return func() {
+		for _, lock := range locks {
+			lock.Unlock()
+		}
+		l.mu.Lock()
+		for i, path := range sorted {
+			if locks[i].refs--; locks[i].refs == 0 {
+				delete(l.locks, path)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPathLocks(t *testing.T) {
+	l := NewPathLocks()
+
+	// The same file, however its path is written, is locked once at a time
+	unlock := l.Lock("/data/a.txt", "/data/../data/a.txt")
+	locked := make(chan struct{})
+	go func() {
+		defer l.Lock("/data/./a.txt")()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("the file is locked twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	<-locked
+
+	// Files locked in any order don't deadlock
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			defer l.Lock("/data/a.txt", "/data/b.txt")()
+		}()
+		go func() {
+			defer wg.Done()
+			defer l.Lock("/data/b.txt", "/data/a.txt")()
+		}()
+	}
+	wg.Wait()
+
+	// The locks are forgotten once released
+	assert.Empty(t, l.locks)
+}
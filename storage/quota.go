@@ -0,0 +1,538 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Quota limits the content written by a principal, or under a folder, a zero limit is no limit
+type Quota struct {
+	Principal string `json:"principal,omitempty"`
+	Path      string `json:"path,omitempty"`
+	MaxBytes  int64  `json:"maxBytes"`
+	MaxFiles  int64  `json:"maxFiles"`
+}
+
+func (q Quota) appliesTo(owner string, filePath string) bool {
+	if q.Principal != "" {
+		return owner == q.Principal
+	}
+	return strings.HasPrefix(filePath, q.Path+string(filepath.Separator))
+}
+
+// Usage is the size of the content and the number of the files counted by a quota
+type Usage struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+}
+
+// QuotaUsage is a quota with its usage
+type QuotaUsage struct {
+	Quota
+	Usage Usage `json:"usage"`
+}
+
+// QuotaError is returned when a write would exceed a quota
+type QuotaError struct {
+	Quota Quota
+	Usage Usage
+	// Size of the content written, and index of the change exceeding the quota
+	Size   int64
+	Change int
+	// Whether the number of files is exceeded rather than the bytes
+	files bool
+}
+
+func (e *QuotaError) Error() string {
+	owner := "principal " + e.Quota.Principal
+	if e.Quota.Principal == "" {
+		owner = "folder " + e.Quota.Path
+	}
+	if e.files {
+		return fmt.Sprintf("the quota of %s is exceeded, %d files of %d", owner, e.Usage.Files, e.Quota.MaxFiles)
+	}
+	return fmt.Sprintf("the quota of %s is exceeded, %d bytes used of %d, %d bytes written",
+		owner, e.Usage.Bytes, e.Quota.MaxBytes, e.Size)
+}
+
+// TooLarge tells whether the content alone is larger than the quota, whatever is used already
+func (e *QuotaError) TooLarge() bool {
+	return !e.files && e.Size > e.Quota.MaxBytes
+}
+
+// LedgerError is returned when a file has been written, but its owner couldn't be saved to the ledger
+type LedgerError struct {
+	Err error
+}
+
+func (e *LedgerError) Error() string {
+	return fmt.Sprintf("failed to save the quota ledger: %v", e.Err)
+}
+
+// trackedFile is a file counted by the quotas, the owner is the principal who created it if known
+type trackedFile struct {
+	Owner string `json:"owner,omitempty"`
+	Size  int64  `json:"size"`
+}
+
+// QuotaChange is a change of a file counted by the quotas: the file is written with content of the given
+// size, removed, or the source file is moved to it. The owner is the principal making the change, the
+// size of a moved file is only needed if it isn't counted yet.
+type QuotaChange struct {
+	Owner      string
+	FilePath   string
+	Size       int64
+	Remove     bool
+	SourcePath string
+}
+
+// ledgerEntry is a change of an owned file, appended to the ledger
+type ledgerEntry struct {
+	Path    string `json:"path"`
+	Owner   string `json:"owner,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+	Removed bool   `json:"removed,omitempty"`
+}
+
+// Number of entries appended to the ledger before it's written again from scratch
+const ledgerCompaction = 1000
+
+// Quotas enforces the quotas on the writes and tracks their usage incrementally. The owners of the files
+// are kept in a ledger next to the quota file, <file>.ledger, the files under the folders with a quota
+// are counted when the quotas are loaded, so the files written before are counted as well.
+//
+// The ledger is the owned files as a JSON object followed by the changes made since, one JSON object
+// per line, it's compacted once enough changes have been appended.
+type Quotas struct {
+	ledgerPath string
+	mu         sync.Mutex
+	quotas     []Quota
+	usages     []Usage
+	// Room taken by the changes being made, not counted yet
+	reserved []Usage
+	files    map[string]trackedFile
+	// Whether the ledger has been written from scratch, and the number of entries appended since
+	compacted bool
+	appended  int
+}
+
+// LoadQuotas reads the quotas of a JSON file, e.g.
+//
+//	{"quotas": [{"principal": "alice", "maxBytes": 1073741824}, {"path": "/data/team-a", "maxFiles": 10000}]}
+//
+// The size of the files is the size of their content in the store.
+func LoadQuotas(filePath string, store Store) (*Quotas, error) {
+	b, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Quotas []Quota `json:"quotas"`
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("invalid quota file %s: %v", filePath, err)
+	}
+
+	q := &Quotas{ledgerPath: filePath + ".ledger", files: make(map[string]trackedFile)}
+	for _, quota := range config.Quotas {
+		if (quota.Principal == "") == (quota.Path == "") {
+			return nil, fmt.Errorf("invalid quota in %s: a quota needs either a principal or a path", filePath)
+		}
+		if quota.MaxBytes < 0 || quota.MaxFiles < 0 {
+			return nil, fmt.Errorf("invalid quota in %s: the limits cannot be negative", filePath)
+		}
+		if quota.Path != "" {
+			if quota.Path, err = filepath.Abs(quota.Path); err != nil {
+				return nil, err
+			}
+		}
+		q.quotas = append(q.quotas, quota)
+	}
+
+	// Files written by the principals, gone or changed while the service was stopped
+	ledger, err := q.readLedger()
+	if err != nil {
+		return nil, err
+	}
+	for path, file := range ledger {
+		if fi, err := os.Stat(path); err == nil && fi.Mode().IsRegular() {
+			if file.Size, err = ContentSize(store, path, fi); err == nil {
+				q.files[path] = file
+			}
+		}
+	}
+
+	for _, quota := range q.quotas {
+		if quota.Path == "" {
+			continue
+		}
+		err := filepath.Walk(quota.Path, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if _, ok := q.files[path]; ok || !fi.Mode().IsRegular() || path == q.ledgerPath {
+				return nil
+			}
+			size, err := ContentSize(store, path, fi)
+			if err != nil {
+				return err
+			}
+			q.files[path] = trackedFile{Size: size}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to count the usage of %s: %v", quota.Path, err)
+		}
+	}
+
+	q.usages = make([]Usage, len(q.quotas))
+	q.reserved = make([]Usage, len(q.quotas))
+	for path, file := range q.files {
+		q.count(file.Owner, path, file.Size, 1)
+	}
+	return q, nil
+}
+
+// readLedger returns the owned files of the ledger, with the changes appended to it applied
+func (q *Quotas) readLedger() (map[string]trackedFile, error) {
+	ledger := make(map[string]trackedFile)
+	file, err := os.Open(q.ledgerPath)
+	if os.IsNotExist(err) {
+		return ledger, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	if err := decoder.Decode(&ledger); err != nil {
+		return nil, fmt.Errorf("invalid quota ledger %s: %v", q.ledgerPath, err)
+	}
+	q.compacted = true
+	for {
+		var entry ledgerEntry
+		err := decoder.Decode(&entry)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// An entry cut short was being appended when the service stopped, its file is counted again
+			return ledger, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid quota ledger %s: %v", q.ledgerPath, err)
+		}
+		if entry.Removed {
+			delete(ledger, entry.Path)
+		} else {
+			ledger[entry.Path] = trackedFile{Owner: entry.Owner, Size: entry.Size}
+		}
+		q.appended++
+	}
+}
+
+// count adds the bytes and the files to the usage of the quotas applying to a file
+func (q *Quotas) count(owner string, filePath string, bytes int64, files int64) {
+	for i, quota := range q.quotas {
+		if quota.appliesTo(owner, filePath) {
+			q.usages[i].Bytes += bytes
+			q.usages[i].Files += files
+		}
+	}
+}
+
+// changedFiles returns the files a change leaves, nil for the removed ones, lookup returns the files
+// counted before the change
+func changedFiles(change QuotaChange, lookup func(filePath string) (trackedFile, bool)) map[string]*trackedFile {
+	changed := make(map[string]*trackedFile)
+	switch {
+	case change.Remove:
+		if _, ok := lookup(change.FilePath); ok {
+			changed[change.FilePath] = nil
+		}
+	case change.SourcePath != "":
+		// A moved file stays its owner's, the files not counted yet belong to nobody
+		file, ok := lookup(change.SourcePath)
+		if ok {
+			changed[change.SourcePath] = nil
+		} else {
+			file = trackedFile{Size: change.Size}
+		}
+		changed[change.FilePath] = &file
+	default:
+		// The creator of a file stays its owner when it's replaced
+		file := trackedFile{Owner: change.Owner, Size: change.Size}
+		if previous, ok := lookup(change.FilePath); ok && previous.Owner != "" {
+			file.Owner = previous.Owner
+		}
+		changed[change.FilePath] = &file
+	}
+	return changed
+}
+
+// usageDeltas returns how much the changed files add to the usage of every quota
+func (q *Quotas) usageDeltas(changed map[string]*trackedFile, lookup func(filePath string) (trackedFile, bool)) []Usage {
+	deltas := make([]Usage, len(q.quotas))
+	for path, file := range changed {
+		for i, quota := range q.quotas {
+			if previous, ok := lookup(path); ok && quota.appliesTo(previous.Owner, path) {
+				deltas[i].Bytes -= previous.Size
+				deltas[i].Files--
+			}
+			if file != nil && quota.appliesTo(file.Owner, path) {
+				deltas[i].Bytes += file.Size
+				deltas[i].Files++
+			}
+		}
+	}
+	return deltas
+}
+
+// Write writes a file of the given size with the write function if no quota is exceeded, and counts it.
+// The owner is the principal writing the file, the creator of a file stays its owner when it's replaced.
+// A *QuotaError is returned if a quota would be exceeded, a *LedgerError if the file was written but
+// its owner not saved.
+func (q *Quotas) Write(owner string, filePath string, size int64, write func() error) error {
+	return q.Apply([]QuotaChange{{Owner: owner, FilePath: filePath, Size: size}}, write)
+}
+
+// Apply makes the changes with the apply function if no quota is exceeded by any of them, in order, and
+// counts them once they're made. The room they need is reserved while they're made, so that concurrent
+// changes can't exceed a quota together, without waiting for each other. The errors are those of Write.
+func (q *Quotas) Apply(changes []QuotaChange, apply func() error) error {
+	changes, err := absoluteChanges(changes)
+	if err != nil {
+		return err
+	}
+	reserved, err := q.reserve(changes)
+	if err != nil {
+		return err
+	}
+	if err := apply(); err != nil {
+		q.mu.Lock()
+		q.release(reserved)
+		q.mu.Unlock()
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.release(reserved)
+	var entries []ledgerEntry
+	for _, change := range changes {
+		changed := changedFiles(change, q.lookup)
+		for path, file := range changed {
+			previous, ok := q.files[path]
+			if ok {
+				q.count(previous.Owner, path, -previous.Size, -1)
+				delete(q.files, path)
+			}
+			if file != nil {
+				q.files[path] = *file
+				q.count(file.Owner, path, file.Size, 1)
+			}
+			if file != nil && file.Owner != "" {
+				entries = append(entries, ledgerEntry{Path: path, Owner: file.Owner, Size: file.Size})
+			} else if ok && previous.Owner != "" {
+				entries = append(entries, ledgerEntry{Path: path, Removed: true})
+			}
+		}
+	}
+	if err := q.save(entries); err != nil {
+		return &LedgerError{err}
+	}
+	return nil
+}
+
+// absoluteChanges returns the changes with absolute paths, the files are counted by their absolute path
+func absoluteChanges(changes []QuotaChange) ([]QuotaChange, error) {
+	changes = append([]QuotaChange{}, changes...)
+	for i := range changes {
+		for _, path := range []*string{&changes[i].FilePath, &changes[i].SourcePath} {
+			if *path == "" {
+				continue
+			}
+			absolute, err := filepath.Abs(*path)
+			if err != nil {
+				return nil, err
+			}
+			*path = absolute
+		}
+	}
+	return changes, nil
+}
+
+func (q *Quotas) lookup(filePath string) (trackedFile, bool) {
+	file, ok := q.files[filePath]
+	return file, ok
+}
+
+// reserve checks the changes one after the other against the usage, the room reserved by the other
+// changes included, and reserves the room they take
+func (q *Quotas) reserve(changes []QuotaChange) ([]Usage, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// The files as the previous changes leave them
+	files := make(map[string]*trackedFile)
+	lookup := func(filePath string) (trackedFile, bool) {
+		if file, ok := files[filePath]; ok {
+			if file == nil {
+				return trackedFile{}, false
+			}
+			return *file, true
+		}
+		return q.lookup(filePath)
+	}
+
+	usages := make([]Usage, len(q.quotas))
+	for i := range usages {
+		usages[i].Bytes = q.usages[i].Bytes + q.reserved[i].Bytes
+		usages[i].Files = q.usages[i].Files + q.reserved[i].Files
+	}
+	reserved := make([]Usage, len(q.quotas))
+	for c, change := range changes {
+		changed := changedFiles(change, lookup)
+		deltas := q.usageDeltas(changed, lookup)
+		for i, quota := range q.quotas {
+			// Shrinking a file is allowed even if the quota is already exceeded
+			usage, delta := usages[i], deltas[i]
+			if quota.MaxBytes > 0 && delta.Bytes > 0 && usage.Bytes+delta.Bytes > quota.MaxBytes {
+				return nil, &QuotaError{Quota: quota, Usage: usage, Size: change.Size, Change: c}
+			}
+			if quota.MaxFiles > 0 && delta.Files > 0 && usage.Files+delta.Files > quota.MaxFiles {
+				return nil, &QuotaError{Quota: quota, Usage: usage, Size: change.Size, Change: c, files: true}
+			}
+			usages[i].Bytes += delta.Bytes
+			usages[i].Files += delta.Files
+			if reserved[i].Bytes += delta.Bytes; reserved[i].Bytes < 0 {
+				reserved[i].Bytes = 0
+			}
+			if reserved[i].Files += delta.Files; reserved[i].Files < 0 {
+				reserved[i].Files = 0
+			}
+		}
+		for path, file := range changed {
+			files[path] = file
+		}
+	}
+	for i := range reserved {
+		q.reserved[i].Bytes += reserved[i].Bytes
+		q.reserved[i].Files += reserved[i].Files
+	}
+	return reserved, nil
+}
+
+func (q *Quotas) release(reserved []Usage) {
+	for i := range reserved {
+		q.reserved[i].Bytes -= reserved[i].Bytes
+		q.reserved[i].Files -= reserved[i].Files
+	}
+}
+
+// Check returns the error Apply would return if the changes exceeded a quota, without reserving any room
+func (q *Quotas) Check(changes []QuotaChange) error {
+	changes, err := absoluteChanges(changes)
+	if err != nil {
+		return err
+	}
+	reserved, err := q.reserve(changes)
+	if err != nil {
+		return err
+	}
+	q.mu.Lock()
+	q.release(reserved)
+	q.mu.Unlock()
+	return nil
+}
+
+// Move moves the source to the destination with the move function, if the destination has room for it.
+// The size is the one of the content of the source, it's only needed if it isn't counted yet.
+func (q *Quotas) Move(owner string, sourcePath string, destinationPath string, size int64, move func() error) error {
+	return q.Apply([]QuotaChange{{Owner: owner, FilePath: destinationPath, SourcePath: sourcePath, Size: size}}, move)
+}
+
+// Forget stops counting a removed file
+func (q *Quotas) Forget(filePath string) error {
+	return q.Apply([]QuotaChange{{FilePath: filePath, Remove: true}}, func() error { return nil })
+}
+
+// Usage returns the quotas with their usage, the ones of a principal only if it's given
+func (q *Quotas) Usage(principal string) []QuotaUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	usages := []QuotaUsage{}
+	for i, quota := range q.quotas {
+		if principal == "" || quota.Principal == principal {
+			usages = append(usages, QuotaUsage{Quota: quota, Usage: q.usages[i]})
+		}
+	}
+	return usages
+}
+
+// save appends the entries to the ledger, or writes it from scratch once enough entries have been appended
+func (q *Quotas) save(entries []ledgerEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if !q.compacted || q.appended+len(entries) > ledgerCompaction {
+		return q.compact()
+	}
+
+	var b []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		b = append(append(b, line...), '\n')
+	}
+	file, err := os.OpenFile(q.ledgerPath, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(b)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// The entries may be written in part, the next compaction writes them again
+		q.compacted = false
+		return err
+	}
+	q.appended += len(entries)
+	return nil
+}
+
+// compact writes the owned files to a tmp file before renaming it to the ledger, the other files
+// are counted again when the quotas are loaded
+func (q *Quotas) compact() error {
+	ledger := make(map[string]trackedFile)
+	for path, file := range q.files {
+		if file.Owner != "" {
+			ledger[path] = file
+		}
+	}
+	b, err := json.Marshal(ledger)
+	if err != nil {
+		return err
+	}
+	tmpPath := q.ledgerPath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, append(b, '\n'), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, q.ledgerPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	q.compacted = true
+	q.appended = 0
+	return nil
+}
@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeQuotas(t *testing.T, dir string, content string) string {
+	filePath := filepath.Join(dir, "quotas.json")
+	if !assert.NoError(t, ioutil.WriteFile(filePath, []byte(content), 0600)) {
+		t.FailNow()
+	}
+	return filePath
+}
+
+func TestLoadQuotas(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	for _, invalid := range []string{
+		`not json`,
+		`{"quotas": [{"maxBytes": 10}]}`,
+		`{"quotas": [{"principal": "alice", "path": "/data", "maxBytes": 10}]}`,
+		`{"quotas": [{"principal": "alice", "maxFiles": -1}]}`,
+	} {
+		_, err := LoadQuotas(writeQuotas(t, dir, invalid), NewFileStore())
+		assert.Error(t, err, invalid)
+	}
+
+	// The files already under a folder are counted
+	folder := filepath.Join(dir, "team")
+	assert.NoError(t, os.MkdirAll(filepath.Join(folder, "sub"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(folder, "a.txt"), []byte("Hello"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(folder, "sub", "b.txt"), []byte("World!"), 0644))
+	quotas, err := LoadQuotas(writeQuotas(t, dir, `{"quotas": [{"path": "`+folder+`", "maxBytes": 100}]}`), NewFileStore())
+	if assert.NoError(t, err) {
+		assert.Equal(t, []QuotaUsage{{Quota: Quota{Path: folder, MaxBytes: 100}, Usage: Usage{Bytes: 11, Files: 2}}},
+			quotas.Usage(""))
+	}
+}
+
+func TestQuotasWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	folder := filepath.Join(dir, "team")
+	assert.NoError(t, os.MkdirAll(folder, 0755))
+
+	store := NewFileStore()
+	quotaFile := writeQuotas(t, dir, `{"quotas": [
+		{"principal": "alice", "maxBytes": 10},
+		{"path": "`+folder+`", "maxFiles": 2}
+	]}`)
+	quotas, err := LoadQuotas(quotaFile, store)
+	if !assert.NoError(t, err) {
+		return
+	}
+	create := func(owner string, filePath string, content string) error {
+		return quotas.Write(owner, filePath, int64(len(content)), func() error {
+			return store.Create(filePath, []byte(content))
+		})
+	}
+	replace := func(owner string, filePath string, content string) error {
+		return quotas.Write(owner, filePath, int64(len(content)), func() error {
+			return store.Replace(filePath, []byte(content))
+		})
+	}
+
+	a := filepath.Join(dir, "a.txt")
+	assert.NoError(t, create("alice", a, "Hello"))
+	assert.NoError(t, create("bob", filepath.Join(dir, "b.txt"), "Hello, World!"))
+
+	// The content alone is larger than the quota
+	err = create("alice", filepath.Join(dir, "c.txt"), "Hello, World!")
+	if quotaErr, ok := err.(*QuotaError); assert.True(t, ok) {
+		assert.True(t, quotaErr.TooLarge())
+	}
+	_, err = os.Stat(filepath.Join(dir, "c.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Not enough room left
+	err = create("alice", filepath.Join(dir, "c.txt"), "Hello!")
+	if quotaErr, ok := err.(*QuotaError); assert.True(t, ok) {
+		assert.False(t, quotaErr.TooLarge())
+		assert.Equal(t, int64(5), quotaErr.Usage.Bytes)
+	}
+
+	// A replaced file counts once, and stays its creator's
+	assert.NoError(t, replace("alice", a, "Hello!!!!!"))
+	assert.Error(t, replace("alice", a, "Hello, World!"))
+	assert.NoError(t, replace("bob", a, "Hi"))
+	assert.NoError(t, create("alice", filepath.Join(dir, "c.txt"), "Hello!"))
+
+	// The number of files under the folder
+	assert.NoError(t, create("bob", filepath.Join(folder, "a.txt"), "Hello"))
+	assert.NoError(t, create("", filepath.Join(folder, "b.txt"), "Hello"))
+	err = create("bob", filepath.Join(folder, "c.txt"), "Hello")
+	if quotaErr, ok := err.(*QuotaError); assert.True(t, ok) {
+		assert.False(t, quotaErr.TooLarge())
+		assert.Contains(t, quotaErr.Error(), "2 files of 2")
+	}
+	assert.NoError(t, store.Remove(filepath.Join(folder, "a.txt")))
+	assert.NoError(t, quotas.Forget(filepath.Join(folder, "a.txt")))
+	assert.NoError(t, create("bob", filepath.Join(folder, "c.txt"), "Hello"))
+
+	assert.Equal(t, []QuotaUsage{{Quota: Quota{Principal: "alice", MaxBytes: 10}, Usage: Usage{Bytes: 8, Files: 2}}},
+		quotas.Usage("alice"))
+
+	// The owners are kept in the ledger, the changes made while stopped are caught up
+	assert.NoError(t, ioutil.WriteFile(a, []byte("Hello"), 0644))
+	reloaded, err := LoadQuotas(quotaFile, store)
+	if assert.NoError(t, err) {
+		assert.Equal(t, quotas.Usage("")[1], reloaded.Usage("")[1])
+		assert.Equal(t, Usage{Bytes: 11, Files: 2}, reloaded.Usage("alice")[0].Usage)
+	}
+}
+
+func TestQuotasApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	folder := filepath.Join(dir, "team")
+	assert.NoError(t, os.MkdirAll(folder, 0755))
+	quotas, err := LoadQuotas(writeQuotas(t, dir, `{"quotas": [
+		{"principal": "alice", "maxBytes": 10},
+		{"path": "`+folder+`", "maxFiles": 1}
+	]}`), NewFileStore())
+	if !assert.NoError(t, err) {
+		return
+	}
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	applied := func() error { return nil }
+
+	// The changes are checked in order, a file removed makes room for the next ones
+	assert.NoError(t, quotas.Write("alice", a, 8, applied))
+	assert.NoError(t, quotas.Apply([]QuotaChange{
+		{Owner: "alice", FilePath: a, Remove: true},
+		{Owner: "alice", FilePath: b, Size: 10},
+	}, applied))
+	err = quotas.Apply([]QuotaChange{
+		{Owner: "alice", FilePath: b, Size: 5},
+		{Owner: "alice", FilePath: a, Size: 6},
+	}, func() error {
+		t.Error("the changes exceeding a quota must not be made")
+		return nil
+	})
+	assert.IsType(t, &QuotaError{}, err)
+
+	// A moved file stays its owner's, and counts under its new folder
+	assert.NoError(t, quotas.Move("bob", b, filepath.Join(folder, "b.txt"), 0, applied))
+	err = quotas.Move("bob", a, filepath.Join(folder, "a.txt"), 3, applied)
+	if quotaErr, ok := err.(*QuotaError); assert.True(t, ok) {
+		assert.Contains(t, quotaErr.Error(), "1 files of 1")
+	}
+	usages := quotas.Usage("")
+	assert.Equal(t, Usage{Bytes: 10, Files: 1}, usages[0].Usage)
+	assert.Equal(t, Usage{Bytes: 10, Files: 1}, usages[1].Usage)
+
+	// The room is reserved while a write is made, without blocking the other writes
+	assert.NoError(t, quotas.Forget(filepath.Join(folder, "b.txt")))
+	writing, written := make(chan struct{}), make(chan error)
+	go func() {
+		written <- quotas.Write("alice", a, 6, func() error {
+			close(writing)
+			<-written
+			return nil
+		})
+	}()
+	<-writing
+	assert.IsType(t, &QuotaError{}, quotas.Write("alice", b, 6, applied))
+	assert.NoError(t, quotas.Write("alice", b, 4, applied))
+	written <- nil
+	assert.NoError(t, <-written)
+	assert.Equal(t, Usage{Bytes: 10, Files: 2}, quotas.Usage("alice")[0].Usage)
+
+	// A failed write gives its room back
+	assert.Error(t, quotas.Write("alice", b, 2, func() error { return os.ErrPermission }))
+	assert.NoError(t, quotas.Write("alice", b, 4, applied))
+}
+
+func TestQuotasLedger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	quotaFile := writeQuotas(t, dir, `{"quotas": [{"principal": "alice", "maxBytes": 1000000}]}`)
+	store := NewFileStore()
+	quotas, err := LoadQuotas(quotaFile, store)
+	if !assert.NoError(t, err) {
+		return
+	}
+	create := func(name string) {
+		filePath := filepath.Join(dir, name)
+		assert.NoError(t, quotas.Write("alice", filePath, 5, func() error {
+			return store.Create(filePath, []byte("Hello"))
+		}))
+	}
+
+	// The changes are appended to the ledger, which is written again from scratch once in a while
+	create("a.txt")
+	create("b.txt")
+	ledger, _ := ioutil.ReadFile(quotaFile + ".ledger")
+	assert.Equal(t, 2, strings.Count(string(ledger), "\n"))
+	for i := 0; i < ledgerCompaction; i++ {
+		create(fmt.Sprintf("%d.txt", i))
+	}
+	ledger, _ = ioutil.ReadFile(quotaFile + ".ledger")
+	assert.True(t, strings.Count(string(ledger), "\n") < ledgerCompaction)
+	assert.NoError(t, store.Remove(filepath.Join(dir, "a.txt")))
+	assert.NoError(t, quotas.Forget(filepath.Join(dir, "a.txt")))
+
+	// An entry cut short while it was appended is ignored
+	file, err := os.OpenFile(quotaFile+".ledger", os.O_WRONLY|os.O_APPEND, 0600)
+	if assert.NoError(t, err) {
+		file.WriteString(`{"path": "`)
+		file.Close()
+	}
+	reloaded, err := LoadQuotas(quotaFile, store)
+	if assert.NoError(t, err) {
+		assert.Equal(t, quotas.Usage(""), reloaded.Usage(""))
+		assert.Equal(t, int64(ledgerCompaction+1), reloaded.Usage("alice")[0].Usage.Files)
+	}
+}
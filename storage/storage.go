@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Store is where the file handlers keep the content of the files
+type Store interface {
+	// Create writes a new file, it fails if the file already exists
+	Create(filePath string, content []byte) error
+	// Replace replaces the content of a file atomically
+	Replace(filePath string, content []byte) error
+	// Read returns the content of a file
+	Read(filePath string) ([]byte, error)
+	// Remove removes a file
+	Remove(filePath string) error
+	// Copy copies a file to a new path, it fails if the destination already exists
+	Copy(sourcePath string, destinationPath string) error
+	// Move moves a file to a new path, it fails if the destination already exists
+	Move(sourcePath string, destinationPath string) error
+}
+
+// Opener is implemented by the stores which transform the content of the files, such as CompressedStore,
+// so their content can also be read as a stream and its size known without reading it
+type Opener interface {
+	// Open opens a file to read its content, as returned by Read
+	Open(filePath string) (io.ReadCloser, error)
+	// ContentSize returns the size of the content of a file
+	ContentSize(filePath string, fi os.FileInfo) (int64, error)
+}
+
+// Open opens a file of the store to read its content
+func Open(store Store, filePath string) (io.ReadCloser, error) {
+	if opener, ok := store.(Opener); ok {
+		return opener.Open(filePath)
+	}
+	return os.Open(filePath)
+}
+
+// ContentSize returns the size of the content of a file of the store, given the status of the file
+func ContentSize(store Store, filePath string, fi os.FileInfo) (int64, error) {
+	if opener, ok := store.(Opener); ok {
+		return opener.ContentSize(filePath, fi)
+	}
+	return fi.Size(), nil
+}
+
+// Unwrap returns the store wrapped by a store transforming the content, nil if it doesn't wrap any
+func Unwrap(store Store) Store {
+	if wrapper, ok := store.(interface{ Inner() Store }); ok {
+		return wrapper.Inner()
+	}
+	return nil
+}
+
+// Underlying returns the store at the bottom of a chain of stores transforming the content
+func Underlying(store Store) Store {
+	for inner := Unwrap(store); inner != nil; inner = Unwrap(store) {
+		store = inner
+	}
+	return store
+}
+
+// FileStore stores the content of every file in the file itself
+type FileStore struct{}
+
+func NewFileStore() *FileStore {
+	return &FileStore{}
+}
+
+func (s *FileStore) Create(filePath string, content []byte) error {
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	// Remove the file if failed to write or close it,
+	// otherwise the content might not be flushed into the file
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filePath)
+		return err
+	}
+	return nil
+}
+
+// Replace writes to a tmp file before renaming it to the file,
+// so the file is left untouched unless everything ran well
+func (s *FileStore) Replace(filePath string, content []byte) error {
+	tmpPath := filePath + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, filePath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) Read(filePath string) ([]byte, error) {
+	return ioutil.ReadFile(filePath)
+}
+
+func (s *FileStore) Remove(filePath string) error {
+	return os.Remove(filePath)
+}
+
+func (s *FileStore) Copy(sourcePath string, destinationPath string) error {
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destination, err := os.OpenFile(destinationPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(destination, source)
+	if closeErr := destination.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(destinationPath)
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) Move(sourcePath string, destinationPath string) error {
+	return moveFile(sourcePath, destinationPath)
+}
+
+// moveFile links the destination to the file before removing the source,
+// unlike a rename it never replaces an existing destination
+func moveFile(sourcePath string, destinationPath string) error {
+	if err := os.Link(sourcePath, destinationPath); err != nil {
+		return err
+	}
+	if err := os.Remove(sourcePath); err != nil {
+		os.Remove(destinationPath)
+		return err
+	}
+	return nil
+}
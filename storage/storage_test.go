@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewFileStore()
+	filePath := filepath.Join(dir, "a.txt")
+	copyPath := filepath.Join(dir, "b.txt")
+
+	assert.NoError(t, s.Create(filePath, []byte("Hello, World!")))
+	assert.Error(t, s.Create(filePath, []byte("Again")))
+
+	assert.NoError(t, s.Replace(filePath, []byte("New Content")))
+	_, err = os.Stat(filePath + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NoError(t, s.Copy(filePath, copyPath))
+	assert.Error(t, s.Copy(filePath, copyPath))
+	content, err := s.Read(copyPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "New Content", string(content))
+
+	assert.NoError(t, s.Remove(filePath))
+	_, err = s.Read(filePath)
+	assert.Error(t, err)
+}
+
+func TestFileStoreMove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewFileStore()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	c := filepath.Join(dir, "c.txt")
+	assert.NoError(t, s.Create(a, []byte("a")))
+	assert.NoError(t, s.Create(b, []byte("b")))
+
+	// The destination is never replaced
+	assert.Error(t, s.Move(a, b))
+	assert.NoError(t, s.Move(a, c))
+	_, err = os.Stat(a)
+	assert.True(t, os.IsNotExist(err))
+	content, err := s.Read(c)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", string(content))
+}
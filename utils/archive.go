@@ -0,0 +1,274 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// Archive formats
+const (
+	ArchiveTar   = "tar"
+	ArchiveTarGz = "tar.gz"
+	ArchiveZip   = "zip"
+)
+
+// ArchiveLimits bound the content extracted from an archive, whatever its headers claim
+type ArchiveLimits struct {
+	// Maximum number of entries, directories included
+	MaxEntries int
+	// Maximum number of bytes once extracted
+	MaxBytes int64
+}
+
+// ArchiveLimitError is returned when an archive exceeds its limits
+type ArchiveLimitError struct {
+	Limit string
+}
+
+func (e *ArchiveLimitError) Error() string {
+	return fmt.Sprintf("the archive exceeds the limit of %s", e.Limit)
+}
+
+// ArchiveSummary describes an extracted archive, the skipped entries are neither files nor directories
+type ArchiveSummary struct {
+	Files   int   `json:"files"`
+	Bytes   int64 `json:"bytes"`
+	Skipped int   `json:"skipped"`
+}
+
+// DetectArchiveFormat guesses the format of an archive from its first bytes, empty if unknown
+func DetectArchiveFormat(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")) || bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return ArchiveZip
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return ArchiveTarGz
+	case len(header) >= 262 && string(header[257:262]) == "ustar":
+		return ArchiveTar
+	}
+	return ""
+}
+
+// SafeArchivePath returns the cleaned slash separated path of an archive entry, it fails for the paths
+// that would end up outside of the extraction folder, such as absolute paths or paths starting with ".."
+func SafeArchivePath(name string) (string, error) {
+	cleaned := path.Clean(strings.Replace(name, "\\", "/", -1))
+	if strings.ContainsRune(name, 0) || path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") ||
+		(len(cleaned) >= 2 && cleaned[1] == ':') {
+		return "", fmt.Errorf("unsafe path in the archive: %s", name)
+	}
+	return cleaned, nil
+}
+
+// archiveReader enforces the limits while an archive is read
+type archiveReader struct {
+	limits  ArchiveLimits
+	entries int
+	summary ArchiveSummary
+	fn      func(name string, r io.Reader) error
+}
+
+func (ar *archiveReader) entry() error {
+	ar.entries++
+	if ar.limits.MaxEntries > 0 && ar.entries > ar.limits.MaxEntries {
+		return &ArchiveLimitError{fmt.Sprintf("%d entries", ar.limits.MaxEntries)}
+	}
+	return nil
+}
+
+func (ar *archiveReader) file(name string, r io.Reader) error {
+	name, err := SafeArchivePath(name)
+	if err != nil {
+		return err
+	}
+
+	ar.summary.Files++
+	content := &entryReader{r: r, ar: ar}
+	if err := ar.fn(name, content); err != nil {
+		return err
+	}
+	// What fn left unread counts in the limit too
+	_, err = io.Copy(ioutil.Discard, content)
+	return err
+}
+
+// entryReader counts the bytes of an entry as they are read, and fails once the limit is exceeded
+type entryReader struct {
+	r  io.Reader
+	ar *archiveReader
+}
+
+func (er *entryReader) Read(p []byte) (int, error) {
+	n, err := er.r.Read(p)
+	er.ar.summary.Bytes += int64(n)
+	if er.ar.limits.MaxBytes > 0 && er.ar.summary.Bytes > er.ar.limits.MaxBytes {
+		return n, &ArchiveLimitError{FormatSize(er.ar.limits.MaxBytes)}
+	}
+	return n, err
+}
+
+// ReadTarArchive calls fn with the path and a reader of the content of every regular file of a tar archive,
+// gzipped or not, the content is streamed and the reader fails once the limits are exceeded.
+// Directories are only checked, other entries such as links are skipped.
+func ReadTarArchive(r io.Reader, gzipped bool, limits ArchiveLimits,
+	fn func(name string, r io.Reader) error) (ArchiveSummary, error) {
+	ar := &archiveReader{limits: limits, fn: fn}
+	if gzipped {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return ar.summary, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return ar.summary, nil
+		}
+		if err != nil {
+			return ar.summary, err
+		}
+		if err := ar.entry(); err != nil {
+			return ar.summary, err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			err = ar.file(header.Name, tr)
+		case tar.TypeDir:
+			_, err = SafeArchivePath(header.Name)
+		default:
+			ar.summary.Skipped++
+		}
+		if err != nil {
+			return ar.summary, err
+		}
+	}
+}
+
+// ReadZipArchive is ReadTarArchive for zip archives, which can only be read from their end
+func ReadZipArchive(r io.ReaderAt, size int64, limits ArchiveLimits,
+	fn func(name string, r io.Reader) error) (ArchiveSummary, error) {
+	ar := &archiveReader{limits: limits, fn: fn}
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return ar.summary, err
+	}
+
+	for _, f := range zr.File {
+		if err := ar.entry(); err != nil {
+			return ar.summary, err
+		}
+		switch {
+		case f.Mode().IsDir():
+			_, err = SafeArchivePath(f.Name)
+		case f.Mode().IsRegular():
+			err = readZipFile(ar, f)
+		default:
+			ar.summary.Skipped++
+		}
+		if err != nil {
+			return ar.summary, err
+		}
+	}
+	return ar.summary, nil
+}
+
+func readZipFile(ar *archiveReader, f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return ar.file(f.Name, rc)
+}
+
+// ArchiveWriter writes the files of an archive one after the other, so it can be streamed
+type ArchiveWriter struct {
+	tar  *tar.Writer
+	gzip *gzip.Writer
+	zip  *zip.Writer
+}
+
+func NewArchiveWriter(w io.Writer, format string) (*ArchiveWriter, error) {
+	switch format {
+	case ArchiveTar:
+		return &ArchiveWriter{tar: tar.NewWriter(w)}, nil
+	case ArchiveTarGz:
+		gz := gzip.NewWriter(w)
+		return &ArchiveWriter{tar: tar.NewWriter(gz), gzip: gz}, nil
+	case ArchiveZip:
+		return &ArchiveWriter{zip: zip.NewWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("unknown archive format %s", format)
+}
+
+// Add writes a file, the name is a slash separated path and fi gives its mode and modification time
+func (aw *ArchiveWriter) Add(name string, fi os.FileInfo, content []byte) error {
+	if aw.zip != nil {
+		header, err := zip.FileInfoHeader(fi)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		header.Method = zip.Deflate
+		header.UncompressedSize64 = uint64(len(content))
+		w, err := aw.zip.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(content)
+		return err
+	}
+
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(fi.Mode().Perm()),
+		Size:     int64(len(content)),
+		ModTime:  fi.ModTime(),
+	}
+	if err := aw.tar.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := aw.tar.Write(content)
+	return err
+}
+
+// Flush writes the buffered data, so the files already added reach the client
+func (aw *ArchiveWriter) Flush() error {
+	if aw.zip != nil {
+		return aw.zip.Flush()
+	}
+	if err := aw.tar.Flush(); err != nil {
+		return err
+	}
+	if aw.gzip != nil {
+		return aw.gzip.Flush()
+	}
+	return nil
+}
+
+func (aw *ArchiveWriter) Close() error {
+	if aw.zip != nil {
+		return aw.zip.Close()
+	}
+	if err := aw.tar.Close(); err != nil {
+		return err
+	}
+	if aw.gzip != nil {
+		return aw.gzip.Close()
+	}
+	return nil
+}
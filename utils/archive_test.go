@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestArchive(t *testing.T, format string, files map[string]string) []byte {
+	dir := createTestTree(t, map[string]string{"fi.txt": ""})
+	defer os.RemoveAll(dir)
+	fi, _ := os.Stat(filepath.Join(dir, "fi.txt"))
+
+	var buf bytes.Buffer
+	aw, err := NewArchiveWriter(&buf, format)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	for name, content := range files {
+		assert.NoError(t, aw.Add(name, fi, []byte(content)))
+	}
+	assert.NoError(t, aw.Close())
+	return buf.Bytes()
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	files := map[string]string{"a.txt": "Hello", "sub/b.txt": "World!"}
+	for _, format := range []string{ArchiveTar, ArchiveTarGz, ArchiveZip} {
+		archive := writeTestArchive(t, format, files)
+		assert.Equal(t, format, DetectArchiveFormat(archive), format)
+
+		extracted := make(map[string]string)
+		collect := func(name string, r io.Reader) error {
+			content, err := ioutil.ReadAll(r)
+			extracted[name] = string(content)
+			return err
+		}
+		var summary ArchiveSummary
+		var err error
+		if format == ArchiveZip {
+			summary, err = ReadZipArchive(bytes.NewReader(archive), int64(len(archive)), ArchiveLimits{}, collect)
+		} else {
+			summary, err = ReadTarArchive(bytes.NewReader(archive), format == ArchiveTarGz, ArchiveLimits{}, collect)
+		}
+		if assert.NoError(t, err, format) {
+			assert.Equal(t, files, extracted, format)
+			assert.Equal(t, ArchiveSummary{Files: 2, Bytes: 11}, summary, format)
+		}
+	}
+}
+
+func TestArchiveLimits(t *testing.T) {
+	archive := writeTestArchive(t, ArchiveTar, map[string]string{"a.txt": "Hello", "b.txt": "World!"})
+	ignore := func(string, io.Reader) error { return nil }
+
+	_, err := ReadTarArchive(bytes.NewReader(archive), false, ArchiveLimits{MaxEntries: 1}, ignore)
+	assert.IsType(t, &ArchiveLimitError{}, err)
+	_, err = ReadTarArchive(bytes.NewReader(archive), false, ArchiveLimits{MaxBytes: 10}, ignore)
+	assert.IsType(t, &ArchiveLimitError{}, err)
+	_, err = ReadTarArchive(bytes.NewReader(archive), false, ArchiveLimits{MaxEntries: 2, MaxBytes: 11}, ignore)
+	assert.NoError(t, err)
+}
+
+func TestUnsafeArchivePaths(t *testing.T) {
+	for _, name := range []string{"../evil.txt", "a/../../evil.txt", "/etc/passwd", "..\\evil.txt", "C:\\evil.txt"} {
+		_, err := SafeArchivePath(name)
+		assert.Error(t, err, name)
+	}
+	name, err := SafeArchivePath("./a/../b/c.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "b/c.txt", name)
+
+	// Links are skipped
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeSymlink, Name: "link", Linkname: "/etc/passwd"}))
+	assert.NoError(t, tw.Close())
+	summary, err := ReadTarArchive(&buf, false, ArchiveLimits{}, func(string, io.Reader) error {
+		t.Error("links must not be extracted")
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, summary.Skipped)
+}
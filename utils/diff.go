@@ -0,0 +1,491 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// DiffOp is the operation of a diff edit, chosen to prefix the lines of a unified diff
+type DiffOp byte
+
+const (
+	DiffEqual  DiffOp = ' '
+	DiffDelete DiffOp = '-'
+	DiffInsert DiffOp = '+'
+)
+
+func (op DiffOp) MarshalText() ([]byte, error) {
+	switch op {
+	case DiffEqual:
+		return []byte("equal"), nil
+	case DiffDelete:
+		return []byte("delete"), nil
+	case DiffInsert:
+		return []byte("insert"), nil
+	}
+	return nil, fmt.Errorf("unknown diff operation %q", byte(op))
+}
+
+func (op *DiffOp) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "equal":
+		*op = DiffEqual
+	case "delete":
+		*op = DiffDelete
+	case "insert":
+		*op = DiffInsert
+	default:
+		return fmt.Errorf("unknown diff operation %s", text)
+	}
+	return nil
+}
+
+// Whitespace differences a diff can ignore
+const (
+	IgnoreWhitespaceNone = "none"
+	// Whitespace at the end of the lines
+	IgnoreWhitespaceTrailing = "trailing"
+	// Changes in the amount of whitespace, like diff -b
+	IgnoreWhitespaceChange = "change"
+	// All whitespace, like diff -w
+	IgnoreWhitespaceAll = "all"
+)
+
+// Beyond this number of differences the remaining items are reported as entirely replaced,
+// the memory used by the diff grows with the square of this number
+const maxDiffCost = 1000
+
+// DiffEdit is an item of the old or the new sequence, the indexes start at 0
+// and are -1 for the sequence the item doesn't belong to
+type DiffEdit struct {
+	Op       DiffOp `json:"op"`
+	OldIndex int    `json:"oldIndex"`
+	NewIndex int    `json:"newIndex"`
+	Text     string `json:"text"`
+}
+
+// Diff returns the shortest edit script turning a into b with the Myers algorithm,
+// deletions come before insertions
+func Diff(a []string, b []string) []DiffEdit {
+	// The common prefix and suffix don't need to be searched
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits := make([]DiffEdit, 0, len(a)+len(b)-prefix-suffix)
+	for i := 0; i < prefix; i++ {
+		edits = append(edits, DiffEdit{Op: DiffEqual, OldIndex: i, NewIndex: i, Text: a[i]})
+	}
+	edits = append(edits, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], prefix, prefix)...)
+	for i := suffix; i > 0; i-- {
+		edits = append(edits, DiffEdit{Op: DiffEqual, OldIndex: len(a) - i, NewIndex: len(b) - i, Text: a[len(a)-i]})
+	}
+	return edits
+}
+
+// DiffNormalized diffs the items once normalized, the edits keep the original items,
+// the old one for the equal items
+func DiffNormalized(a []string, b []string, normalize func(string) string) []DiffEdit {
+	if normalize == nil {
+		return Diff(a, b)
+	}
+	normalizedA := make([]string, len(a))
+	for i, item := range a {
+		normalizedA[i] = normalize(item)
+	}
+	normalizedB := make([]string, len(b))
+	for i, item := range b {
+		normalizedB[i] = normalize(item)
+	}
+
+	edits := Diff(normalizedA, normalizedB)
+	for i := range edits {
+		if edits[i].Op == DiffInsert {
+			edits[i].Text = b[edits[i].NewIndex]
+		} else {
+			edits[i].Text = a[edits[i].OldIndex]
+		}
+	}
+	return edits
+}
+
+// WhitespaceNormalizer returns the normalization ignoring the whitespace differences,
+// nil if none is ignored
+func WhitespaceNormalizer(ignore string) (func(string) string, error) {
+	switch ignore {
+	case "", IgnoreWhitespaceNone:
+		return nil, nil
+	case IgnoreWhitespaceTrailing:
+		return func(s string) string {
+			return strings.TrimRightFunc(s, unicode.IsSpace)
+		}, nil
+	case IgnoreWhitespaceChange:
+		return func(s string) string {
+			// Leading whitespace still matters, but not its amount
+			normalized := strings.Join(strings.Fields(s), " ")
+			if s != "" && unicode.IsSpace([]rune(s)[0]) && normalized != "" {
+				normalized = " " + normalized
+			}
+			return normalized
+		}, nil
+	case IgnoreWhitespaceAll:
+		return func(s string) string {
+			return strings.Join(strings.Fields(s), "")
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown whitespace option %s", ignore)
+}
+
+// myers finds the shortest edit script, the offsets are the indexes of a[0] and b[0] in the whole sequences
+func myers(a []string, b []string, oldOffset int, newOffset int) []DiffEdit {
+	n, m := len(a), len(b)
+	max := n + m
+	if max > maxDiffCost {
+		max = maxDiffCost
+	}
+
+	// v[k] is the furthest x reached on the diagonal k = x - y, the trace keeps v for each cost d
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+	cost := -1
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				cost = d
+				break search
+			}
+		}
+	}
+
+	if cost < 0 {
+		// Too many differences, replace everything
+		edits := make([]DiffEdit, 0, n+m)
+		for i := range a {
+			edits = append(edits, DiffEdit{Op: DiffDelete, OldIndex: oldOffset + i, NewIndex: -1, Text: a[i]})
+		}
+		for j := range b {
+			edits = append(edits, DiffEdit{Op: DiffInsert, OldIndex: -1, NewIndex: newOffset + j, Text: b[j]})
+		}
+		return edits
+	}
+
+	// Backtrack from the end, trace[d] holds v[-d..d] as it was before the step d
+	var reversed []DiffEdit
+	x, y := n, m
+	for d := cost; d >= 0; d-- {
+		previous := trace[d]
+		at := func(k int) int { return previous[k+d] }
+		k := x - y
+		var previousK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			previousK = k + 1
+		} else {
+			previousK = k - 1
+		}
+		previousX := 0
+		if d > 0 {
+			previousX = at(previousK)
+		}
+		previousY := previousX - previousK
+
+		for x > previousX && y > previousY {
+			x--
+			y--
+			reversed = append(reversed, DiffEdit{Op: DiffEqual, OldIndex: oldOffset + x, NewIndex: newOffset + y, Text: a[x]})
+		}
+		if d == 0 {
+			break
+		}
+		if x == previousX {
+			y--
+			reversed = append(reversed, DiffEdit{Op: DiffInsert, OldIndex: -1, NewIndex: newOffset + y, Text: b[y]})
+		} else {
+			x--
+			reversed = append(reversed, DiffEdit{Op: DiffDelete, OldIndex: oldOffset + x, NewIndex: -1, Text: a[x]})
+		}
+	}
+
+	edits := make([]DiffEdit, len(reversed))
+	for i, edit := range reversed {
+		edits[len(reversed)-1-i] = edit
+	}
+	return edits
+}
+
+// SplitLines splits the content into lines keeping their line feed, the last line has none
+// if the content doesn't end with a line feed
+func SplitLines(content string) []string {
+	var lines []string
+	for content != "" {
+		i := strings.IndexByte(content, '\n')
+		if i < 0 {
+			lines = append(lines, content)
+			break
+		}
+		lines = append(lines, content[:i+1])
+		content = content[i+1:]
+	}
+	return lines
+}
+
+// UnifiedDiff formats the line edits as a unified diff with the given number of context lines,
+// the lines are expected to keep their line feed as returned by SplitLines.
+// It returns an empty string if the contents are equal.
+func UnifiedDiff(oldName string, newName string, edits []DiffEdit, context int) string {
+	var b strings.Builder
+	for _, hunk := range diffHunks(edits, context) {
+		if b.Len() == 0 {
+			fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(hunk.oldStart, hunk.oldCount), hunkRange(hunk.newStart, hunk.newCount))
+		for _, edit := range hunk.edits {
+			b.WriteByte(byte(edit.Op))
+			b.WriteString(edit.Text)
+			if !strings.HasSuffix(edit.Text, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+// diffHunk is a group of changes with their context lines, the starts are the numbers of lines before them
+type diffHunk struct {
+	oldStart int
+	oldCount int
+	newStart int
+	newCount int
+	edits    []DiffEdit
+}
+
+// diffHunks groups the changes closer than twice the context
+func diffHunks(edits []DiffEdit, context int) []diffHunk {
+	var hunks []diffHunk
+	oldLine, newLine := 0, 0
+	start, end := -1, -1
+	hunkOldLine, hunkNewLine := 0, 0
+
+	flush := func() {
+		hunk := diffHunk{oldStart: hunkOldLine, newStart: hunkNewLine, edits: edits[start:end]}
+		for _, edit := range hunk.edits {
+			if edit.Op != DiffInsert {
+				hunk.oldCount++
+			}
+			if edit.Op != DiffDelete {
+				hunk.newCount++
+			}
+		}
+		hunks = append(hunks, hunk)
+	}
+
+	// Line numbers before each edit, to start the hunks
+	oldLines := make([]int, len(edits)+1)
+	newLines := make([]int, len(edits)+1)
+	for i, edit := range edits {
+		oldLines[i], newLines[i] = oldLine, newLine
+		if edit.Op != DiffInsert {
+			oldLine++
+		}
+		if edit.Op != DiffDelete {
+			newLine++
+		}
+	}
+	oldLines[len(edits)], newLines[len(edits)] = oldLine, newLine
+
+	for i, edit := range edits {
+		if edit.Op == DiffEqual {
+			continue
+		}
+		if start >= 0 && i-end <= 2*context {
+			end = i + 1
+			continue
+		}
+		if start >= 0 {
+			end += context
+			flush()
+		}
+		start = i - context
+		if start < 0 {
+			start = 0
+		}
+		end = i + 1
+		hunkOldLine, hunkNewLine = oldLines[start], newLines[start]
+	}
+	if start >= 0 {
+		end += context
+		if end > len(edits) {
+			end = len(edits)
+		}
+		flush()
+	}
+	return hunks
+}
+
+// hunkRange formats the range of a hunk, an empty range starts at the line before it
+func hunkRange(start int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// DiffSide is a line of one of the sides of a side-by-side diff, without its line feed
+type DiffSide struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// SideBySideRow pairs a line of the old content with a line of the new one, a side is nil when
+// the line was inserted or deleted, the lines of a changed row differ
+type SideBySideRow struct {
+	Op  string    `json:"op"`
+	Old *DiffSide `json:"old"`
+	New *DiffSide `json:"new"`
+}
+
+// SideBySideHunk is a group of rows, changes with their context lines
+type SideBySideHunk struct {
+	OldStart int             `json:"oldStart"`
+	NewStart int             `json:"newStart"`
+	Rows     []SideBySideRow `json:"rows"`
+}
+
+// SideBySide lays out the line edits in rows, grouped in hunks like UnifiedDiff does,
+// the deleted lines are paired with the lines inserted right after them
+func SideBySide(edits []DiffEdit, context int) []SideBySideHunk {
+	hunks := []SideBySideHunk{}
+	for _, hunk := range diffHunks(edits, context) {
+		sideBySide := SideBySideHunk{OldStart: hunk.oldStart + 1, NewStart: hunk.newStart + 1}
+		var deleted, inserted []*DiffSide
+		flush := func() {
+			for i := 0; i < len(deleted) || i < len(inserted); i++ {
+				row := SideBySideRow{Op: "change"}
+				if i < len(deleted) {
+					row.Old = deleted[i]
+				} else {
+					row.Op = "insert"
+				}
+				if i < len(inserted) {
+					row.New = inserted[i]
+				} else {
+					row.Op = "delete"
+				}
+				sideBySide.Rows = append(sideBySide.Rows, row)
+			}
+			deleted, inserted = nil, nil
+		}
+
+		for _, edit := range hunk.edits {
+			switch edit.Op {
+			case DiffDelete:
+				if len(inserted) > 0 {
+					flush()
+				}
+				deleted = append(deleted, &DiffSide{Line: edit.OldIndex + 1, Text: strings.TrimSuffix(edit.Text, "\n")})
+			case DiffInsert:
+				inserted = append(inserted, &DiffSide{Line: edit.NewIndex + 1, Text: strings.TrimSuffix(edit.Text, "\n")})
+			default:
+				flush()
+				text := strings.TrimSuffix(edit.Text, "\n")
+				sideBySide.Rows = append(sideBySide.Rows, SideBySideRow{
+					Op:  "equal",
+					Old: &DiffSide{Line: edit.OldIndex + 1, Text: text},
+					New: &DiffSide{Line: edit.NewIndex + 1, Text: text},
+				})
+			}
+		}
+		flush()
+		hunks = append(hunks, sideBySide)
+	}
+	return hunks
+}
+
+// DiffSegment is a run of text kept, deleted or inserted by a word diff
+type DiffSegment struct {
+	Op   DiffOp `json:"op"`
+	Text string `json:"text"`
+}
+
+// WordDiff diffs the words and the whitespace between them, consecutive edits of the same kind are
+// merged into segments, the whitespace is normalized like the lines with WhitespaceNormalizer
+func WordDiff(old string, new string, ignoreWhitespace string) ([]DiffSegment, error) {
+	normalize, err := WhitespaceNormalizer(ignoreWhitespace)
+	if err != nil {
+		return nil, err
+	}
+	// Words are compared as they are, whitespace ignored entirely still has to align
+	if normalize != nil {
+		normalizeWhitespace := normalize
+		normalize = func(token string) string {
+			if strings.TrimSpace(token) != "" {
+				return token
+			}
+			if normalized := normalizeWhitespace(token); normalized != "" {
+				return normalized
+			}
+			return " "
+		}
+	}
+
+	segments := []DiffSegment{}
+	for _, edit := range DiffNormalized(splitWordTokens(old), splitWordTokens(new), normalize) {
+		if last := len(segments) - 1; last >= 0 && segments[last].Op == edit.Op {
+			segments[last].Text += edit.Text
+			continue
+		}
+		segments = append(segments, DiffSegment{Op: edit.Op, Text: edit.Text})
+	}
+	return segments, nil
+}
+
+// splitWordTokens splits the text into words, runs of whitespace and single punctuation characters
+func splitWordTokens(text string) []string {
+	var tokens []string
+	start := 0
+	kind := 0
+	kindOf := func(r rune) int {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			return 1
+		case unicode.IsSpace(r):
+			return 2
+		}
+		return 3
+	}
+	for i, r := range text {
+		k := kindOf(r)
+		if i > start && (k != kind || k == 3) {
+			tokens = append(tokens, text[start:i])
+			start = i
+		}
+		kind = k
+	}
+	if start < len(text) {
+		tokens = append(tokens, text[start:])
+	}
+	return tokens
+}
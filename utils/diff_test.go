@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// applyEdits rebuilds both sequences from the edits
+func applyEdits(edits []DiffEdit) ([]string, []string) {
+	var a, b []string
+	for _, edit := range edits {
+		if edit.Op != DiffInsert {
+			a = append(a, edit.Text)
+		}
+		if edit.Op != DiffDelete {
+			b = append(b, edit.Text)
+		}
+	}
+	return a, b
+}
+
+func TestDiff(t *testing.T) {
+	a := strings.Split("ABCABBA", "")
+	b := strings.Split("CBABAC", "")
+	edits := Diff(a, b)
+
+	changes := 0
+	for _, edit := range edits {
+		if edit.Op != DiffEqual {
+			changes++
+		}
+	}
+	// The shortest edit script of the Myers paper
+	assert.Equal(t, 5, changes)
+	oldItems, newItems := applyEdits(edits)
+	assert.Equal(t, a, oldItems)
+	assert.Equal(t, b, newItems)
+
+	assert.Equal(t, []DiffEdit{{Op: DiffInsert, OldIndex: -1, NewIndex: 0, Text: "x"}}, Diff(nil, []string{"x"}))
+	assert.Empty(t, Diff(nil, nil))
+}
+
+func TestDiffTooManyChanges(t *testing.T) {
+	var a, b []string
+	for i := 0; i < maxDiffCost; i++ {
+		a = append(a, "a")
+		b = append(b, "b")
+	}
+	oldItems, newItems := applyEdits(Diff(a, b))
+	assert.Equal(t, a, oldItems)
+	assert.Equal(t, b, newItems)
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	old := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12"
+	new := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve"
+	edits := Diff(SplitLines(old), SplitLines(new))
+
+	assert.Equal(t, `--- old
++++ new
+@@ -1,5 +1,5 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+@@ -10,3 +10,3 @@
+ 10
+ 11
+-12
+\ No newline at end of file
++twelve
+\ No newline at end of file
+`, UnifiedDiff("old", "new", edits, 2))
+
+	// Close changes share a hunk
+	assert.Equal(t, 1, strings.Count(UnifiedDiff("old", "new", edits, 4), "@@ -"))
+	assert.Equal(t, "", UnifiedDiff("old", "new", Diff(SplitLines(old), SplitLines(old)), 3))
+}
+
+func TestDiffIgnoreWhitespace(t *testing.T) {
+	old := SplitLines("a  b\nc \n  d\n")
+	new := SplitLines("a b\nc\nd\n")
+
+	changes := func(ignore string) int {
+		normalize, err := WhitespaceNormalizer(ignore)
+		assert.NoError(t, err)
+		n := 0
+		for _, edit := range DiffNormalized(old, new, normalize) {
+			if edit.Op != DiffEqual {
+				n++
+			}
+		}
+		return n
+	}
+	assert.Equal(t, 6, changes(IgnoreWhitespaceNone))
+	assert.Equal(t, 4, changes(IgnoreWhitespaceTrailing))
+	assert.Equal(t, 2, changes(IgnoreWhitespaceChange))
+	assert.Equal(t, 0, changes(IgnoreWhitespaceAll))
+
+	_, err := WhitespaceNormalizer("some")
+	assert.Error(t, err)
+}
+
+func TestSideBySide(t *testing.T) {
+	edits := Diff(SplitLines("a\nb\nc\n"), SplitLines("a\nB\nc\nd\n"))
+	assert.Equal(t, []SideBySideHunk{{OldStart: 1, NewStart: 1, Rows: []SideBySideRow{
+		{Op: "equal", Old: &DiffSide{1, "a"}, New: &DiffSide{1, "a"}},
+		{Op: "change", Old: &DiffSide{2, "b"}, New: &DiffSide{2, "B"}},
+		{Op: "equal", Old: &DiffSide{3, "c"}, New: &DiffSide{3, "c"}},
+		{Op: "insert", New: &DiffSide{4, "d"}},
+	}}}, SideBySide(edits, 1))
+}
+
+func TestWordDiff(t *testing.T) {
+	segments, err := WordDiff("The quick brown fox.", "The slow brown  fox!", IgnoreWhitespaceChange)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []DiffSegment{
+			{Op: DiffEqual, Text: "The "},
+			{Op: DiffDelete, Text: "quick"},
+			{Op: DiffInsert, Text: "slow"},
+			{Op: DiffEqual, Text: " brown fox"},
+			{Op: DiffDelete, Text: "."},
+			{Op: DiffInsert, Text: "!"},
+		}, segments)
+	}
+}
@@ -0,0 +1,294 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DuplicateGroup is a set of files with identical content,
+// the wasted bytes are the bytes used by all the copies but one
+type DuplicateGroup struct {
+	Hash        string   `json:"hash"`
+	Size        int64    `json:"size"`
+	FilePaths   []string `json:"filePaths"`
+	WastedBytes int64    `json:"wastedBytes"`
+}
+
+// NearDuplicateGroup is a set of files similar to each other, the similarity is the lowest
+// estimated Jaccard similarity of the word shingles of two linked files of the group,
+// the wasted bytes are the bytes used by all the files but the largest one
+type NearDuplicateGroup struct {
+	FilePaths   []string `json:"filePaths"`
+	Similarity  float64  `json:"similarity"`
+	WastedBytes int64    `json:"wastedBytes"`
+}
+
+// NearDuplicateOptions configure the MinHash based near-duplicate detection
+type NearDuplicateOptions struct {
+	// Number of consecutive words in a shingle
+	ShingleSize int
+	// Minimum estimated Jaccard similarity of two near-duplicates, from 0 to 1
+	Threshold float64
+}
+
+const (
+	// Number of hash functions of a MinHash signature, split into bands for locality sensitive hashing
+	minHashSize  = 128
+	minHashBands = 32
+	minHashRows  = minHashSize / minHashBands
+)
+
+// FindDuplicates groups the files by size first, and then hashes the files sharing their size
+// with another one, empty files are ignored
+func FindDuplicates(filePaths []string, fileInfos []os.FileInfo) ([]DuplicateGroup, error) {
+	bySize := make(map[int64][]string)
+	for i, filePath := range filePaths {
+		size, err := ContentSize(filePath, fileInfos[i])
+		if err != nil {
+			return nil, err
+		}
+		if size > 0 {
+			bySize[size] = append(bySize[size], filePath)
+		}
+	}
+
+	var groups []DuplicateGroup
+	for size, candidates := range bySize {
+		if len(candidates) < 2 {
+			continue
+		}
+
+		byHash := make(map[string][]string)
+		for _, filePath := range candidates {
+			hash, err := HashFile(filePath)
+			if err != nil {
+				return nil, err
+			}
+			byHash[hash] = append(byHash[hash], filePath)
+		}
+
+		for hash, duplicates := range byHash {
+			if len(duplicates) < 2 {
+				continue
+			}
+			sort.Strings(duplicates)
+			groups = append(groups, DuplicateGroup{
+				Hash:        hash,
+				Size:        size,
+				FilePaths:   duplicates,
+				WastedBytes: size * int64(len(duplicates)-1),
+			})
+		}
+	}
+
+	// Most wasteful groups first
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].WastedBytes != groups[j].WastedBytes {
+			return groups[i].WastedBytes > groups[j].WastedBytes
+		}
+		return groups[i].FilePaths[0] < groups[j].FilePaths[0]
+	})
+	return groups, nil
+}
+
+// HashFile returns the hex encoded SHA-256 of the content of the file
+func HashFile(filePath string) (string, error) {
+	file, err := OpenFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// FindNearDuplicates computes the MinHash signature of the word shingles of every file,
+// finds the candidate pairs sharing a band of their signatures and links the pairs whose
+// estimated similarity reaches the threshold, linked files are grouped together
+func FindNearDuplicates(filePaths []string, fileInfos []os.FileInfo,
+	options NearDuplicateOptions) ([]NearDuplicateGroup, error) {
+	signatures := make([][]uint64, len(filePaths))
+	for i, filePath := range filePaths {
+		signature, err := fileMinHash(filePath, options.ShingleSize)
+		if err != nil {
+			return nil, err
+		}
+		signatures[i] = signature
+	}
+
+	// Locality sensitive hashing, files sharing all the rows of a band are candidates
+	candidates := make(map[[2]int]bool)
+	for band := 0; band < minHashBands; band++ {
+		buckets := make(map[string][]int)
+		for i, signature := range signatures {
+			if signature == nil {
+				continue
+			}
+			key := make([]byte, 8*minHashRows)
+			for row, value := range signature[band*minHashRows : (band+1)*minHashRows] {
+				binary.LittleEndian.PutUint64(key[8*row:], value)
+			}
+			buckets[string(key)] = append(buckets[string(key)], i)
+		}
+		for _, bucket := range buckets {
+			for x := 0; x < len(bucket); x++ {
+				for y := x + 1; y < len(bucket); y++ {
+					candidates[[2]int{bucket[x], bucket[y]}] = true
+				}
+			}
+		}
+	}
+
+	// Link the candidates that are similar enough
+	parents := make([]int, len(filePaths))
+	for i := range parents {
+		parents[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parents[i] != i {
+			parents[i] = find(parents[i])
+		}
+		return parents[i]
+	}
+
+	groupSimilarity := make(map[int]float64)
+	type link struct {
+		x, y       int
+		similarity float64
+	}
+	var links []link
+	for pair := range candidates {
+		similarity := signatureSimilarity(signatures[pair[0]], signatures[pair[1]])
+		if similarity >= options.Threshold {
+			links = append(links, link{pair[0], pair[1], similarity})
+			parents[find(pair[0])] = find(pair[1])
+		}
+	}
+	for _, l := range links {
+		root := find(l.x)
+		if current, ok := groupSimilarity[root]; !ok || l.similarity < current {
+			groupSimilarity[root] = l.similarity
+		}
+	}
+
+	members := make(map[int][]int)
+	for i := range filePaths {
+		if _, ok := groupSimilarity[find(i)]; ok {
+			members[find(i)] = append(members[find(i)], i)
+		}
+	}
+
+	groups := make([]NearDuplicateGroup, 0, len(members))
+	for root, indexes := range members {
+		group := NearDuplicateGroup{Similarity: groupSimilarity[root]}
+		var largest int64
+		for _, i := range indexes {
+			group.FilePaths = append(group.FilePaths, filePaths[i])
+			// The size of the content, as for the exact duplicates
+			size, err := ContentSize(filePaths[i], fileInfos[i])
+			if err != nil {
+				return nil, err
+			}
+			group.WastedBytes += size
+			if size > largest {
+				largest = size
+			}
+		}
+		group.WastedBytes -= largest
+		sort.Strings(group.FilePaths)
+		groups = append(groups, group)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].WastedBytes != groups[j].WastedBytes {
+			return groups[i].WastedBytes > groups[j].WastedBytes
+		}
+		return groups[i].FilePaths[0] < groups[j].FilePaths[0]
+	})
+	return groups, nil
+}
+
+// fileMinHash returns the MinHash signature of the word shingles of the file,
+// or nil if the file has no word
+func fileMinHash(filePath string, shingleSize int) ([]uint64, error) {
+	signature := make([]uint64, minHashSize)
+	for i := range signature {
+		signature[i] = ^uint64(0)
+	}
+
+	empty := true
+	addShingle := func(shingle []string) {
+		empty = false
+		hash := hashWord(strings.Join(shingle, " "))
+		for i := range signature {
+			if value := mix64(hash ^ minHashSeeds[i]); value < signature[i] {
+				signature[i] = value
+			}
+		}
+	}
+
+	// Files shorter than a shingle are a single shingle
+	var window []string
+	err := ScanFileWords(filePath, func(words []string) {
+		for _, word := range words {
+			window = append(window, strings.ToLower(word))
+			if len(window) > shingleSize {
+				window = window[1:]
+			}
+			if len(window) == shingleSize {
+				addShingle(window)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if empty && len(window) > 0 {
+		addShingle(window)
+	}
+	if empty {
+		return nil, nil
+	}
+	return signature, nil
+}
+
+// signatureSimilarity estimates the Jaccard similarity as the share of equal signature values
+func signatureSimilarity(x []uint64, y []uint64) float64 {
+	equal := 0
+	for i := range x {
+		if x[i] == y[i] {
+			equal++
+		}
+	}
+	return float64(equal) / float64(len(x))
+}
+
+var minHashSeeds = func() []uint64 {
+	seeds := make([]uint64, minHashSize)
+	seed := uint64(0x9e3779b97f4a7c15)
+	for i := range seeds {
+		seed = mix64(seed + uint64(i))
+		seeds[i] = seed
+	}
+	return seeds
+}()
+
+// mix64 is the finalizer of splitmix64, it turns a hash into a well distributed one
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	dir := createTestTree(t, map[string]string{
+		"a.txt":      "the same content",
+		"sub/b.txt":  "the same content",
+		"sub/c.txt":  "the same content",
+		"d.txt":      "same size content",
+		"e.txt":      "unique",
+		"empty1.txt": "",
+		"empty2.txt": "",
+	})
+	defer os.RemoveAll(dir)
+
+	result, err := WalkEntryPoint(dir, DefaultWalkOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := FindDuplicates(result.FilePaths, result.FileInfos)
+	if assert.NoError(t, err) && assert.Equal(t, 1, len(groups)) {
+		assert.Equal(t, []string{
+			filepath.Join(dir, "a.txt"),
+			filepath.Join(dir, "sub", "b.txt"),
+			filepath.Join(dir, "sub", "c.txt"),
+		}, groups[0].FilePaths)
+		assert.Equal(t, int64(16), groups[0].Size)
+		assert.Equal(t, int64(32), groups[0].WastedBytes)
+		assert.Equal(t, 64, len(groups[0].Hash))
+	}
+}
+
+func TestFindNearDuplicates(t *testing.T) {
+	text := "As of 2017, text messages are used by youth and adults for personal, family, business and " +
+		"social purposes. Governmental and non-governmental organizations use text messaging for " +
+		"communication between colleagues. In the 2010s, the sending of short informal messages has " +
+		"become an accepted part of many cultures."
+	dir := createTestTree(t, map[string]string{
+		"original.txt": text,
+		"edited.txt":   text + " This makes texting a quick way to communicate.",
+		"other.txt":    "There are a growing number of websites that allow users to send free SMS messages online.",
+	})
+	defer os.RemoveAll(dir)
+
+	result, err := WalkEntryPoint(dir, DefaultWalkOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := FindNearDuplicates(result.FilePaths, result.FileInfos,
+		NearDuplicateOptions{ShingleSize: 3, Threshold: 0.7})
+	if assert.NoError(t, err) && assert.Equal(t, 1, len(groups)) {
+		assert.Equal(t, []string{filepath.Join(dir, "edited.txt"), filepath.Join(dir, "original.txt")},
+			groups[0].FilePaths)
+		assert.True(t, groups[0].Similarity >= 0.7)
+		assert.Equal(t, int64(len(text)), groups[0].WastedBytes)
+	}
+
+	// The wasted bytes are counted on the content, e.g. of compressed files
+	defer func(contentSize func(string, os.FileInfo) (int64, error)) { ContentSize = contentSize }(ContentSize)
+	ContentSize = func(filePath string, fi os.FileInfo) (int64, error) {
+		return 2 * fi.Size(), nil
+	}
+	groups, err = FindNearDuplicates(result.FilePaths, result.FileInfos,
+		NearDuplicateOptions{ShingleSize: 3, Threshold: 0.7})
+	if assert.NoError(t, err) && assert.Equal(t, 1, len(groups)) {
+		assert.Equal(t, int64(2*len(text)), groups[0].WastedBytes)
+	}
+}
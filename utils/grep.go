@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"regexp"
+	"time"
+)
+
+// Longest line GrepFile can read
+const maxGrepLineBytes = 1024 * 1024
+
+// ErrDeadline is returned by GrepFile and WalkEntryPoint when the deadline passed before their end
+var ErrDeadline = errors.New("deadline exceeded")
+
+// GrepMatch is a line matching a regexp, with up to the requested number of lines before and after it
+type GrepMatch struct {
+	Path   string   `json:"path"`
+	Line   int      `json:"line"`
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+// GrepOptions control a GrepFile run
+type GrepOptions struct {
+	// Number of lines reported before and after every matching line
+	Context int
+	// The file is read until this time, no limit if zero
+	Deadline time.Time
+}
+
+// GrepFile calls fn with every line of the file matching the regexp, in order, until fn returns false.
+// Matches are reported once their following context lines are read, contexts of close matches overlap.
+func GrepFile(filePath string, re *regexp.Regexp, options GrepOptions, fn func(GrepMatch) bool) error {
+	file, err := OpenFile(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxGrepLineBytes)
+
+	var before []string
+	var pending []*GrepMatch
+	for line := 1; scanner.Scan(); line++ {
+		if !options.Deadline.IsZero() && time.Now().After(options.Deadline) {
+			return ErrDeadline
+		}
+		text := scanner.Text()
+
+		// Complete the context of the previous matches
+		for len(pending) > 0 && len(pending[0].After) == options.Context {
+			if !fn(*pending[0]) {
+				return nil
+			}
+			pending = pending[1:]
+		}
+		for _, match := range pending {
+			match.After = append(match.After, text)
+		}
+
+		if re.MatchString(text) {
+			match := &GrepMatch{Path: filePath, Line: line, Text: text}
+			if len(before) > 0 {
+				match.Before = append([]string(nil), before...)
+			}
+			pending = append(pending, match)
+		}
+
+		if options.Context > 0 {
+			before = append(before, text)
+			if len(before) > options.Context {
+				before = before[1:]
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for _, match := range pending {
+		if !fn(*match) {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestGrepFile(t *testing.T) {
+	dir := createTestTree(t, map[string]string{"a.txt": "one\ntwo\nthree\nfour\nfive\nsix"})
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "a.txt")
+
+	var matches []GrepMatch
+	collect := func(match GrepMatch) bool {
+		matches = append(matches, match)
+		return true
+	}
+
+	err := GrepFile(filePath, regexp.MustCompile("^t"), GrepOptions{}, collect)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []GrepMatch{
+			{Path: filePath, Line: 2, Text: "two"},
+			{Path: filePath, Line: 3, Text: "three"},
+		}, matches)
+	}
+
+	// Context lines, cut by the beginning and the end of the file
+	matches = nil
+	err = GrepFile(filePath, regexp.MustCompile("one|four|six"), GrepOptions{Context: 1}, collect)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []GrepMatch{
+			{Path: filePath, Line: 1, Text: "one", After: []string{"two"}},
+			{Path: filePath, Line: 4, Text: "four", Before: []string{"three"}, After: []string{"five"}},
+			{Path: filePath, Line: 6, Text: "six", Before: []string{"five"}},
+		}, matches)
+	}
+
+	// Stopped by the callback
+	matches = nil
+	err = GrepFile(filePath, regexp.MustCompile("e"), GrepOptions{}, func(match GrepMatch) bool {
+		matches = append(matches, match)
+		return len(matches) < 2
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(matches))
+
+	// Stopped by the deadline
+	err = GrepFile(filePath, regexp.MustCompile("e"), GrepOptions{Deadline: time.Now().Add(-time.Second)}, collect)
+	assert.Equal(t, ErrDeadline, err)
+}
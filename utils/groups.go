@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Group of the files placed directly in the entry point, or without extension
+const (
+	RootGroup        = "."
+	NoExtensionGroup = "(none)"
+)
+
+// SubdirectoryOf returns the immediate subdirectory of the entry point containing the file
+func SubdirectoryOf(entryPoint string, filePath string) (string, error) {
+	relativePath, err := filepath.Rel(entryPoint, filePath)
+	if err != nil {
+		return "", err
+	}
+
+	parts := strings.Split(filepath.ToSlash(relativePath), "/")
+	if len(parts) == 1 {
+		return RootGroup, nil
+	}
+	return parts[0], nil
+}
+
+// DepthOf returns the number of directories between the entry point and the file
+func DepthOf(entryPoint string, filePath string) (int, error) {
+	relativePath, err := filepath.Rel(entryPoint, filePath)
+	if err != nil {
+		return 0, err
+	}
+	return strings.Count(filepath.ToSlash(relativePath), "/"), nil
+}
+
+// ExtensionOf returns the lower case extension of the file
+func ExtensionOf(filePath string) string {
+	extension := strings.ToLower(filepath.Ext(filePath))
+	if extension == "" {
+		return NoExtensionGroup
+	}
+	return extension
+}
+
+// TimeBucket returns the day (2006-01-02), the ISO week (2006-W01) or the month (2006-01)
+// of a time, e.g. the time a file was last modified
+func TimeBucket(t time.Time, bucket string) (string, error) {
+	t = t.UTC()
+	switch bucket {
+	case "day":
+		return t.Format("2006-01-02"), nil
+	case "week":
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week), nil
+	case "month":
+		return t.Format("2006-01"), nil
+	}
+	return "", fmt.Errorf("unknown time bucket: %s", bucket)
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSubdirectoryOf(t *testing.T) {
+	group, _ := SubdirectoryOf("../data", "../data/text_files/text1.txt")
+	assert.Equal(t, "text_files", group)
+
+	group, _ = SubdirectoryOf("../data", "../data/test.txt")
+	assert.Equal(t, RootGroup, group)
+}
+
+func TestDepthOf(t *testing.T) {
+	depth, _ := DepthOf("../data", "../data/text_files/text1.txt")
+	assert.Equal(t, 1, depth)
+
+	depth, _ = DepthOf("../data", "../data/test.txt")
+	assert.Equal(t, 0, depth)
+}
+
+func TestExtensionOf(t *testing.T) {
+	assert.Equal(t, ".txt", ExtensionOf("../data/text_files/TEXT1.TXT"))
+	assert.Equal(t, NoExtensionGroup, ExtensionOf("../data/README"))
+}
+
+func TestTimeBucket(t *testing.T) {
+	date := time.Date(2021, time.January, 3, 12, 0, 0, 0, time.UTC)
+
+	bucket, _ := TimeBucket(date, "day")
+	assert.Equal(t, "2021-01-03", bucket)
+	bucket, _ = TimeBucket(date, "week")
+	assert.Equal(t, "2020-W53", bucket)
+	bucket, _ = TimeBucket(date, "month")
+	assert.Equal(t, "2021-01", bucket)
+
+	_, err := TimeBucket(date, "year")
+	assert.Error(t, err)
+}
@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"bufio"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Glob is a shell pattern, "*" and "?" never match a "/" but "**" matches any number of directories.
+// Patterns containing a "/" are matched against the path relative to the entry point,
+// other patterns are matched against the base name only.
+type Glob struct {
+	pattern  string
+	anchored bool
+	re       *regexp.Regexp
+}
+
+func CompileGlob(pattern string) (*Glob, error) {
+	pattern = strings.TrimPrefix(pattern, "./")
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	re, err := regexp.Compile("^" + globToRegexp(pattern) + "$")
+	if err != nil {
+		return nil, err
+	}
+	return &Glob{pattern: pattern, anchored: anchored, re: re}, nil
+}
+
+// Match reports whether the slash separated relative path matches the glob
+func (g *Glob) Match(relativePath string) bool {
+	if g.anchored {
+		return g.re.MatchString(relativePath)
+	}
+	return g.re.MatchString(path.Base(relativePath))
+}
+
+func globToRegexp(pattern string) string {
+	var sb strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; ch {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**/") {
+				sb.WriteString("(.*/)?")
+				i += 2
+			} else if strings.HasPrefix(pattern[i:], "**") {
+				sb.WriteString(".*")
+				i++
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			i += end
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	return sb.String()
+}
+
+// ignoreRule is a line of an ignore file
+type ignoreRule struct {
+	glob    *Glob
+	negate  bool
+	dirOnly bool
+}
+
+// IgnoreRules are the rules of a .gitignore-style file, relative to the directory containing it
+type IgnoreRules struct {
+	baseDir string
+	rules   []ignoreRule
+}
+
+// ReadIgnoreFile parses a .gitignore-style file, baseDir is the slash separated path
+// of its directory relative to the entry point
+func ReadIgnoreFile(filePath string, baseDir string) (*IgnoreRules, error) {
+	file, err := OpenFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ignoreRules := &IgnoreRules{baseDir: baseDir}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if rule.glob, err = CompileGlob(line); err != nil {
+			return nil, err
+		}
+		ignoreRules.rules = append(ignoreRules.rules, rule)
+	}
+	return ignoreRules, scanner.Err()
+}
+
+// Match returns whether the path relative to the entry point is ignored or explicitly un-ignored,
+// matched is false if no rule applies to the path
+func (ir *IgnoreRules) Match(relativePath string, isDir bool) (ignored bool, matched bool) {
+	if ir.baseDir != "" && ir.baseDir != "." {
+		if !strings.HasPrefix(relativePath, ir.baseDir+"/") {
+			return false, false
+		}
+		relativePath = strings.TrimPrefix(relativePath, ir.baseDir+"/")
+	}
+
+	// The last matching rule wins
+	for _, rule := range ir.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.glob.Match(relativePath) {
+			ignored, matched = !rule.negate, true
+		}
+	}
+	return ignored, matched
+}
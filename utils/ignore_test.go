@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGlobMatch(t *testing.T) {
+	glob, _ := CompileGlob("*.txt")
+	assert.True(t, glob.Match("text_files/text1.txt"))
+	assert.False(t, glob.Match("text_files/text1.txt.tmp"))
+
+	glob, _ = CompileGlob("text_files/*.txt")
+	assert.True(t, glob.Match("text_files/text1.txt"))
+	assert.False(t, glob.Match("other/text_files/text1.txt"))
+
+	glob, _ = CompileGlob("**/text?.txt")
+	assert.True(t, glob.Match("text1.txt"))
+	assert.True(t, glob.Match("a/b/text2.txt"))
+
+	glob, _ = CompileGlob("text[!2].txt")
+	assert.True(t, glob.Match("text1.txt"))
+	assert.False(t, glob.Match("text2.txt"))
+}
+
+func TestReadIgnoreFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ignoreFile := filepath.Join(dir, ".gitignore")
+	content := "# temporary files\n*.tmp\n!keep.tmp\nbuild/\n/root.txt\n"
+	if err := ioutil.WriteFile(ignoreFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := ReadIgnoreFile(ignoreFile, "sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ignored, _ := rules.Match("sub/a/file.tmp", false)
+	assert.True(t, ignored)
+	ignored, _ = rules.Match("sub/keep.tmp", false)
+	assert.False(t, ignored)
+	ignored, _ = rules.Match("sub/build", true)
+	assert.True(t, ignored)
+	ignored, _ = rules.Match("sub/build", false)
+	assert.False(t, ignored)
+	ignored, _ = rules.Match("sub/root.txt", false)
+	assert.True(t, ignored)
+	ignored, _ = rules.Match("sub/a/root.txt", false)
+	assert.False(t, ignored)
+	_, matched := rules.Match("other/file.tmp", false)
+	assert.False(t, matched)
+}
@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Sample texts the language profiles are built from, the detector works offline
+// by comparing the character trigram ranks of a text with the ranks of these samples.
+var languageSamples = map[string]string{
+	"english": `All human beings are born free and equal in dignity and rights. They are endowed with reason
+		and conscience and should act towards one another in a spirit of brotherhood. Everyone has the right to
+		life, liberty and security of person. The weather was nice this morning, so we walked to the market and
+		bought some fresh bread, cheese and vegetables for the whole family. Which of these books would you like
+		to read first? I think that the story about the old house near the river is the most interesting one.
+		There were many people waiting at the station when the train finally arrived with a long delay.`,
+	"french": `Tous les êtres humains naissent libres et égaux en dignité et en droits. Ils sont doués de raison
+		et de conscience et doivent agir les uns envers les autres dans un esprit de fraternité. Tout individu a
+		droit à la vie, à la liberté et à la sûreté de sa personne. Le temps était beau ce matin, alors nous
+		sommes allés au marché pour acheter du pain frais, du fromage et des légumes pour toute la famille.
+		Lequel de ces livres voulez-vous lire en premier? Je pense que l'histoire de la vieille maison près de
+		la rivière est la plus intéressante. Il y avait beaucoup de monde qui attendait à la gare quand le train
+		est enfin arrivé avec un long retard.`,
+	"german": `Alle Menschen sind frei und gleich an Würde und Rechten geboren. Sie sind mit Vernunft und
+		Gewissen begabt und sollen einander im Geist der Brüderlichkeit begegnen. Jeder hat das Recht auf Leben,
+		Freiheit und Sicherheit der Person. Das Wetter war heute Morgen schön, deshalb sind wir zum Markt
+		gegangen und haben frisches Brot, Käse und Gemüse für die ganze Familie gekauft. Welches dieser Bücher
+		möchtest du zuerst lesen? Ich glaube, dass die Geschichte über das alte Haus am Fluss die interessanteste
+		ist. Es warteten viele Leute am Bahnhof, als der Zug endlich mit einer langen Verspätung ankam.`,
+	"spanish": `Todos los seres humanos nacen libres e iguales en dignidad y derechos y, dotados como están de
+		razón y conciencia, deben comportarse fraternalmente los unos con los otros. Todo individuo tiene derecho
+		a la vida, a la libertad y a la seguridad de su persona. El tiempo era bueno esta mañana, así que fuimos
+		al mercado y compramos pan fresco, queso y verduras para toda la familia. ¿Cuál de estos libros quieres
+		leer primero? Creo que la historia de la casa vieja cerca del río es la más interesante. Había mucha
+		gente esperando en la estación cuando el tren por fin llegó con un largo retraso.`,
+	"italian": `Tutti gli esseri umani nascono liberi ed eguali in dignità e diritti. Essi sono dotati di ragione
+		e di coscienza e devono agire gli uni verso gli altri in spirito di fratellanza. Ogni individuo ha
+		diritto alla vita, alla libertà ed alla sicurezza della propria persona. Il tempo era bello questa
+		mattina, così siamo andati al mercato e abbiamo comprato pane fresco, formaggio e verdure per tutta la
+		famiglia. Quale di questi libri vuoi leggere per primo? Penso che la storia della vecchia casa vicino al
+		fiume sia la più interessante. C'erano molte persone che aspettavano alla stazione quando il treno è
+		finalmente arrivato con un lungo ritardo.`,
+	"portuguese": `Todos os seres humanos nascem livres e iguais em dignidade e em direitos. Dotados de razão e
+		de consciência, devem agir uns para com os outros em espírito de fraternidade. Todo o indivíduo tem
+		direito à vida, à liberdade e à segurança pessoal. O tempo estava bom esta manhã, então fomos ao mercado
+		e compramos pão fresco, queijo e legumes para toda a família. Qual destes livros você quer ler
+		primeiro? Acho que a história da casa velha perto do rio é a mais interessante. Havia muitas pessoas
+		esperando na estação quando o trem finalmente chegou com um longo atraso.`,
+	"dutch": `Alle mensen worden vrij en gelijk in waardigheid en rechten geboren. Zij zijn begiftigd met
+		verstand en geweten, en behoren zich jegens elkander in een geest van broederschap te gedragen. Een
+		ieder heeft recht op leven, vrijheid en onschendbaarheid van zijn persoon. Het weer was mooi vanochtend,
+		dus zijn we naar de markt gelopen en hebben we vers brood, kaas en groenten voor de hele familie gekocht.
+		Welk van deze boeken wil je als eerste lezen? Ik denk dat het verhaal over het oude huis bij de rivier
+		het interessantste is. Er stonden veel mensen te wachten op het station toen de trein eindelijk met een
+		lange vertraging aankwam.`,
+}
+
+const (
+	// Number of most frequent trigrams kept in a profile
+	profileSize = 300
+	// Number of bytes read from a file to detect its language
+	languageSampleBytes = 64 * 1024
+	// Texts with fewer trigrams are too short to be classified
+	minLanguageTrigrams = 20
+	// Language reported when the text cannot be classified
+	UnknownLanguage = "unknown"
+)
+
+var languageProfiles = buildLanguageProfiles()
+
+// LanguageGuess is the detected language of a text and the confidence of the detection, from 0 to 1
+type LanguageGuess struct {
+	Language   string  `json:"language"`
+	Confidence float64 `json:"confidence"`
+}
+
+// Languages returns the languages the detector knows about
+func Languages() []string {
+	languages := make([]string, 0, len(languageProfiles))
+	for language := range languageProfiles {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// DetectLanguage classifies the text with the out-of-place measure of Cavnar and Trenkle:
+// the distance to a language is the sum of the differences between the rank of each trigram
+// in the text and its rank in the language profile.
+func DetectLanguage(text string) LanguageGuess {
+	counts := countTrigrams(text)
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	if total < minLanguageTrigrams {
+		return LanguageGuess{Language: UnknownLanguage}
+	}
+
+	profile := rankTrigrams(counts)
+	best, second := "", ""
+	distances := make(map[string]int)
+	for language, languageProfile := range languageProfiles {
+		distance := 0
+		for trigram, rank := range profile {
+			languageRank, ok := languageProfile[trigram]
+			if !ok {
+				distance += profileSize
+			} else if rank > languageRank {
+				distance += rank - languageRank
+			} else {
+				distance += languageRank - rank
+			}
+		}
+		distances[language] = distance
+
+		if best == "" || distance < distances[best] || (distance == distances[best] && language < best) {
+			best, second = language, best
+		} else if second == "" || distance < distances[second] {
+			second = language
+		}
+	}
+
+	// The confidence is the relative gap between the best and the second best language
+	confidence := 0.0
+	if distances[second] > 0 {
+		confidence = float64(distances[second]-distances[best]) / float64(distances[second])
+	}
+	return LanguageGuess{Language: best, Confidence: confidence}
+}
+
+// DetectFileLanguage classifies the beginning of the file
+func DetectFileLanguage(filePath string) (LanguageGuess, error) {
+	file, err := OpenFile(filePath)
+	if err != nil {
+		return LanguageGuess{}, err
+	}
+	defer file.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(file, languageSampleBytes))
+	if err != nil {
+		return LanguageGuess{}, err
+	}
+	return DetectLanguage(string(b)), nil
+}
+
+func buildLanguageProfiles() map[string]map[string]int {
+	profiles := make(map[string]map[string]int)
+	for language, sample := range languageSamples {
+		profiles[language] = rankTrigrams(countTrigrams(sample))
+	}
+	return profiles
+}
+
+// countTrigrams counts the character trigrams of every word padded with a space on both sides
+func countTrigrams(text string) map[string]int {
+	counts := make(map[string]int)
+	for _, field := range strings.Fields(strings.ToLower(text)) {
+		runes := []rune{' '}
+		for _, r := range field {
+			if unicode.IsLetter(r) {
+				runes = append(runes, r)
+			}
+		}
+		if len(runes) == 1 {
+			continue
+		}
+		runes = append(runes, ' ')
+
+		for i := 0; i+3 <= len(runes); i++ {
+			counts[string(runes[i:i+3])]++
+		}
+	}
+	return counts
+}
+
+// rankTrigrams ranks the profileSize most frequent trigrams, the most frequent one has rank 0
+func rankTrigrams(counts map[string]int) map[string]int {
+	trigrams := make([]string, 0, len(counts))
+	for trigram := range counts {
+		trigrams = append(trigrams, trigram)
+	}
+	sort.Slice(trigrams, func(i, j int) bool {
+		if counts[trigrams[i]] != counts[trigrams[j]] {
+			return counts[trigrams[i]] > counts[trigrams[j]]
+		}
+		return trigrams[i] < trigrams[j]
+	})
+	if len(trigrams) > profileSize {
+		trigrams = trigrams[:profileSize]
+	}
+
+	ranks := make(map[string]int, len(trigrams))
+	for rank, trigram := range trigrams {
+		ranks[trigram] = rank
+	}
+	return ranks
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	texts := map[string]string{
+		"english":    "The quick brown fox jumps over the lazy dog while the children are playing in the garden.",
+		"french":     "Le petit chat dort sur le canapé pendant que les enfants jouent dans le jardin avec leurs amis.",
+		"german":     "Der kleine Hund schläft auf dem Sofa, während die Kinder mit ihren Freunden im Garten spielen.",
+		"spanish":    "El pequeño gato duerme en el sofá mientras los niños juegan en el jardín con sus amigos.",
+		"italian":    "Il piccolo gatto dorme sul divano mentre i bambini giocano nel giardino con i loro amici.",
+		"portuguese": "O pequeno gato dorme no sofá enquanto as crianças brincam no jardim com os seus amigos.",
+		"dutch":      "De kleine kat slaapt op de bank terwijl de kinderen met hun vrienden in de tuin spelen.",
+	}
+
+	for language, text := range texts {
+		guess := DetectLanguage(text)
+		assert.Equal(t, language, guess.Language)
+		assert.True(t, guess.Confidence > 0)
+	}
+	assert.Equal(t, UnknownLanguage, DetectLanguage("ok").Language)
+}
+
+func TestDetectFileLanguage(t *testing.T) {
+	filePath := "../data/text_files/text1.txt"
+
+	guess, err := DetectFileLanguage(filePath)
+	if err != nil {
+		log.Fatalf("Failed to detect the language of file: %s, error: %v", filePath, err)
+	}
+	assert.Equal(t, "english", guess.Language)
+}
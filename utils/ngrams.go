@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// NGram is a sequence of consecutive words and the number of times it occurs
+type NGram struct {
+	Words []string `json:"words"`
+	Count int      `json:"count"`
+	PMI   float64  `json:"pmi,omitempty"`
+}
+
+// NGramCounter counts the n-grams of the files added to it,
+// n-grams span line breaks but never span two files.
+type NGramCounter struct {
+	n           int
+	caseFolding bool
+	tokenCount  int
+	ngramCount  int
+	words       map[string]int
+	ngrams      map[string]int
+}
+
+// Separator used to join the words of an n-gram into a map key
+const ngramSeparator = "\x00"
+
+func NewNGramCounter(n int, caseFolding bool) *NGramCounter {
+	return &NGramCounter{
+		n:           n,
+		caseFolding: caseFolding,
+		words:       make(map[string]int),
+		ngrams:      make(map[string]int),
+	}
+}
+
+// AddFile counts the words and n-grams of the file
+func (nc *NGramCounter) AddFile(filePath string) error {
+	var window []string
+	return ScanFileWords(filePath, func(words []string) {
+		for _, word := range words {
+			if nc.caseFolding {
+				word = strings.ToLower(word)
+			}
+			nc.words[word]++
+			nc.tokenCount++
+
+			window = append(window, word)
+			if len(window) > nc.n {
+				window = window[1:]
+			}
+			if len(window) == nc.n {
+				nc.ngrams[strings.Join(window, ngramSeparator)]++
+				nc.ngramCount++
+			}
+		}
+	})
+}
+
+// Top returns at most topN n-grams occurring at least minFrequency times,
+// ordered by pointwise mutual information if scorePMI is set, or by frequency otherwise.
+func (nc *NGramCounter) Top(minFrequency int, topN int, scorePMI bool) []NGram {
+	ngrams := make([]NGram, 0)
+	for key, count := range nc.ngrams {
+		if count < minFrequency {
+			continue
+		}
+		ngram := NGram{Words: strings.Split(key, ngramSeparator), Count: count}
+		if scorePMI {
+			ngram.PMI = nc.pmi(ngram)
+		}
+		ngrams = append(ngrams, ngram)
+	}
+
+	sort.Slice(ngrams, func(i, j int) bool {
+		if scorePMI && ngrams[i].PMI != ngrams[j].PMI {
+			return ngrams[i].PMI > ngrams[j].PMI
+		}
+		if ngrams[i].Count != ngrams[j].Count {
+			return ngrams[i].Count > ngrams[j].Count
+		}
+		return strings.Join(ngrams[i].Words, " ") < strings.Join(ngrams[j].Words, " ")
+	})
+	if len(ngrams) > topN {
+		ngrams = ngrams[:topN]
+	}
+	return ngrams
+}
+
+// pmi is log2(P(w1...wn) / (P(w1) * ... * P(wn)))
+func (nc *NGramCounter) pmi(ngram NGram) float64 {
+	score := math.Log2(float64(ngram.Count) / float64(nc.ngramCount))
+	for _, word := range ngram.Words {
+		score -= math.Log2(float64(nc.words[word]) / float64(nc.tokenCount))
+	}
+	return score
+}
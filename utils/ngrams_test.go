@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNGramCounter(t *testing.T) {
+	filePath := "../data/text_files/text2.txt"
+
+	counter := NewNGramCounter(2, true)
+	if err := counter.AddFile(filePath); err != nil {
+		log.Fatalf("Failed to count the n-grams of file: %s, error: %v", filePath, err)
+	}
+
+	bigrams := counter.Top(2, 10, false)
+	assert.Equal(t, []NGram{{Words: []string{"free", "sms"}, Count: 2}}, bigrams)
+
+	trigrams := NewNGramCounter(3, true)
+	if err := trigrams.AddFile(filePath); err != nil {
+		log.Fatalf("Failed to count the n-grams of file: %s, error: %v", filePath, err)
+	}
+	assert.Equal(t, 0, len(trigrams.Top(2, 10, false)))
+}
+
+func TestNGramCounterPMI(t *testing.T) {
+	filePath := "../data/text_files/text1.txt"
+
+	counter := NewNGramCounter(2, true)
+	if err := counter.AddFile(filePath); err != nil {
+		log.Fatalf("Failed to count the n-grams of file: %s, error: %v", filePath, err)
+	}
+
+	bigrams := counter.Top(2, 5, true)
+	assert.Equal(t, 2, len(bigrams))
+	for i := 1; i < len(bigrams); i++ {
+		assert.True(t, bigrams[i-1].PMI >= bigrams[i].PMI)
+	}
+	for _, bigram := range bigrams {
+		assert.True(t, bigram.Count >= 2)
+	}
+}
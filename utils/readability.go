@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Abbreviations whose trailing period doesn't end a sentence
+var abbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "sr": true, "jr": true, "st": true,
+	"vs": true, "etc": true, "e.g": true, "i.e": true, "fig": true, "no": true, "approx": true,
+}
+
+// ReadabilityStats holds the counts a text was scored on and its readability scores
+type ReadabilityStats struct {
+	Sentences          int     `json:"sentences"`
+	Words              int     `json:"words"`
+	Syllables          int     `json:"syllables"`
+	ComplexWords       int     `json:"complexWords"`
+	FleschReadingEase  float64 `json:"fleschReadingEase"`
+	FleschKincaidGrade float64 `json:"fleschKincaidGrade"`
+	GunningFog         float64 `json:"gunningFog"`
+	SMOGIndex          float64 `json:"smogIndex"`
+}
+
+// CountFileReadability segments the file into sentences and words, estimates the syllables
+// of every word and computes the Flesch reading ease, Flesch-Kincaid grade, Gunning fog and SMOG index
+func CountFileReadability(filePath string) (ReadabilityStats, error) {
+	var stats ReadabilityStats
+
+	file, err := OpenFile(filePath)
+	if err != nil {
+		return stats, err
+	}
+	defer file.Close()
+
+	// Sentences might span several lines, so scan the whole file word by word
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxWordLineBytes)
+	scanner.Split(scanWordsOrPieces)
+	inSentence := false
+	for scanner.Scan() {
+		field := scanner.Text()
+		for _, word := range SplitWords(field) {
+			syllables := CountSyllables(word)
+			stats.Words++
+			stats.Syllables += syllables
+			if syllables >= 3 {
+				stats.ComplexWords++
+			}
+			inSentence = true
+		}
+		if inSentence && IsSentenceEnd(field) {
+			stats.Sentences++
+			inSentence = false
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return stats, err
+	}
+
+	// The last sentence might not be terminated
+	if inSentence {
+		stats.Sentences++
+	}
+
+	stats.computeScores()
+	return stats, nil
+}
+
+// scanWordsOrPieces splits the words as bufio.ScanWords does, but cuts a word filling the whole buffer
+// after its last complete rune instead of failing, e.g. a minified or base64 encoded file
+func scanWordsOrPieces(data []byte, atEOF bool) (int, []byte, error) {
+	advance, token, err := bufio.ScanWords(data, atEOF)
+	if advance > 0 || token != nil || err != nil || len(data) < maxWordLineBytes {
+		return advance, token, err
+	}
+	cut := completeRunes(data)
+	return cut, bytes.TrimLeftFunc(data[:cut], unicode.IsSpace), nil
+}
+
+func (stats *ReadabilityStats) computeScores() {
+	if stats.Words == 0 || stats.Sentences == 0 {
+		return
+	}
+
+	wordsPerSentence := float64(stats.Words) / float64(stats.Sentences)
+	syllablesPerWord := float64(stats.Syllables) / float64(stats.Words)
+	complexWordsRatio := float64(stats.ComplexWords) / float64(stats.Words)
+
+	stats.FleschReadingEase = 206.835 - 1.015*wordsPerSentence - 84.6*syllablesPerWord
+	stats.FleschKincaidGrade = 0.39*wordsPerSentence + 11.8*syllablesPerWord - 15.59
+	stats.GunningFog = 0.4 * (wordsPerSentence + 100*complexWordsRatio)
+	stats.SMOGIndex = 1.0430*math.Sqrt(float64(stats.ComplexWords)*30/float64(stats.Sentences)) + 3.1291
+}
+
+// IsSentenceEnd reports whether a whitespace separated token ends a sentence
+func IsSentenceEnd(token string) bool {
+	// Ignore closing quotes and brackets after the punctuation
+	token = strings.TrimRightFunc(token, func(r rune) bool {
+		return strings.ContainsRune("\"')]}»”’", r)
+	})
+	if token == "" {
+		return false
+	}
+
+	switch token[len(token)-1] {
+	case '!', '?':
+		return true
+	case '.':
+		word := strings.ToLower(strings.TrimLeftFunc(strings.TrimRight(token, "."), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}))
+		// Initials such as "J." and known abbreviations
+		if len([]rune(word)) == 1 && unicode.IsLetter([]rune(word)[0]) {
+			return false
+		}
+		return !abbreviations[word]
+	}
+	return false
+}
+
+// CountSyllables estimates the number of syllables of an english word by counting its vowel groups
+func CountSyllables(word string) int {
+	word = strings.ToLower(word)
+	letters := make([]rune, 0, len(word))
+	for _, r := range word {
+		if unicode.IsLetter(r) {
+			letters = append(letters, r)
+		}
+	}
+	if len(letters) == 0 {
+		return 0
+	}
+	if len(letters) <= 3 {
+		return 1
+	}
+
+	isVowel := func(r rune) bool {
+		return strings.ContainsRune("aeiouy", r)
+	}
+
+	syllables := 0
+	previousVowel := false
+	for _, r := range letters {
+		vowel := isVowel(r)
+		if vowel && !previousVowel {
+			syllables++
+		}
+		previousVowel = vowel
+	}
+
+	// Silent trailing "e", but not in "-le" endings such as "table"
+	n := len(letters)
+	if letters[n-1] == 'e' && !(letters[n-2] == 'l' && !isVowel(letters[n-3])) {
+		syllables--
+	}
+	// "-es" and "-ed" endings are usually not pronounced as a separate syllable
+	if (letters[n-1] == 's' || letters[n-1] == 'd') && letters[n-2] == 'e' &&
+		!strings.ContainsRune("tdscxzgh", letters[n-3]) {
+		syllables--
+	}
+
+	if syllables < 1 {
+		return 1
+	}
+	return syllables
+}
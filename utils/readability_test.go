@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCountSyllables(t *testing.T) {
+	assert.Equal(t, 1, CountSyllables("the"))
+	assert.Equal(t, 1, CountSyllables("make"))
+	assert.Equal(t, 2, CountSyllables("table"))
+	assert.Equal(t, 1, CountSyllables("played"))
+	assert.Equal(t, 3, CountSyllables("messages"))
+	assert.Equal(t, 5, CountSyllables("communication"))
+}
+
+func TestIsSentenceEnd(t *testing.T) {
+	assert.True(t, IsSentenceEnd("online."))
+	assert.True(t, IsSentenceEnd("really?\""))
+	assert.False(t, IsSentenceEnd("e.g.,"))
+	assert.False(t, IsSentenceEnd("Dr."))
+	assert.False(t, IsSentenceEnd("J."))
+	assert.False(t, IsSentenceEnd("packages"))
+}
+
+func TestCountFileReadability(t *testing.T) {
+	filePath := "../data/text_files/text2.txt"
+
+	stats, err := CountFileReadability(filePath)
+	if err != nil {
+		log.Fatalf("Failed to get the readability of file: %s, error: %v", filePath, err)
+	}
+	assert.Equal(t, 2, stats.Sentences)
+	assert.Equal(t, 26, stats.Words)
+	assert.True(t, stats.FleschReadingEase < 100)
+	assert.True(t, stats.FleschKincaidGrade > 0)
+	assert.True(t, stats.GunningFog > stats.FleschKincaidGrade)
+	assert.True(t, stats.SMOGIndex > 3.1291)
+}
+
+func TestCountFileReadabilityLongTokens(t *testing.T) {
+	dir, err := ioutil.TempDir("", "utils")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// A token longer than the default buffer, and one longer than the largest buffer
+	filePath := filepath.Join(dir, "long.txt")
+	content := "A short one. " + strings.Repeat("a", 100*1024) + ". " + strings.Repeat("é", 600000) + " end."
+	assert.NoError(t, ioutil.WriteFile(filePath, []byte(content), 0644))
+
+	stats, err := CountFileReadability(filePath)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, stats.Sentences)
+		assert.Equal(t, 7, stats.Words)
+	}
+}
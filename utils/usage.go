@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// FileUsage is the size of a file, or the cumulative size of the files under a directory
+type FileUsage struct {
+	Path          string `json:"path"`
+	ApparentSize  int64  `json:"apparentSize"`
+	AllocatedSize int64  `json:"allocatedSize"`
+}
+
+// SizeBucket counts the files whose size is lower than MaxSize (unbounded if negative)
+// and higher than or equal to the bound of the previous bucket
+type SizeBucket struct {
+	Label        string `json:"label"`
+	MaxSize      int64  `json:"maxSize"`
+	FileCount    int    `json:"fileCount"`
+	ApparentSize int64  `json:"apparentSize"`
+}
+
+// DiskUsage is the usage of the files under an entry point,
+// the directory count only includes the directories containing at least one of the files
+type DiskUsage struct {
+	FileCount          int          `json:"fileCount"`
+	DirectoryCount     int          `json:"directoryCount"`
+	ApparentSize       int64        `json:"apparentSize"`
+	AllocatedSize      int64        `json:"allocatedSize"`
+	LargestFiles       []FileUsage  `json:"largestFiles"`
+	LargestDirectories []FileUsage  `json:"largestDirectories"`
+	Histogram          []SizeBucket `json:"histogram"`
+}
+
+// Upper bounds of the histogram buckets, every bucket is four times larger than the previous one
+var histogramBounds = []int64{1, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10,
+	1 << 20, 4 << 20, 16 << 20, 64 << 20, 256 << 20, 1 << 30}
+
+// ComputeDiskUsage sums the apparent and allocated sizes of the files from their status,
+// so none of them is opened
+func ComputeDiskUsage(entryPoint string, filePaths []string, fileInfos []os.FileInfo, topN int) DiskUsage {
+	var usage DiskUsage
+	usage.Histogram = newHistogram()
+
+	files := make([]FileUsage, 0, len(filePaths))
+	directories := make(map[string]*FileUsage)
+	for i, filePath := range filePaths {
+		fileUsage := FileUsage{
+			Path:          filePath,
+			ApparentSize:  fileInfos[i].Size(),
+			AllocatedSize: AllocatedSize(fileInfos[i]),
+		}
+		files = append(files, fileUsage)
+
+		usage.FileCount++
+		usage.ApparentSize += fileUsage.ApparentSize
+		usage.AllocatedSize += fileUsage.AllocatedSize
+		addToHistogram(usage.Histogram, fileUsage.ApparentSize)
+
+		// Add the file to every directory up to the entry point
+		for dir := filepath.Dir(filePath); ; dir = filepath.Dir(dir) {
+			directory, ok := directories[dir]
+			if !ok {
+				directory = &FileUsage{Path: dir}
+				directories[dir] = directory
+			}
+			directory.ApparentSize += fileUsage.ApparentSize
+			directory.AllocatedSize += fileUsage.AllocatedSize
+
+			if relativePath, err := filepath.Rel(entryPoint, dir); err != nil || relativePath == "." ||
+				dir == filepath.Dir(dir) {
+				break
+			}
+		}
+	}
+	usage.DirectoryCount = len(directories)
+
+	usage.LargestFiles = largestUsages(files, topN)
+	directoryUsages := make([]FileUsage, 0, len(directories))
+	for _, directory := range directories {
+		directoryUsages = append(directoryUsages, *directory)
+	}
+	usage.LargestDirectories = largestUsages(directoryUsages, topN)
+	return usage
+}
+
+func newHistogram() []SizeBucket {
+	histogram := make([]SizeBucket, 0, len(histogramBounds)+1)
+	for _, bound := range histogramBounds {
+		label := "< " + FormatSize(bound)
+		if bound == 1 {
+			label = "empty"
+		}
+		histogram = append(histogram, SizeBucket{Label: label, MaxSize: bound})
+	}
+	last := histogramBounds[len(histogramBounds)-1]
+	return append(histogram, SizeBucket{Label: ">= " + FormatSize(last), MaxSize: -1})
+}
+
+func addToHistogram(histogram []SizeBucket, size int64) {
+	for i := range histogram {
+		if histogram[i].MaxSize < 0 || size < histogram[i].MaxSize {
+			histogram[i].FileCount++
+			histogram[i].ApparentSize += size
+			return
+		}
+	}
+}
+
+// largestUsages returns the n usages with the largest apparent size, ties are broken by path
+func largestUsages(usages []FileUsage, n int) []FileUsage {
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].ApparentSize != usages[j].ApparentSize {
+			return usages[i].ApparentSize > usages[j].ApparentSize
+		}
+		return usages[i].Path < usages[j].Path
+	})
+	if len(usages) > n {
+		usages = usages[:n]
+	}
+	return usages
+}
+
+// FormatSize formats a number of bytes with binary units, e.g. 4KiB
+func FormatSize(size int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	unit := 0
+	for size >= 1024 && size%1024 == 0 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%d%s", size, units[unit])
+}
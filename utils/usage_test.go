@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestComputeDiskUsage(t *testing.T) {
+	dir := createTestTree(t, map[string]string{
+		"empty.txt":      "",
+		"small.txt":      "text",
+		"sub/large.txt":  strings.Repeat("a", 5000),
+		"sub/deep/x.txt": strings.Repeat("b", 2000),
+	})
+	defer os.RemoveAll(dir)
+
+	result, err := WalkEntryPoint(dir, DefaultWalkOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usage := ComputeDiskUsage(dir, result.FilePaths, result.FileInfos, 2)
+	assert.Equal(t, 4, usage.FileCount)
+	assert.Equal(t, 3, usage.DirectoryCount)
+	assert.Equal(t, int64(7004), usage.ApparentSize)
+	assert.True(t, usage.AllocatedSize > 0)
+
+	assert.Equal(t, []FileUsage{
+		{Path: filepath.Join(dir, "sub", "large.txt"), ApparentSize: 5000,
+			AllocatedSize: usage.LargestFiles[0].AllocatedSize},
+		{Path: filepath.Join(dir, "sub", "deep", "x.txt"), ApparentSize: 2000,
+			AllocatedSize: usage.LargestFiles[1].AllocatedSize},
+	}, usage.LargestFiles)
+	assert.Equal(t, dir, usage.LargestDirectories[0].Path)
+	assert.Equal(t, int64(7004), usage.LargestDirectories[0].ApparentSize)
+	assert.Equal(t, filepath.Join(dir, "sub"), usage.LargestDirectories[1].Path)
+	assert.Equal(t, int64(7000), usage.LargestDirectories[1].ApparentSize)
+
+	assert.Equal(t, "empty", usage.Histogram[0].Label)
+	assert.Equal(t, 1, usage.Histogram[0].FileCount)
+	assert.Equal(t, 1, usage.Histogram[1].FileCount)
+	assert.Equal(t, 1, usage.Histogram[2].FileCount)
+	assert.Equal(t, 1, usage.Histogram[3].FileCount)
+	assert.Equal(t, ">= 1GiB", usage.Histogram[len(usage.Histogram)-1].Label)
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "512B", FormatSize(512))
+	assert.Equal(t, "4KiB", FormatSize(4<<10))
+	assert.Equal(t, "1025B", FormatSize(1025))
+	assert.Equal(t, "256MiB", FormatSize(256<<20))
+}
@@ -0,0 +1,16 @@
+// +build !windows
+
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+// AllocatedSize returns the number of bytes allocated on disk for the file
+func AllocatedSize(fi os.FileInfo) int64 {
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return int64(stat.Blocks) * 512
+	}
+	return fi.Size()
+}
@@ -0,0 +1,11 @@
+// +build windows
+
+package utils
+
+import "os"
+
+// AllocatedSize returns the number of bytes allocated on disk for the file,
+// the allocation isn't available from the status of a file on windows so it's the apparent size
+func AllocatedSize(fi os.FileInfo) int64 {
+	return fi.Size()
+}
@@ -2,44 +2,36 @@ package utils
 
 import (
 	"bufio"
+	"io"
 	"os"
-	"path/filepath"
 	"strings"
 	"unicode"
 )
 
-func GetAllFilePathsFromEntryPoint(entryPoint string) ([]string, error) {
-	var filePaths []string
-	err := filepath.Walk(entryPoint,
-		func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-
-			// Get the status of the directory
-			fi, err := os.Stat(path)
-			if err != nil {
-				return err
-			}
+// OpenFile opens a file to read its content, it's replaced when the files aren't stored
+// as they are, e.g. compressed, so the statistics are computed on their content
+var OpenFile = func(filePath string) (io.ReadCloser, error) {
+	return os.Open(filePath)
+}
 
-			// Ensure it's a directory
-			if fi.Mode().IsDir() {
-				return nil
-			}
+// ContentSize returns the size of the content of a file, the number of bytes read through OpenFile
+var ContentSize = func(filePath string, fi os.FileInfo) (int64, error) {
+	return fi.Size(), nil
+}
 
-			filePaths = append(filePaths, path)
-			return nil
-		})
+// GetAllFilePathsFromEntryPoint lists recursively every file under the entry point
+func GetAllFilePathsFromEntryPoint(entryPoint string) ([]string, error) {
+	result, err := WalkEntryPoint(entryPoint, DefaultWalkOptions())
 	if err != nil {
 		return nil, err
 	}
-	return filePaths, nil
+	return result.FilePaths, nil
 }
 
 func CountFileAlphaChars(filePath string) (int, error) {
 	count := 0
 
-	file, err := os.Open(filePath)
+	file, err := OpenFile(filePath)
 	if err != nil {
 		return 0, err
 	}
@@ -60,7 +52,7 @@ func CountFileAverageWordLength(filePath string) (float32, error) {
 	wordCount := 0
 	totalWordLength := 0
 
-	file, err := os.Open(filePath)
+	file, err := OpenFile(filePath)
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,404 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	// ErrCancelled is returned by WalkEntryPoint when the walk was cancelled
+	ErrCancelled = errors.New("cancelled")
+	// ErrStopWalk is returned by a visit function to stop the walk without failing it
+	ErrStopWalk = errors.New("stop the walk")
+)
+
+// Reasons a file or a directory was skipped by the walker
+const (
+	SkipExcluded         = "excluded"
+	SkipNotIncluded      = "notIncluded"
+	SkipIgnored          = "ignored"
+	SkipHidden           = "hidden"
+	SkipMaxDepth         = "maxDepth"
+	SkipMaxFileSize      = "maxFileSize"
+	SkipBinary           = "binary"
+	SkipSymlink          = "symlink"
+	SkipBrokenSymlink    = "brokenSymlink"
+	SkipLoop             = "loop"
+	SkipSpecial          = "special"
+	SkipPermissionDenied = "permissionDenied"
+	SkipVanished         = "vanished"
+)
+
+// Policies for the symbolic links met by the walker
+const (
+	// Follow the links to files and directories, links creating a loop are skipped and reported
+	SymlinkFollow = "follow"
+	// Skip the links silently, they are only counted
+	SymlinkSkip = "skip"
+	// Skip the links and report each of them with its target
+	SymlinkReport = "report"
+)
+
+// Number of bytes read from a file to decide whether it's binary
+const sniffSize = 8000
+
+// WalkOptions select the files returned by WalkEntryPoint
+type WalkOptions struct {
+	// Glob patterns, a file is kept if it matches any include pattern (or there are none)
+	// and no exclude pattern, excluded directories are not walked
+	Include []string
+	Exclude []string
+	// Name of the .gitignore-style files read from every walked directory, none if empty
+	IgnoreFileName string
+	// Maximum number of directories between the entry point and a file, unlimited if negative
+	MaxDepth int
+	// Maximum size of a file in bytes, unlimited if zero
+	MaxFileSize int64
+	// Whether the files and directories starting with a dot are walked
+	IncludeHidden bool
+	// Whether the files whose content doesn't look like text are skipped
+	SkipBinary bool
+	// What to do with symbolic links, SymlinkFollow if empty
+	Symlinks string
+	// The walk fails with ErrDeadline once the deadline passed, or ErrCancelled once Done is closed,
+	// they are checked before every entry
+	Deadline time.Time
+	Done     <-chan struct{}
+	// Called with every file kept instead of adding it to the result, so the files are handled while
+	// walking, the walk stops with the error it returns, successfully if it's ErrStopWalk
+	Visit func(filePath string, fi os.FileInfo) error
+}
+
+// DefaultWalkOptions returns every file under the entry point
+func DefaultWalkOptions() WalkOptions {
+	return WalkOptions{MaxDepth: -1, IncludeHidden: true, Symlinks: SymlinkFollow}
+}
+
+// WalkReport is an entry skipped by the walker that is worth reporting individually
+type WalkReport struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// WalkResult holds the files kept by the walker along with their status (the status of the target
+// for the symbolic links followed), the number of entries skipped for each reason and the skipped entries
+// worth reporting: symbolic links (with SymlinkReport), loops and unreadable entries
+type WalkResult struct {
+	FilePaths []string
+	FileInfos []os.FileInfo
+	Skipped   map[string]int
+	Reported  []WalkReport
+}
+
+func (wr *WalkResult) skip(reason string) {
+	wr.Skipped[reason]++
+}
+
+func (wr *WalkResult) report(path string, reason string, detail string) {
+	wr.skip(reason)
+	wr.Reported = append(wr.Reported, WalkReport{Path: path, Reason: reason, Detail: detail})
+}
+
+// walker holds the state of a walk, the ancestors are the directories being walked,
+// used to detect the symbolic links pointing back to one of them
+type walker struct {
+	entryPoint  string
+	options     WalkOptions
+	include     []*Glob
+	exclude     []*Glob
+	ignoreRules []*IgnoreRules
+	ancestors   []os.FileInfo
+	result      WalkResult
+}
+
+// WalkEntryPoint lists recursively the files under the entry point selected by the options.
+//
+// Sockets, FIFOs and devices are always skipped, since reading them could block forever.
+// Entries that can't be read because of their permissions, or that vanish during the walk,
+// are skipped and reported instead of failing the whole walk.
+func WalkEntryPoint(entryPoint string, options WalkOptions) (WalkResult, error) {
+	w := &walker{
+		entryPoint: entryPoint,
+		options:    options,
+		result:     WalkResult{Skipped: make(map[string]int)},
+	}
+	if w.options.Symlinks == "" {
+		w.options.Symlinks = SymlinkFollow
+	}
+
+	var err error
+	if w.include, err = compileGlobs(options.Include); err != nil {
+		return w.result, err
+	}
+	if w.exclude, err = compileGlobs(options.Exclude); err != nil {
+		return w.result, err
+	}
+
+	// The entry point itself is always followed
+	fi, err := os.Stat(entryPoint)
+	if err != nil {
+		return w.result, err
+	}
+	if !fi.Mode().IsDir() {
+		err = w.walkFile(entryPoint, ".", fi)
+	} else {
+		err = w.walkDir(entryPoint, ".", fi)
+	}
+	if err == ErrStopWalk {
+		err = nil
+	}
+	return w.result, err
+}
+
+// interrupted returns the error ending the walk if its deadline passed or it was cancelled
+func (w *walker) interrupted() error {
+	select {
+	case <-w.options.Done:
+		return ErrCancelled
+	default:
+	}
+	if !w.options.Deadline.IsZero() && time.Now().After(w.options.Deadline) {
+		return ErrDeadline
+	}
+	return nil
+}
+
+func (w *walker) walkDir(dirPath string, relativePath string, fi os.FileInfo) error {
+	// Read the ignore file of the directory before walking its entries
+	if w.options.IgnoreFileName != "" {
+		rules, err := ReadIgnoreFile(filepath.Join(dirPath, w.options.IgnoreFileName), relativePath)
+		if err == nil {
+			w.ignoreRules = append(w.ignoreRules, rules)
+		} else if !os.IsNotExist(err) && !w.tolerate(dirPath, err) {
+			return err
+		}
+	}
+
+	entries, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		if w.tolerate(dirPath, err) {
+			return nil
+		}
+		return err
+	}
+
+	w.ancestors = append(w.ancestors, fi)
+	defer func() { w.ancestors = w.ancestors[:len(w.ancestors)-1] }()
+
+	for _, entry := range entries {
+		entryPath := filepath.Join(dirPath, entry.Name())
+		entryRelativePath := path.Join(relativePath, entry.Name())
+		if err := w.walkEntry(entryPath, entryRelativePath, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkEntry walks an entry of a directory, fi comes from Lstat
+func (w *walker) walkEntry(entryPath string, relativePath string, fi os.FileInfo) error {
+	if err := w.interrupted(); err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		switch w.options.Symlinks {
+		case SymlinkSkip:
+			w.result.skip(SkipSymlink)
+			return nil
+		case SymlinkReport:
+			target, _ := os.Readlink(entryPath)
+			w.result.report(entryPath, SkipSymlink, target)
+			return nil
+		}
+
+		// Follow the link
+		target, err := os.Stat(entryPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				link, _ := os.Readlink(entryPath)
+				w.result.report(entryPath, SkipBrokenSymlink, link)
+				return nil
+			}
+			if w.tolerate(entryPath, err) {
+				return nil
+			}
+			return err
+		}
+		if target.Mode().IsDir() {
+			for _, ancestor := range w.ancestors {
+				if os.SameFile(ancestor, target) {
+					link, _ := os.Readlink(entryPath)
+					w.result.report(entryPath, SkipLoop, link)
+					return nil
+				}
+			}
+		}
+		fi = target
+	}
+
+	if !fi.Mode().IsDir() && !fi.Mode().IsRegular() {
+		w.result.skip(SkipSpecial)
+		return nil
+	}
+
+	isDir := fi.Mode().IsDir()
+	if reason := filterEntry(relativePath, fi, isDir, w.options, w.include, w.exclude, w.ignoreRules); reason != "" {
+		w.result.skip(reason)
+		return nil
+	}
+
+	if isDir {
+		return w.walkDir(entryPath, relativePath, fi)
+	}
+	return w.walkFile(entryPath, relativePath, fi)
+}
+
+func (w *walker) walkFile(filePath string, relativePath string, fi os.FileInfo) error {
+	if w.options.SkipBinary {
+		binary, err := IsBinaryFile(filePath)
+		if err != nil {
+			if w.tolerate(filePath, err) {
+				return nil
+			}
+			return err
+		}
+		if binary {
+			w.result.skip(SkipBinary)
+			return nil
+		}
+	}
+
+	if w.options.Visit != nil {
+		return w.options.Visit(filePath, fi)
+	}
+	w.result.FilePaths = append(w.result.FilePaths, filePath)
+	w.result.FileInfos = append(w.result.FileInfos, fi)
+	return nil
+}
+
+// tolerate reports the entries that can't be read because of their permissions or that vanished,
+// it returns false for any other error
+func (w *walker) tolerate(entryPath string, err error) bool {
+	switch {
+	case os.IsPermission(err):
+		w.result.report(entryPath, SkipPermissionDenied, err.Error())
+		return true
+	case os.IsNotExist(err):
+		w.result.report(entryPath, SkipVanished, err.Error())
+		return true
+	}
+	return false
+}
+
+// filterEntry returns the reason an entry is skipped, or an empty string if it's kept
+func filterEntry(relativePath string, fi os.FileInfo, isDir bool, options WalkOptions,
+	include []*Glob, exclude []*Glob, ignoreRules []*IgnoreRules) string {
+	name := filepath.Base(relativePath)
+	if !options.IncludeHidden && strings.HasPrefix(name, ".") {
+		return SkipHidden
+	}
+	// Files of a directory are one level deeper than the directory
+	if isDir && options.MaxDepth >= 0 && strings.Count(relativePath, "/") >= options.MaxDepth {
+		return SkipMaxDepth
+	}
+	for _, glob := range exclude {
+		if glob.Match(relativePath) {
+			return SkipExcluded
+		}
+	}
+
+	// Deeper ignore files take precedence over the upper ones
+	ignored := false
+	for _, rules := range ignoreRules {
+		if ruleIgnored, matched := rules.Match(relativePath, isDir); matched {
+			ignored = ruleIgnored
+		}
+	}
+	if ignored {
+		return SkipIgnored
+	}
+
+	// Include patterns and limits apply to files only
+	if isDir {
+		return ""
+	}
+	if options.IgnoreFileName != "" && name == options.IgnoreFileName {
+		return SkipIgnored
+	}
+	if len(include) > 0 {
+		included := false
+		for _, glob := range include {
+			if glob.Match(relativePath) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return SkipNotIncluded
+		}
+	}
+	if options.MaxFileSize > 0 && fi.Size() > options.MaxFileSize {
+		return SkipMaxFileSize
+	}
+	return ""
+}
+
+func compileGlobs(patterns []string) ([]*Glob, error) {
+	var globs []*Glob
+	for _, pattern := range patterns {
+		glob, err := CompileGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		globs = append(globs, glob)
+	}
+	return globs, nil
+}
+
+// IsBinaryFile sniffs the beginning of the file, it's considered binary if it contains a NUL byte,
+// isn't valid UTF-8 or contains too many control characters
+func IsBinaryFile(filePath string) (bool, error) {
+	file, err := OpenFile(filePath)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, sniffSize)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	return IsBinary(buf[:n]), nil
+}
+
+func IsBinary(b []byte) bool {
+	if bytes.IndexByte(b, 0) >= 0 {
+		return true
+	}
+
+	// The sample might end in the middle of a multi-byte character
+	for i := 0; i < utf8.UTFMax && len(b) > 0 && !utf8.Valid(b); i++ {
+		b = b[:len(b)-1]
+	}
+	if !utf8.Valid(b) {
+		return true
+	}
+
+	controls := 0
+	for _, c := range b {
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' && c != '\f' && c != '\b' || c == 0x7f {
+			controls++
+		}
+	}
+	return controls*10 > len(b)
+}
@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// createTestTree creates the files under a temporary directory and returns its path
+func createTestTree(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "walk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		filePath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// relativePaths returns the sorted slash separated paths relative to the directory
+func relativePaths(dir string, filePaths []string) []string {
+	var paths []string
+	for _, filePath := range filePaths {
+		relativePath, _ := filepath.Rel(dir, filePath)
+		paths = append(paths, filepath.ToSlash(relativePath))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestWalkEntryPointDefault(t *testing.T) {
+	dir := createTestTree(t, map[string]string{
+		"a.txt":         "text",
+		".hidden.txt":   "text",
+		"sub/b.txt.tmp": "text",
+		"sub/image.png": "\x89PNG\r\n\x1a\n\x00\x00",
+	})
+	defer os.RemoveAll(dir)
+
+	result, err := WalkEntryPoint(dir, DefaultWalkOptions())
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{".hidden.txt", "a.txt", "sub/b.txt.tmp", "sub/image.png"},
+			relativePaths(dir, result.FilePaths))
+		assert.Empty(t, result.Skipped)
+	}
+}
+
+func TestWalkEntryPointVisit(t *testing.T) {
+	dir := createTestTree(t, map[string]string{
+		"a.txt":     "text",
+		"b.txt":     "text",
+		"sub/c.txt": "text",
+	})
+	defer os.RemoveAll(dir)
+
+	// The walk stops once the visit function asks for it, without listing the files
+	var visited []string
+	options := DefaultWalkOptions()
+	options.Visit = func(filePath string, fi os.FileInfo) error {
+		visited = append(visited, filePath)
+		if len(visited) == 2 {
+			return ErrStopWalk
+		}
+		return nil
+	}
+	result, err := WalkEntryPoint(dir, options)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, len(visited))
+		assert.Empty(t, result.FilePaths)
+	}
+
+	options = DefaultWalkOptions()
+	options.Deadline = time.Now().Add(-time.Second)
+	_, err = WalkEntryPoint(dir, options)
+	assert.Equal(t, ErrDeadline, err)
+
+	done := make(chan struct{})
+	close(done)
+	options = DefaultWalkOptions()
+	options.Done = done
+	_, err = WalkEntryPoint(dir, options)
+	assert.Equal(t, ErrCancelled, err)
+}
+
+func TestWalkEntryPointFilters(t *testing.T) {
+	dir := createTestTree(t, map[string]string{
+		"a.txt":               "text",
+		"a.md":                "text",
+		".hidden.txt":         "text",
+		"large.txt":           "a much larger text file",
+		"sub/b.txt.tmp":       "text",
+		"sub/image.txt":       "\x89PNG\r\n\x1a\n\x00\x00",
+		"sub/deep/c.txt":      "text",
+		"sub/.gitignore":      "*.log\n",
+		"sub/debug.log":       "text",
+		"vendor/lib/d.txt":    "text",
+		"sub/deep/keep.txt":   "text",
+		"sub/deep/.gitignore": "keep.txt\n!keep.txt\n",
+	})
+	defer os.RemoveAll(dir)
+
+	options := DefaultWalkOptions()
+	options.Include = []string{"*.txt", "*.log"}
+	options.Exclude = []string{"*.tmp", "vendor"}
+	options.IgnoreFileName = ".gitignore"
+	options.MaxDepth = 2
+	options.MaxFileSize = 10
+	options.IncludeHidden = false
+	options.SkipBinary = true
+
+	result, err := WalkEntryPoint(dir, options)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"a.txt", "sub/deep/c.txt", "sub/deep/keep.txt"}, relativePaths(dir, result.FilePaths))
+		assert.Equal(t, map[string]int{
+			SkipHidden:      3,
+			SkipNotIncluded: 1,
+			SkipMaxFileSize: 1,
+			SkipExcluded:    2,
+			SkipBinary:      1,
+			SkipIgnored:     1,
+		}, result.Skipped)
+	}
+
+	options.MaxDepth = 1
+	result, err = WalkEntryPoint(dir, options)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"a.txt"}, relativePaths(dir, result.FilePaths))
+		assert.Equal(t, 1, result.Skipped[SkipMaxDepth])
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	assert.False(t, IsBinary([]byte("Hello, World!\n")))
+	assert.False(t, IsBinary([]byte("Ünïcödé text")))
+	assert.False(t, IsBinary([]byte("Ünïcödé")[:2]))
+	assert.True(t, IsBinary([]byte("\x89PNG\r\n\x1a\n\x00\x00")))
+	assert.True(t, IsBinary([]byte{0xff, 0xfe, 0xfd, 0x41, 0x42, 0x43, 0x44, 0x45}))
+}
@@ -0,0 +1,92 @@
+// +build !windows
+
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestWalkEntryPointSymlinks(t *testing.T) {
+	dir := createTestTree(t, map[string]string{
+		"a.txt":     "text",
+		"sub/b.txt": "text",
+	})
+	defer os.RemoveAll(dir)
+
+	// A link to a file, a link to a directory, a loop and a broken link
+	assert.NoError(t, os.Symlink(filepath.Join(dir, "a.txt"), filepath.Join(dir, "link.txt")))
+	assert.NoError(t, os.Symlink(filepath.Join(dir, "sub"), filepath.Join(dir, "linked")))
+	assert.NoError(t, os.Symlink(dir, filepath.Join(dir, "sub", "loop")))
+	assert.NoError(t, os.Symlink(filepath.Join(dir, "missing"), filepath.Join(dir, "broken")))
+
+	options := DefaultWalkOptions()
+	result, err := WalkEntryPoint(dir, options)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"a.txt", "link.txt", "linked/b.txt", "sub/b.txt"}, relativePaths(dir, result.FilePaths))
+		assert.Equal(t, map[string]int{SkipLoop: 2, SkipBrokenSymlink: 1}, result.Skipped)
+		assert.Equal(t, 3, len(result.Reported))
+	}
+
+	options.Symlinks = SymlinkSkip
+	result, err = WalkEntryPoint(dir, options)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"a.txt", "sub/b.txt"}, relativePaths(dir, result.FilePaths))
+		assert.Equal(t, map[string]int{SkipSymlink: 4}, result.Skipped)
+		assert.Empty(t, result.Reported)
+	}
+
+	options.Symlinks = SymlinkReport
+	result, err = WalkEntryPoint(dir, options)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"a.txt", "sub/b.txt"}, relativePaths(dir, result.FilePaths))
+		assert.Equal(t, 4, len(result.Reported))
+		assert.Contains(t, result.Reported, WalkReport{
+			Path:   filepath.Join(dir, "linked"),
+			Reason: SkipSymlink,
+			Detail: filepath.Join(dir, "sub"),
+		})
+	}
+}
+
+func TestWalkEntryPointSpecialFiles(t *testing.T) {
+	dir := createTestTree(t, map[string]string{"a.txt": "text"})
+	defer os.RemoveAll(dir)
+
+	if err := syscall.Mkfifo(filepath.Join(dir, "fifo"), 0644); err != nil {
+		t.Skipf("Unable to create a FIFO: %v", err)
+	}
+
+	options := DefaultWalkOptions()
+	options.SkipBinary = true
+	result, err := WalkEntryPoint(dir, options)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"a.txt"}, relativePaths(dir, result.FilePaths))
+		assert.Equal(t, map[string]int{SkipSpecial: 1}, result.Skipped)
+	}
+}
+
+func TestWalkEntryPointPermissionDenied(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("Permissions are not enforced for root")
+	}
+
+	dir := createTestTree(t, map[string]string{
+		"a.txt":        "text",
+		"secret/b.txt": "text",
+	})
+	defer os.RemoveAll(dir)
+
+	secret := filepath.Join(dir, "secret")
+	assert.NoError(t, os.Chmod(secret, 0))
+	defer os.Chmod(secret, 0755)
+
+	result, err := WalkEntryPoint(dir, DefaultWalkOptions())
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"a.txt"}, relativePaths(dir, result.FilePaths))
+		assert.Equal(t, map[string]int{SkipPermissionDenied: 1}, result.Skipped)
+	}
+}
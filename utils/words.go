@@ -0,0 +1,411 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Longest line whose words are scanned at once, longer lines are cut between two words
+const maxWordLineBytes = 1024 * 1024
+
+// EnglishStopwords is the built-in stopword list, selected with the name "english".
+var EnglishStopwords = []string{
+	"a", "about", "above", "after", "again", "against", "all", "am", "an", "and", "any", "are", "as", "at",
+	"be", "because", "been", "before", "being", "below", "between", "both", "but", "by",
+	"can", "could", "did", "do", "does", "doing", "down", "during", "each", "few", "for", "from", "further",
+	"had", "has", "have", "having", "he", "her", "here", "hers", "herself", "him", "himself", "his", "how",
+	"i", "if", "in", "into", "is", "it", "its", "itself", "just", "me", "more", "most", "my", "myself",
+	"no", "nor", "not", "now", "of", "off", "on", "once", "only", "or", "other", "our", "ours", "ourselves",
+	"out", "over", "own", "same", "she", "should", "so", "some", "such", "than", "that", "the", "their",
+	"theirs", "them", "themselves", "then", "there", "these", "they", "this", "those", "through", "to", "too",
+	"under", "until", "up", "very", "was", "we", "were", "what", "when", "where", "which", "while", "who",
+	"whom", "why", "will", "with", "would", "you", "your", "yours", "yourself", "yourselves",
+}
+
+// WordOptions controls how raw words are normalised before being counted.
+type WordOptions struct {
+	CaseFolding   bool
+	MinWordLength int
+	Stopwords     map[string]bool
+}
+
+// ParseStopwords builds a stopword set from a comma separated list,
+// the name "english" expands to EnglishStopwords. The stopwords are kept in lower case,
+// they're matched whatever the case of the words.
+func ParseStopwords(list string) map[string]bool {
+	stopwords := make(map[string]bool)
+	for _, word := range strings.Split(list, ",") {
+		word = strings.TrimSpace(word)
+		if word == "" {
+			continue
+		}
+		if word == "english" {
+			for _, stopword := range EnglishStopwords {
+				stopwords[stopword] = true
+			}
+			continue
+		}
+		stopwords[strings.ToLower(word)] = true
+	}
+	return stopwords
+}
+
+// SplitWords splits a line into words, stripping the punctuation around each of them
+func SplitWords(line string) []string {
+	var words []string
+	for _, field := range strings.Fields(line) {
+		word := strings.TrimFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// ScanFileWords calls fn with the words of every line of the file, a line longer than 1 MiB is
+// passed in several pieces
+func ScanFileWords(filePath string, fn func(words []string)) error {
+	file, err := OpenFile(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxWordLineBytes)
+	scanner.Split(scanLinesOrPieces)
+	for scanner.Scan() {
+		fn(SplitWords(scanner.Text()))
+	}
+	return scanner.Err()
+}
+
+// scanLinesOrPieces splits the lines as bufio.ScanLines does, but cuts a line filling the whole buffer
+// after its last space, or its last complete rune if it has none, instead of failing
+func scanLinesOrPieces(data []byte, atEOF bool) (int, []byte, error) {
+	advance, token, err := bufio.ScanLines(data, atEOF)
+	if advance > 0 || token != nil || err != nil || len(data) < maxWordLineBytes {
+		return advance, token, err
+	}
+	if i := bytes.LastIndexFunc(data, unicode.IsSpace); i > 0 {
+		return i + 1, data[:i], nil
+	}
+	cut := completeRunes(data)
+	return cut, data[:cut], nil
+}
+
+// completeRunes returns the length of the data without its last rune if it's cut short
+func completeRunes(data []byte) int {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(data)
+}
+
+// NormalizeWord applies the options to a word, returns false if the word should be ignored
+func NormalizeWord(word string, options WordOptions) (string, bool) {
+	if options.CaseFolding {
+		word = strings.ToLower(word)
+	}
+	if len([]rune(word)) < options.MinWordLength {
+		return "", false
+	}
+	if options.Stopwords[strings.ToLower(word)] {
+		return "", false
+	}
+	return word, true
+}
+
+// WordCount is the number of occurrences of a word
+type WordCount struct {
+	Word  string `json:"word"`
+	Count int    `json:"count"`
+}
+
+// WordFrequencyStats summarises the words counted by a WordCounter
+type WordFrequencyStats struct {
+	TopWords       []WordCount `json:"topWords"`
+	TokenCount     int         `json:"tokenCount"`
+	VocabularySize int         `json:"vocabularySize"`
+	HapaxCount     int         `json:"hapaxCount"`
+	TypeTokenRatio float64     `json:"typeTokenRatio"`
+	Approximate    bool        `json:"approximate"`
+}
+
+// WordCounter counts words exactly until it has seen maxExactWords distinct words,
+// after which it switches to a count-min sketch so the memory stays bounded.
+//
+// In approximate mode only a fixed number of candidates for the top words are tracked,
+// the vocabulary size is estimated by linear counting and the hapax count is derived
+// from the number of words the sketch has seen more than once.
+type WordCounter struct {
+	topN          int
+	maxExactWords int
+	tokenCount    int
+
+	// Exact mode
+	counts map[string]int
+
+	// Approximate mode
+	sketch        *CountMinSketch
+	candidates    *candidateHeap
+	distinctWords []uint64
+	repeatedWords int
+}
+
+const (
+	sketchWidth         = 1 << 16
+	sketchDepth         = 4
+	distinctBitmapWidth = 1 << 20
+	minCandidates       = 64
+)
+
+func NewWordCounter(topN int, maxExactWords int) *WordCounter {
+	return &WordCounter{
+		topN:          topN,
+		maxExactWords: maxExactWords,
+		counts:        make(map[string]int),
+	}
+}
+
+func (wc *WordCounter) Add(word string) {
+	wc.tokenCount++
+
+	if wc.sketch == nil {
+		wc.counts[word]++
+		if len(wc.counts) > wc.maxExactWords {
+			wc.switchToApproximate()
+		}
+		return
+	}
+
+	previous := wc.sketch.Estimate(word)
+	wc.sketch.Add(word, 1)
+	if previous == 1 {
+		wc.repeatedWords++
+	}
+	wc.markDistinct(word)
+	wc.trackCandidate(word, previous+1)
+}
+
+// AddFile counts every word of the file
+func (wc *WordCounter) AddFile(filePath string, options WordOptions) error {
+	return ScanFileWords(filePath, func(words []string) {
+		for _, word := range words {
+			if word, ok := NormalizeWord(word, options); ok {
+				wc.Add(word)
+			}
+		}
+	})
+}
+
+func (wc *WordCounter) Stats() WordFrequencyStats {
+	stats := WordFrequencyStats{TokenCount: wc.tokenCount}
+
+	var counts map[string]int
+	if wc.sketch == nil {
+		counts = wc.counts
+		stats.VocabularySize = len(wc.counts)
+		for _, count := range wc.counts {
+			if count == 1 {
+				stats.HapaxCount++
+			}
+		}
+	} else {
+		counts = wc.candidates.counts()
+		stats.Approximate = true
+		stats.VocabularySize = wc.estimateDistinct()
+		stats.HapaxCount = stats.VocabularySize - wc.repeatedWords
+		if stats.HapaxCount < 0 {
+			stats.HapaxCount = 0
+		}
+	}
+
+	stats.TopWords = TopWordCounts(counts, wc.topN)
+	if stats.TokenCount > 0 {
+		stats.TypeTokenRatio = float64(stats.VocabularySize) / float64(stats.TokenCount)
+	}
+	return stats
+}
+
+func (wc *WordCounter) switchToApproximate() {
+	wc.sketch = NewCountMinSketch(sketchWidth, sketchDepth)
+	wc.candidates = &candidateHeap{index: make(map[string]int)}
+	wc.distinctWords = make([]uint64, distinctBitmapWidth/64)
+
+	for word, count := range wc.counts {
+		wc.sketch.Add(word, count)
+		if count > 1 {
+			wc.repeatedWords++
+		}
+		wc.markDistinct(word)
+		wc.trackCandidate(word, count)
+	}
+	wc.counts = nil
+}
+
+func (wc *WordCounter) candidateCapacity() int {
+	if wc.topN*4 > minCandidates {
+		return wc.topN * 4
+	}
+	return minCandidates
+}
+
+func (wc *WordCounter) trackCandidate(word string, count int) {
+	candidates := wc.candidates
+	if i, ok := candidates.index[word]; ok {
+		candidates.items[i].count = count
+		heap.Fix(candidates, i)
+		return
+	}
+	if candidates.Len() < wc.candidateCapacity() {
+		heap.Push(candidates, candidate{word: word, count: count})
+		return
+	}
+
+	// Replace the least frequent candidate if the word is more frequent
+	if count > candidates.items[0].count {
+		delete(candidates.index, candidates.items[0].word)
+		candidates.items[0] = candidate{word: word, count: count}
+		candidates.index[word] = 0
+		heap.Fix(candidates, 0)
+	}
+}
+
+// candidate is a word tracked for the top words in approximate mode
+type candidate struct {
+	word  string
+	count int
+}
+
+// candidateHeap is a min-heap of the candidates by count, with the position of every word in it
+type candidateHeap struct {
+	items []candidate
+	index map[string]int
+}
+
+func (h *candidateHeap) Len() int           { return len(h.items) }
+func (h *candidateHeap) Less(i, j int) bool { return h.items[i].count < h.items[j].count }
+
+func (h *candidateHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.index[h.items[i].word] = i
+	h.index[h.items[j].word] = j
+}
+
+func (h *candidateHeap) Push(x interface{}) {
+	c := x.(candidate)
+	h.index[c.word] = len(h.items)
+	h.items = append(h.items, c)
+}
+
+func (h *candidateHeap) Pop() interface{} {
+	c := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	delete(h.index, c.word)
+	return c
+}
+
+// counts returns the count of every candidate by word
+func (h *candidateHeap) counts() map[string]int {
+	counts := make(map[string]int, len(h.items))
+	for _, c := range h.items {
+		counts[c.word] = c.count
+	}
+	return counts
+}
+
+func (wc *WordCounter) markDistinct(word string) {
+	bit := hashWord(word) % distinctBitmapWidth
+	wc.distinctWords[bit/64] |= 1 << (bit % 64)
+}
+
+// estimateDistinct estimates the number of distinct words by linear counting
+func (wc *WordCounter) estimateDistinct() int {
+	zeros := 0
+	for _, block := range wc.distinctWords {
+		zeros += 64 - bits.OnesCount64(block)
+	}
+	if zeros == 0 {
+		zeros = 1
+	}
+	m := float64(distinctBitmapWidth)
+	return int(math.Round(-m * math.Log(float64(zeros)/m)))
+}
+
+// TopWordCounts returns the n most frequent words, ties are broken alphabetically
+func TopWordCounts(counts map[string]int, n int) []WordCount {
+	wordCounts := make([]WordCount, 0, len(counts))
+	for word, count := range counts {
+		wordCounts = append(wordCounts, WordCount{Word: word, Count: count})
+	}
+	sort.Slice(wordCounts, func(i, j int) bool {
+		if wordCounts[i].Count != wordCounts[j].Count {
+			return wordCounts[i].Count > wordCounts[j].Count
+		}
+		return wordCounts[i].Word < wordCounts[j].Word
+	})
+	if n >= 0 && len(wordCounts) > n {
+		wordCounts = wordCounts[:n]
+	}
+	return wordCounts
+}
+
+// CountMinSketch estimates the frequency of items in a fixed amount of memory,
+// estimates are never lower than the real frequency.
+type CountMinSketch struct {
+	width uint64
+	rows  [][]uint32
+}
+
+func NewCountMinSketch(width int, depth int) *CountMinSketch {
+	rows := make([][]uint32, depth)
+	for i := range rows {
+		rows[i] = make([]uint32, width)
+	}
+	return &CountMinSketch{width: uint64(width), rows: rows}
+}
+
+func (s *CountMinSketch) Add(item string, count int) {
+	h1, h2 := splitHash(hashWord(item))
+	for i, row := range s.rows {
+		row[(h1+uint64(i)*h2)%s.width] += uint32(count)
+	}
+}
+
+func (s *CountMinSketch) Estimate(item string) int {
+	h1, h2 := splitHash(hashWord(item))
+	estimate := uint32(math.MaxUint32)
+	for i, row := range s.rows {
+		if value := row[(h1+uint64(i)*h2)%s.width]; value < estimate {
+			estimate = value
+		}
+	}
+	return int(estimate)
+}
+
+func hashWord(word string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(word))
+	return h.Sum64()
+}
+
+// splitHash derives two hashes from one, the second one is odd so the rows never collapse
+func splitHash(hash uint64) (uint64, uint64) {
+	return hash & 0xffffffff, (hash >> 32) | 1
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"fmt"
+	"github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitWords(t *testing.T) {
+	words := SplitWords("As of 2017, text (SMS) messages -- e.g., emailing.")
+	assert.Equal(t, []string{"As", "of", "2017", "text", "SMS", "messages", "e.g", "emailing"}, words)
+}
+
+func TestScanFileWordsLongLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "utils")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "long.txt")
+	content := strings.Repeat("word ", 500000) + "\n" + strings.Repeat("é", 600000) + "\nend\n"
+	assert.NoError(t, ioutil.WriteFile(filePath, []byte(content), 0644))
+
+	counts := make(map[string]int)
+	err = ScanFileWords(filePath, func(words []string) {
+		for _, word := range words {
+			if strings.HasPrefix(word, "é") {
+				word = "é..."
+			}
+			counts[word]++
+		}
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]int{"word": 500000, "é...": 2, "end": 1}, counts)
+	}
+}
+
+func TestWordCounterExact(t *testing.T) {
+	filePath := "../data/text_files/text2.txt"
+	options := WordOptions{
+		CaseFolding: true,
+		Stopwords:   ParseStopwords("english"),
+	}
+
+	counter := NewWordCounter(3, 1000)
+	if err := counter.AddFile(filePath, options); err != nil {
+		log.Fatalf("Failed to count the words of file: %s, error: %v", filePath, err)
+	}
+
+	stats := counter.Stats()
+	assert.False(t, stats.Approximate)
+	assert.Equal(t, []WordCount{{"free", 2}, {"sms", 2}, {"websites", 2}}, stats.TopWords)
+	assert.Equal(t, 18, stats.TokenCount)
+	assert.Equal(t, 15, stats.VocabularySize)
+	assert.Equal(t, 12, stats.HapaxCount)
+}
+
+func TestNormalizeWordStopwords(t *testing.T) {
+	// The stopwords are matched whatever the case, folded or not
+	for _, caseFolding := range []bool{true, false} {
+		options := WordOptions{CaseFolding: caseFolding, Stopwords: ParseStopwords("english,Apple")}
+		for _, word := range []string{"the", "The", "AND", "apple", "APPLE"} {
+			_, ok := NormalizeWord(word, options)
+			assert.False(t, ok, word)
+		}
+		word, ok := NormalizeWord("Pear", options)
+		assert.True(t, ok)
+		assert.Equal(t, caseFolding, word == "pear")
+	}
+}
+
+func TestWordCounterApproximate(t *testing.T) {
+	counter := NewWordCounter(2, 100)
+	for i := 0; i < 1000; i++ {
+		counter.Add(fmt.Sprintf("word%d", i))
+		if i%10 == 0 {
+			counter.Add("frequent")
+			counter.Add("frequent")
+		}
+		if i%20 == 0 {
+			counter.Add("common")
+		}
+	}
+
+	stats := counter.Stats()
+	assert.True(t, stats.Approximate)
+	assert.Equal(t, []WordCount{{"frequent", 200}, {"common", 50}}, stats.TopWords)
+	assert.InDelta(t, 1002, stats.VocabularySize, 10)
+	assert.InDelta(t, 1000, stats.HapaxCount, 10)
+}